@@ -0,0 +1,341 @@
+// Command wsbench is a load generator for WebSocket servers, built on the
+// client of this module so client regressions show in its numbers too.
+//
+// Open 1000 connections over 10 seconds, each sending a 128 bytes message
+// every 100ms for a minute, and measure the round trip of every echo:
+//
+//	wsbench -c ws://localhost:8080/ -n 1000 -ramp-up 10s -rate 10 -size 128 -duration 1m
+//
+// In echo mode, the default, the server is expected to echo every message
+// in order, and the round trip time of each one is measured. With -rate 0,
+// a connection sends its next message once the previous one came back. In
+// fire mode messages are only sent, as fast as possible with -rate 0; what
+// the server sends is read and counted.
+//
+// wsbench reports the connect latency, the round trip percentiles, the
+// throughput, and how connections failed and closed, as text or with -json
+// as JSON. On interrupt, the connections are closed and the report covers
+// the run so far.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prafitradimas/websocket/internal/cliflag"
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// Modes of a run.
+const (
+	modeEcho = "echo"
+	modeFire = "fire"
+)
+
+// config holds the parameters of a run.
+type config struct {
+	url      string
+	mode     string
+	conns    int
+	rampUp   time.Duration
+	duration time.Duration
+	size     int
+	rate     float64
+	opcode   websocket.Opcode
+}
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	var (
+		cfg          config
+		binary       = flag.Bool("binary", false, "send binary messages instead of text")
+		timeout      = flag.Duration("timeout", 10*time.Second, "how long a connection may take to open")
+		asJSON       = flag.Bool("json", false, "print the report as JSON")
+		insecure     = flag.Bool("insecure", false, "do not verify the TLS certificate of the server")
+		header       = cliflag.Header{}
+		subprotocols cliflag.List
+	)
+	flag.StringVar(&cfg.url, "c", "", "ws://, wss://, ws+unix:// or wss+unix:// URL to connect to")
+	flag.StringVar(&cfg.mode, "mode", modeEcho, "echo to measure round trips, or fire to only send")
+	flag.IntVar(&cfg.conns, "n", 10, "number of connections")
+	flag.DurationVar(&cfg.rampUp, "ramp-up", 0, "how long to spread the opening of the connections over")
+	flag.DurationVar(&cfg.duration, "duration", 10*time.Second, "how long to send messages after the ramp-up")
+	flag.IntVar(&cfg.size, "size", 32, "message size in bytes")
+	flag.Float64Var(&cfg.rate, "rate", 1, "messages per second per connection, 0 for as fast as possible")
+	flag.Var(header, "H", "header to send with the handshake, as \"Name: value\" (repeatable)")
+	flag.Var(&subprotocols, "s", "subprotocol to offer (repeatable)")
+	flag.Parse()
+
+	if cfg.url == "" && flag.NArg() == 1 {
+		cfg.url = flag.Arg(0)
+	}
+
+	if cfg.url == "" || cfg.conns <= 0 || cfg.size < 0 || cfg.rate < 0 || (cfg.mode != modeEcho && cfg.mode != modeFire) {
+		flag.Usage()
+		return 2
+	}
+
+	cfg.opcode = websocket.OpcodeTextFrame
+	if *binary {
+		cfg.opcode = websocket.OpcodeBinaryFrame
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client := &websocket.WebSocketClient{Subprotocols: subprotocols}
+	if *insecure {
+		client.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	b := &bench{
+		cfg:     &cfg,
+		opts:    &websocket.DialOptions{Client: client, Header: http.Header(header), HandshakeTimeout: *timeout},
+		payload: payload(cfg.size),
+		stats:   newStats(),
+	}
+	report := b.run(ctx)
+
+	var err error
+	if *asJSON {
+		err = report.writeJSON(os.Stdout)
+	} else {
+		err = report.writeText(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if report.Connected < report.Connections || len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// payload returns a printable message of size bytes, valid as text and
+// binary alike.
+func payload(size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = 'a' + byte(i%26)
+	}
+	return b
+}
+
+// bench runs the connections of a run.
+type bench struct {
+	cfg     *config
+	opts    *websocket.DialOptions
+	payload []byte
+	stats   *stats
+}
+
+func (b *bench) run(ctx context.Context) *report {
+	start := time.Now()
+	end := start.Add(b.cfg.rampUp + b.cfg.duration)
+
+	var wg sync.WaitGroup
+	for i := range b.cfg.conns {
+		delay := b.cfg.rampUp * time.Duration(i) / time.Duration(b.cfg.conns)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b.connection(ctx, delay, end)
+		}()
+	}
+	wg.Wait()
+
+	return b.stats.report(b.cfg, time.Since(start))
+}
+
+// connection opens a connection after delay and sends messages on it until
+// end.
+func (b *bench) connection(ctx context.Context, delay time.Duration, end time.Time) {
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return
+	}
+
+	start := time.Now()
+	ws, err := websocket.Dial(ctx, b.cfg.url, b.opts)
+	if err != nil {
+		if ctx.Err() == nil {
+			b.stats.fail("connect", err)
+		}
+		return
+	}
+	defer ws.Close()
+	b.stats.connected(time.Since(start))
+
+	c := &conn{
+		ws:     ws,
+		echo:   b.cfg.mode == modeEcho,
+		echoed: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go c.readLoop(b.stats)
+
+	if err := c.send(ctx, b.cfg, b.payload, end); err != nil {
+		b.stats.fail("write", err)
+	}
+
+	c.closing.Store(true)
+	ws.WriteCloseMessage(websocket.CloseNormalClosure, nil)
+	select {
+	case <-c.done:
+	case <-time.After(websocket.CloseHandshakeTimeout):
+		ws.Close()
+		<-c.done
+	}
+
+	b.stats.closed(c.code)
+	b.stats.add(&c.stats)
+}
+
+// conn is a connection of the run. Its writer counts what it sends, its
+// reader what it receives, and pending holds the send times of the messages
+// whose echo has not arrived yet.
+type conn struct {
+	ws      websocket.WebSocket
+	echo    bool
+	closing atomic.Bool
+
+	mu      sync.Mutex
+	pending []time.Time
+
+	// echoed is signaled by the reader for every echo, done is closed by
+	// the reader once the connection ended with code.
+	echoed chan struct{}
+	done   chan struct{}
+	code   websocket.CloseStatus
+
+	stats connStats
+}
+
+// send writes messages at the rate of cfg until end, ctx is done or the
+// reader stops.
+func (c *conn) send(ctx context.Context, cfg *config, payload []byte, end time.Time) error {
+	var tick <-chan time.Time
+	if cfg.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	deadline := time.NewTimer(time.Until(end))
+	defer deadline.Stop()
+
+	for first := true; ; first = false {
+		switch {
+		case tick != nil:
+			select {
+			case <-tick:
+			case <-deadline.C:
+				return nil
+			case <-ctx.Done():
+				return nil
+			case <-c.done:
+				return nil
+			}
+		case c.echo && !first:
+			select {
+			case <-c.echoed:
+			case <-deadline.C:
+				return nil
+			case <-ctx.Done():
+				return nil
+			case <-c.done:
+				return nil
+			}
+		default:
+			select {
+			case <-deadline.C:
+				return nil
+			case <-ctx.Done():
+				return nil
+			case <-c.done:
+				return nil
+			default:
+			}
+		}
+
+		if c.echo {
+			c.mu.Lock()
+			c.pending = append(c.pending, time.Now())
+			c.mu.Unlock()
+		}
+
+		if err := c.ws.WriteMessage(cfg.opcode, payload); err != nil {
+			return err
+		}
+		c.stats.sent++
+		c.stats.sentBytes += int64(len(payload))
+	}
+}
+
+// readLoop counts the messages received, measures the round trip of the
+// echoes and answers pings, until the connection ends.
+func (c *conn) readLoop(s *stats) {
+	defer close(c.done)
+
+	for {
+		msg := c.ws.ReadMessage()
+		if msg.Err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(msg.Err, &closeErr) {
+				c.code = closeErr.Code
+				return
+			}
+
+			if !c.closing.Load() {
+				s.fail("read", msg.Err)
+			}
+			c.code = websocket.CloseAbnormalClosure
+			return
+		}
+
+		switch {
+		case msg.Opcode.IsData():
+			c.stats.received++
+			c.stats.receivedBytes += int64(len(msg.Data))
+			if c.echo {
+				c.echoReceived()
+			}
+		case msg.Opcode == websocket.OpcodePingFrame:
+			c.ws.WriteMessage(websocket.OpcodePongFrame, msg.Data)
+		}
+	}
+}
+
+// echoReceived records the round trip of the oldest pending message.
+func (c *conn) echoReceived() {
+	c.mu.Lock()
+	if len(c.pending) == 0 {
+		c.mu.Unlock()
+		return
+	}
+	sent := c.pending[0]
+	c.pending = c.pending[1:]
+	c.mu.Unlock()
+
+	c.stats.rtts = append(c.stats.rtts, time.Since(sent))
+	select {
+	case c.echoed <- struct{}{}:
+	default:
+	}
+}
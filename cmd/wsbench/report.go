@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// stats collects the results of every connection of a run.
+type stats struct {
+	mu         sync.Mutex
+	connects   []time.Duration
+	rtts       []time.Duration
+	errors     map[string]int
+	closeCodes map[websocket.CloseStatus]int
+
+	sent, received           int64
+	sentBytes, receivedBytes int64
+}
+
+func newStats() *stats {
+	return &stats{
+		errors:     make(map[string]int),
+		closeCodes: make(map[websocket.CloseStatus]int),
+	}
+}
+
+func (s *stats) connected(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connects = append(s.connects, d)
+}
+
+// add merges the counters and round trip times of a connection.
+func (s *stats) add(c *connStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rtts = append(s.rtts, c.rtts...)
+	s.sent += c.sent
+	s.sentBytes += c.sentBytes
+	s.received += c.received
+	s.receivedBytes += c.receivedBytes
+}
+
+func (s *stats) fail(op string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[errorKind(op, err)]++
+}
+
+func (s *stats) closed(code websocket.CloseStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeCodes[code]++
+}
+
+// errorKind names the kind of err, leaving out the addresses and other
+// details that would make every error its own kind.
+func errorKind(op string, err error) string {
+	var (
+		sysErr *os.SyscallError
+		opErr  *net.OpError
+		te     *websocket.TimeoutError
+	)
+	switch {
+	case errors.As(err, &te):
+		return op + ": timeout"
+	case errors.As(err, &sysErr):
+		return op + ": " + sysErr.Err.Error()
+	case errors.As(err, &opErr):
+		return op + ": " + opErr.Err.Error()
+	}
+	return op + ": " + err.Error()
+}
+
+// connStats are the counters of a single connection, merged into stats once
+// it ends.
+type connStats struct {
+	rtts                     []time.Duration
+	sent, received           int64
+	sentBytes, receivedBytes int64
+}
+
+// latency summarizes latencies, in milliseconds.
+type latency struct {
+	Count int     `json:"count"`
+	Min   float64 `json:"min_ms"`
+	Mean  float64 `json:"mean_ms"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	P999  float64 `json:"p999_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+func summarize(samples []time.Duration) latency {
+	if len(samples) == 0 {
+		return latency{}
+	}
+
+	slices.Sort(samples)
+
+	var sum time.Duration
+	for _, d := range samples {
+		sum += d
+	}
+
+	return latency{
+		Count: len(samples),
+		Min:   ms(samples[0]),
+		Mean:  ms(sum / time.Duration(len(samples))),
+		P50:   ms(percentile(samples, 0.50)),
+		P90:   ms(percentile(samples, 0.90)),
+		P99:   ms(percentile(samples, 0.99)),
+		P999:  ms(percentile(samples, 0.999)),
+		Max:   ms(samples[len(samples)-1]),
+	}
+}
+
+// percentile returns the nearest rank percentile p of the sorted samples.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(i, 0)]
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// traffic counts the messages sent or received, and their rate over the
+// run.
+type traffic struct {
+	Messages       int64   `json:"messages"`
+	Bytes          int64   `json:"bytes"`
+	MessagesPerSec float64 `json:"messages_per_sec"`
+	BytesPerSec    float64 `json:"bytes_per_sec"`
+}
+
+func newTraffic(messages, bytes int64, elapsed time.Duration) traffic {
+	t := traffic{Messages: messages, Bytes: bytes}
+	if secs := elapsed.Seconds(); secs > 0 {
+		t.MessagesPerSec = float64(messages) / secs
+		t.BytesPerSec = float64(bytes) / secs
+	}
+	return t
+}
+
+// report is the outcome of a run, printed as text or JSON.
+type report struct {
+	URL         string  `json:"url"`
+	Mode        string  `json:"mode"`
+	Connections int     `json:"connections"`
+	Connected   int     `json:"connected"`
+	Size        int     `json:"size"`
+	Rate        float64 `json:"rate"`
+	Duration    float64 `json:"duration_sec"`
+
+	Connect latency  `json:"connect_latency"`
+	RTT     *latency `json:"rtt,omitempty"`
+
+	Sent     traffic `json:"sent"`
+	Received traffic `json:"received"`
+
+	// Errors and CloseCodes count the connections by how they failed and
+	// by the close status they ended with.
+	Errors     map[string]int `json:"errors"`
+	CloseCodes map[string]int `json:"close_codes"`
+}
+
+func (s *stats) report(cfg *config, elapsed time.Duration) *report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &report{
+		URL:         cfg.url,
+		Mode:        cfg.mode,
+		Connections: cfg.conns,
+		Connected:   len(s.connects),
+		Size:        cfg.size,
+		Rate:        cfg.rate,
+		Duration:    elapsed.Seconds(),
+		Connect:     summarize(s.connects),
+		Sent:        newTraffic(s.sent, s.sentBytes, elapsed),
+		Received:    newTraffic(s.received, s.receivedBytes, elapsed),
+		Errors:      s.errors,
+		CloseCodes:  make(map[string]int, len(s.closeCodes)),
+	}
+
+	if cfg.mode == modeEcho {
+		rtt := summarize(s.rtts)
+		r.RTT = &rtt
+	}
+
+	for code, n := range s.closeCodes {
+		r.CloseCodes[strconv.Itoa(int(code))] = n
+	}
+	return r
+}
+
+func (r *report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func (r *report) writeText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "target\t%s, %s mode, %d bytes at %s\n", r.URL, r.Mode, r.Size, rateText(r.Rate))
+	fmt.Fprintf(tw, "connections\t%d of %d connected\n", r.Connected, r.Connections)
+	fmt.Fprintf(tw, "duration\t%.2fs\n", r.Duration)
+	fmt.Fprintf(tw, "connect\t%s\n", r.Connect.text())
+	if r.RTT != nil {
+		fmt.Fprintf(tw, "rtt\t%s\n", r.RTT.text())
+	}
+	fmt.Fprintf(tw, "sent\t%s\n", r.Sent.text())
+	fmt.Fprintf(tw, "received\t%s\n", r.Received.text())
+
+	codes := make([]int, 0, len(r.CloseCodes))
+	for code := range r.CloseCodes {
+		n, _ := strconv.Atoi(code)
+		codes = append(codes, n)
+	}
+	slices.Sort(codes)
+	for i, code := range codes {
+		label := ""
+		if i == 0 {
+			label = "close codes"
+		}
+		status := websocket.CloseStatus(code)
+		fmt.Fprintf(tw, "%s\t%d %s: %d\n", label, code, status, r.CloseCodes[strconv.Itoa(code)])
+	}
+
+	kinds := make([]string, 0, len(r.Errors))
+	for kind := range r.Errors {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	if len(kinds) == 0 {
+		fmt.Fprintf(tw, "errors\tnone\n")
+	}
+	for i, kind := range kinds {
+		label := ""
+		if i == 0 {
+			label = "errors"
+		}
+		fmt.Fprintf(tw, "%s\t%s: %d\n", label, kind, r.Errors[kind])
+	}
+
+	return tw.Flush()
+}
+
+func (l latency) text() string {
+	if l.Count == 0 {
+		return "no samples"
+	}
+	return fmt.Sprintf("n=%d min=%.2fms mean=%.2fms p50=%.2fms p90=%.2fms p99=%.2fms p999=%.2fms max=%.2fms",
+		l.Count, l.Min, l.Mean, l.P50, l.P90, l.P99, l.P999, l.Max)
+}
+
+func (t traffic) text() string {
+	return fmt.Sprintf("%d messages, %d bytes (%.1f msg/s, %.1f KiB/s)", t.Messages, t.Bytes, t.MessagesPerSec, t.BytesPerSec/1024)
+}
+
+func rateText(rate float64) string {
+	if rate <= 0 {
+		return "full speed"
+	}
+	return fmt.Sprintf("%g msg/s per connection", rate)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+func TestSummarize(t *testing.T) {
+	samples := make([]time.Duration, 1000)
+	for i := range samples {
+		samples[i] = time.Duration(i+1) * time.Millisecond
+	}
+	rand.Shuffle(len(samples), func(i, j int) { samples[i], samples[j] = samples[j], samples[i] })
+
+	for _, c := range []struct {
+		name    string
+		samples []time.Duration
+		expect  latency
+	}{
+		{"empty", nil, latency{}},
+		{"single", []time.Duration{3 * time.Millisecond}, latency{
+			Count: 1, Min: 3, Mean: 3, P50: 3, P90: 3, P99: 3, P999: 3, Max: 3,
+		}},
+		{"1..1000", samples, latency{
+			Count: 1000, Min: 1, Mean: 500.5, P50: 500, P90: 900, P99: 990, P999: 999, Max: 1000,
+		}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if l := summarize(c.samples); l != c.expect {
+				t.Fatalf("expect %+v found %+v", c.expect, l)
+			}
+		})
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{10, 20, 30, 40}
+
+	for _, c := range []struct {
+		p      float64
+		expect time.Duration
+	}{
+		{0, 10},
+		{0.25, 10},
+		{0.26, 20},
+		{0.5, 20},
+		{0.75, 30},
+		{0.999, 40},
+		{1, 40},
+	} {
+		if d := percentile(sorted, c.p); d != c.expect {
+			t.Errorf("p%g: expect %d found %d", c.p*100, c.expect, d)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	s := newStats()
+	s.connected(2 * time.Millisecond)
+	s.connected(4 * time.Millisecond)
+	s.add(&connStats{rtts: []time.Duration{time.Millisecond}, sent: 1, sentBytes: 16, received: 1, receivedBytes: 16})
+	s.closed(websocket.CloseNormalClosure)
+	s.closed(websocket.CloseGoingAway)
+	s.fail("dial", &websocket.TimeoutError{})
+
+	cfg := &config{url: "ws://localhost/echo", mode: modeEcho, conns: 3, size: 16, rate: 10}
+	r := s.report(cfg, 2*time.Second)
+
+	var buf bytes.Buffer
+	if err := r.writeJSON(&buf); err != nil {
+		t.Fatalf("writeJSON: %v", err)
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &fields); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	for _, name := range []string{
+		"url", "mode", "connections", "connected", "size", "rate", "duration_sec",
+		"connect_latency", "rtt", "sent", "received", "errors", "close_codes",
+	} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("expect the field %q in %s", name, buf.Bytes())
+		}
+	}
+
+	connect := fields["connect_latency"].(map[string]any)
+	for _, name := range []string{"count", "min_ms", "mean_ms", "p50_ms", "p90_ms", "p99_ms", "p999_ms", "max_ms"} {
+		if _, ok := connect[name]; !ok {
+			t.Errorf("expect the latency field %q in %v", name, connect)
+		}
+	}
+
+	var decoded report
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(&decoded, r) {
+		t.Fatalf("expect %+v found %+v", r, &decoded)
+	}
+
+	if decoded.Connected != 2 || decoded.Connect.P50 != 2 || decoded.Sent.MessagesPerSec != 0.5 {
+		t.Fatalf("unexpected report %+v", decoded)
+	}
+	if decoded.CloseCodes["1000"] != 1 || decoded.CloseCodes["1001"] != 1 || decoded.Errors["dial: timeout"] != 1 {
+		t.Fatalf("expect the breakdowns by close code and error found %v and %v", decoded.CloseCodes, decoded.Errors)
+	}
+
+	buf.Reset()
+	if err := r.writeText(&buf); err != nil {
+		t.Fatalf("writeText: %v", err)
+	}
+	for _, line := range []string{"p999=", "2 of 3 connected", "dial: timeout: 1", "1001 Going Away: 1"} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("expect %q in the text report:\n%s", line, buf.String())
+		}
+	}
+}
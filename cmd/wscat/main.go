@@ -0,0 +1,332 @@
+// Command wscat is an interactive WebSocket client.
+//
+// Every line read from stdin is sent as a message and every frame received
+// is printed with a timestamp:
+//
+//	wscat -c ws://localhost:8080/chat -H "Authorization: Bearer token" -s chat
+//
+// Lines are sent as text messages by default. With -input binary they are
+// sent as binary messages, with -input hex or -input base64 they are decoded
+// first, so arbitrary bytes can be typed. With -slash, the lines /ping,
+// /pong and /close [code [reason]] send control frames.
+//
+// In scripts, send messages with -x, print what arrives within -wait and
+// close the connection:
+//
+//	wscat -c ws://localhost:8080/ -x '{"op":"status"}' -wait 1s
+//
+// With -record, everything sent and received is written to a JSON Lines
+// recording that wsreplay can play back against the server:
+//
+//	wscat -c ws://localhost:8080/ -record session.jsonl
+//
+// The exit status reflects the close status received from the server:
+//
+//	0       1000 Normal Closure
+//	11-25   1001-1015, e.g. 16 when the connection dropped without a close frame
+//	30      3000-3999, registered
+//	40      4000-4999, private use
+//	1       any other failure, e.g. the handshake was rejected
+//	2       invalid usage
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prafitradimas/websocket/internal/cliflag"
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	var (
+		rawurl       = flag.String("c", "", "ws://, wss://, ws+unix:// or wss+unix:// URL to connect to")
+		input        = flag.String("input", "text", "how to send lines: text, binary, hex or base64")
+		output       = flag.String("output", "hex", "how to print binary messages: hex, base64 or text")
+		wait         = flag.Duration("wait", 0, "with -x, how long to wait for messages before closing")
+		slash        = flag.Bool("slash", false, "enable the /ping, /pong and /close commands")
+		insecure     = flag.Bool("insecure", false, "do not verify the TLS certificate of the server")
+		record       = flag.String("record", "", "write the messages sent and received to this JSON Lines file")
+		header       = cliflag.Header{}
+		subprotocols cliflag.List
+		execs        cliflag.List
+	)
+	flag.Var(header, "H", "header to send with the handshake, as \"Name: value\" (repeatable)")
+	flag.Var(&subprotocols, "s", "subprotocol to offer (repeatable)")
+	flag.Var(&execs, "x", "send this message and exit (repeatable)")
+	flag.Parse()
+
+	if *rawurl == "" && flag.NArg() == 1 {
+		*rawurl = flag.Arg(0)
+	}
+
+	encode, ok := encoders[*input]
+	if *rawurl == "" || !ok || printers[*output] == nil {
+		flag.Usage()
+		return 2
+	}
+
+	u, err := url.Parse(*rawurl)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client := &websocket.WebSocketClient{Subprotocols: subprotocols}
+	if *insecure {
+		client.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	var recording *os.File
+	if *record != "" {
+		if recording, err = os.Create(*record); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer recording.Close()
+	}
+
+	ws, err := client.DialWithContext(ctx, u, http.Header(header))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer ws.Close()
+
+	if recording != nil {
+		recorder := websocket.NewRecorder(ws, recording)
+		defer func() {
+			if err := recorder.Err(); err != nil {
+				fmt.Fprintf(os.Stderr, "recording: %v\n", err)
+			}
+		}()
+		ws = recorder
+	}
+
+	out := &printer{w: os.Stdout, binary: printers[*output]}
+	if p := ws.Subprotocol(); p != "" {
+		out.event("connected to %s, subprotocol %s", *rawurl, p)
+	} else {
+		out.event("connected to %s", *rawurl)
+	}
+
+	closed := make(chan websocket.CloseStatus, 1)
+	go func() { closed <- readLoop(ws, out) }()
+
+	send := func(line string) error {
+		if *slash && strings.HasPrefix(line, "/") {
+			return command(ws, out, line)
+		}
+
+		opc, data, err := encode(line)
+		if err != nil {
+			out.event("! %v", err)
+			return nil
+		}
+		return ws.WriteMessage(opc, data)
+	}
+
+	if len(execs) > 0 {
+		for _, line := range execs {
+			if err := send(line); err != nil {
+				out.event("! %v", err)
+				return 1
+			}
+		}
+
+		select {
+		case status := <-closed:
+			return exitCode(status)
+		case <-time.After(*wait):
+		case <-ctx.Done():
+		}
+	} else {
+		lines := make(chan string)
+		go scanLines(os.Stdin, lines)
+
+	interactive:
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok {
+					break interactive
+				}
+				if err := send(line); err != nil && !errors.Is(err, websocket.ErrCloseSent) {
+					out.event("! %v", err)
+				}
+			case status := <-closed:
+				return exitCode(status)
+			case <-ctx.Done():
+				break interactive
+			}
+		}
+	}
+
+	if err := ws.WriteCloseMessage(websocket.CloseNormalClosure, nil); err == nil {
+		out.event("> close %d", websocket.CloseNormalClosure)
+	}
+
+	select {
+	case status := <-closed:
+		return exitCode(status)
+	case <-time.After(websocket.CloseHandshakeTimeout):
+		out.event("! no answer to the close frame")
+		return exitCode(websocket.CloseAbnormalClosure)
+	}
+}
+
+func scanLines(r io.Reader, lines chan<- string) {
+	defer close(lines)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for scanner.Scan() {
+		lines <- scanner.Text()
+	}
+}
+
+// readLoop prints every frame read from ws, answers pings, and returns the
+// close status of the connection once it ends.
+func readLoop(ws websocket.WebSocket, out *printer) websocket.CloseStatus {
+	for {
+		msg := ws.ReadMessage()
+		if msg.Err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(msg.Err, &closeErr) {
+				out.event("< close %d (%s) %q", closeErr.Code, closeErr.Code, closeErr.Text)
+				return closeErr.Code
+			}
+
+			out.event("! %v", msg.Err)
+			return websocket.CloseAbnormalClosure
+		}
+
+		switch msg.Opcode {
+		case websocket.OpcodeTextFrame:
+			out.event("< %s", msg.Data)
+		case websocket.OpcodeBinaryFrame:
+			out.event("< binary %s", out.binary(msg.Data))
+		case websocket.OpcodePingFrame:
+			out.event("< ping %q", msg.Data)
+			if err := ws.WriteMessage(websocket.OpcodePongFrame, msg.Data); err == nil {
+				out.event("> pong %q", msg.Data)
+			}
+		case websocket.OpcodePongFrame:
+			out.event("< pong %q", msg.Data)
+		case websocket.OpcodeCloseFrame:
+			// The close status is reported by the next read.
+		}
+	}
+}
+
+// command runs a slash command.
+func command(ws websocket.WebSocket, out *printer, line string) error {
+	name, arg, _ := strings.Cut(line, " ")
+	switch name {
+	case "/ping", "/pong":
+		opc := websocket.OpcodePingFrame
+		if name == "/pong" {
+			opc = websocket.OpcodePongFrame
+		}
+		if err := ws.WriteMessage(opc, []byte(arg)); err != nil {
+			return err
+		}
+		out.event("> %s %q", name[1:], arg)
+	case "/close":
+		status := websocket.CloseNormalClosure
+		code, reason, _ := strings.Cut(arg, " ")
+		if code != "" {
+			n, err := strconv.Atoi(code)
+			if err != nil {
+				out.event("! invalid close code %q", code)
+				return nil
+			}
+			status = websocket.CloseStatus(n)
+		}
+		if err := ws.WriteCloseMessage(status, []byte(reason)); err != nil {
+			return err
+		}
+		out.event("> close %d %q", status, reason)
+	default:
+		out.event("! unknown command %s, expect /ping, /pong or /close", name)
+	}
+	return nil
+}
+
+// encoders turn an input line into a message for each -input mode.
+var encoders = map[string]func(line string) (websocket.Opcode, []byte, error){
+	"text": func(line string) (websocket.Opcode, []byte, error) {
+		return websocket.OpcodeTextFrame, []byte(line), nil
+	},
+	"binary": func(line string) (websocket.Opcode, []byte, error) {
+		return websocket.OpcodeBinaryFrame, []byte(line), nil
+	},
+	"hex": func(line string) (websocket.Opcode, []byte, error) {
+		data, err := hex.DecodeString(strings.Join(strings.Fields(line), ""))
+		return websocket.OpcodeBinaryFrame, data, err
+	},
+	"base64": func(line string) (websocket.Opcode, []byte, error) {
+		data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(line))
+		return websocket.OpcodeBinaryFrame, data, err
+	},
+}
+
+// printers format a binary message for each -output mode.
+var printers = map[string]func(data []byte) string{
+	"hex":    hex.EncodeToString,
+	"base64": base64.StdEncoding.EncodeToString,
+	"text":   func(data []byte) string { return string(data) },
+}
+
+// printer writes timestamped lines, from the reader and the sender alike.
+type printer struct {
+	mu     sync.Mutex
+	w      io.Writer
+	binary func([]byte) string
+}
+
+func (p *printer) event(format string, args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fmt.Fprintf(p.w, "%s %s\n", time.Now().Format("15:04:05.000"), fmt.Sprintf(format, args...))
+}
+
+// exitCode maps the close status of the connection to the exit status of
+// the command, as listed in the package documentation.
+func exitCode(status websocket.CloseStatus) int {
+	switch {
+	case status == websocket.CloseNormalClosure:
+		return 0
+	case status > websocket.CloseNormalClosure && status <= websocket.CloseTLSHandshake:
+		return 10 + int(status-websocket.CloseNormalClosure)
+	case status.IsRegistered():
+		return 30
+	case status.IsPrivate():
+		return 40
+	default:
+		return 1
+	}
+}
@@ -0,0 +1,141 @@
+// Command wsconformance runs the RFC 6455 conformance suite.
+//
+// Test a server that echoes every message:
+//
+//	wsconformance -url ws://localhost:8080/echo
+//
+// Serve the suite to an external client, which should connect to
+// /runCase?case=ID for every ID listed by /cases and echo what it receives:
+//
+//	wsconformance -listen :9001
+//
+// Test the server and client of this module against each other:
+//
+//	wsconformance -self
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+	"github.com/prafitradimas/websocket/pkg/websocket/conformance"
+)
+
+func main() {
+	var (
+		target  = flag.String("url", "", "test the echo server at this ws:// or wss:// URL")
+		listen  = flag.String("listen", "", "serve the suite to external clients on this address")
+		self    = flag.Bool("self", false, "test this module's server and client")
+		include = flag.String("cases", "", "comma separated case patterns to run, e.g. 1.*,2.3")
+		exclude = flag.String("exclude", "", "comma separated case patterns to skip")
+		timeout = flag.Duration("timeout", time.Second, "how long to wait for the peer to react")
+		report  = flag.String("report", "", "write the reports to this file as a JSON array")
+	)
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cases := conformance.Select(conformance.Cases(), splitList(*include), splitList(*exclude))
+	opts := conformance.Options{Timeout: *timeout}
+
+	var (
+		reports []*conformance.Report
+		err     error
+	)
+	switch {
+	case *self:
+		reports, err = runSelf(ctx, cases, opts)
+	case *target != "":
+		reports = append(reports, conformance.RunServer(ctx, *target, cases, opts))
+	case *listen != "":
+		err = serve(ctx, *listen, cases, opts)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	failed := 0
+	for _, r := range reports {
+		r.WriteText(os.Stdout)
+		fmt.Println()
+		failed += r.Failed()
+	}
+
+	if *report != "" {
+		if err := writeReports(*report, reports); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+func splitList(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func runSelf(ctx context.Context, cases []conformance.Case, opts conformance.Options) ([]*conformance.Report, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{Handler: conformance.EchoHandler(&websocket.WebSocketServer{})}
+	go server.Serve(ln)
+	defer server.Close()
+
+	serverReport := conformance.RunServer(ctx, "ws://"+ln.Addr().String(), cases, opts)
+
+	clientReport, err := conformance.RunClient(ctx, cases, opts, conformance.EchoClient)
+	if err != nil {
+		return nil, err
+	}
+	return []*conformance.Report{serverReport, clientReport}, nil
+}
+
+func serve(ctx context.Context, addr string, cases []conformance.Case, opts conformance.Options) error {
+	server := &http.Server{Addr: addr, Handler: conformance.NewFuzzingServer(cases, opts)}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	log.Printf("serving %d cases on %s", len(cases), addr)
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func writeReports(name string, reports []*conformance.Report) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := conformance.WriteReportsJSON(f, reports); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,295 @@
+// Command wsecho is a WebSocket server for local testing that behaves
+// predictably. It logs every message and control frame it receives.
+//
+// The -mode flag selects how it answers:
+//
+//	echo          send every message back
+//	broadcast     send every message to all connected clients
+//	delay         send every message back after -delay
+//	random-close  echo, and close every connection after a random time up
+//	              to -close-after with a random code from -codes
+//	script        answer as described by the JSON file given with -script
+//
+// For example:
+//
+//	wsecho -listen :8080 -mode delay -delay 500ms
+//	wsecho -listen :8443 -cert cert.pem -key key.pem -s chat,superchat
+//	wsecho -mode script -script replies.json -origin http://localhost:3000
+//
+// A script lists actions to run on connect and rules tried in order against
+// every data message, the first one whose regular expression matches runs.
+// Each action does one thing, send, binary, echo, delay or close:
+//
+//	{
+//	  "onConnect": [{"send": "welcome"}],
+//	  "rules": [
+//	    {"match": "^ping$", "actions": [{"send": "pong"}]},
+//	    {"match": "^slow", "actions": [{"delay": "1s"}, {"echo": true}]},
+//	    {"match": "^bye$", "actions": [{"close": 4000, "reason": "bye"}]}
+//	  ]
+//	}
+//
+// The actions run apart from the reading of the connection, so pings are
+// still answered during a delay, and after the actions of the messages
+// received before.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+func main() {
+	var (
+		listen       = flag.String("listen", ":8080", "address to listen on")
+		mode         = flag.String("mode", "echo", "echo, broadcast, delay, random-close or script")
+		delay        = flag.Duration("delay", time.Second, "how long to hold messages in delay mode")
+		closeAfter   = flag.Duration("close-after", 5*time.Second, "longest time a connection stays open in random-close mode")
+		codes        = flag.String("codes", "1000,1001,1003,1008,1009,1011,1012,1013,1014,4000", "comma separated close codes used in random-close mode")
+		scriptFile   = flag.String("script", "", "JSON file of responses for script mode")
+		cert         = flag.String("cert", "", "TLS certificate file, serves wss:// with -key")
+		key          = flag.String("key", "", "TLS key file")
+		subprotocols = flag.String("s", "", "comma separated subprotocols to accept, in order of preference")
+		origins      = flag.String("origin", "", "comma separated origins allowed to connect, any when empty")
+	)
+	flag.Parse()
+
+	h := &handler{
+		server:     &websocket.WebSocketServer{Subprotocols: splitList(*subprotocols)},
+		origins:    splitList(*origins),
+		delay:      *delay,
+		closeAfter: *closeAfter,
+		clients:    map[*client]struct{}{},
+	}
+
+	switch *mode {
+	case "echo":
+		h.onMessage = h.echo
+	case "broadcast":
+		h.onMessage = h.broadcast
+	case "delay":
+		h.onMessage = h.delayed
+	case "random-close":
+		closeCodes, err := parseCodes(*codes)
+		if err != nil {
+			log.Fatal(err)
+		}
+		h.closeCodes = closeCodes
+		h.onConnect = h.closeRandomly
+		h.onMessage = h.echo
+	case "script":
+		s, err := loadScript(*scriptFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		h.onConnect = s.connect
+		h.onMessage = s.answer
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	log.Printf("serving %s mode on %s", *mode, *listen)
+
+	var err error
+	if *cert != "" {
+		err = http.ListenAndServeTLS(*listen, *cert, *key, h)
+	} else {
+		err = http.ListenAndServe(*listen, h)
+	}
+	log.Fatal(err)
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func parseCodes(s string) ([]websocket.CloseStatus, error) {
+	var codes []websocket.CloseStatus
+	for _, v := range splitList(s) {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid close code %q", v)
+		}
+
+		code := websocket.CloseStatus(n)
+		if !code.IsValidOnWire() {
+			return nil, fmt.Errorf("close code %d cannot be sent", code)
+		}
+		codes = append(codes, code)
+	}
+
+	if len(codes) == 0 {
+		return nil, fmt.Errorf("no close codes given")
+	}
+	return codes, nil
+}
+
+// client is one connected WebSocket.
+type client struct {
+	id uint64
+	ws websocket.WebSocket
+
+	// scripted is closed once the script actions last started on the
+	// connection are done, only used from the goroutine reading it.
+	scripted chan struct{}
+}
+
+func (c *client) logf(format string, args ...any) {
+	log.Printf("conn %d %s: %s", c.id, c.ws.RemoteAddr(), fmt.Sprintf(format, args...))
+}
+
+func (c *client) send(opc websocket.Opcode, data []byte) {
+	if err := c.ws.WriteMessage(opc, data); err != nil {
+		c.logf("send %s: %v", opc, err)
+		return
+	}
+	c.logf("sent %s", describe(opc, data))
+}
+
+func (c *client) close(code websocket.CloseStatus, reason string) {
+	if err := c.ws.WriteCloseMessage(code, []byte(reason)); err != nil {
+		c.logf("close: %v", err)
+		return
+	}
+	c.logf("sent close %d (%s) %q", code, code, reason)
+}
+
+type handler struct {
+	server  *websocket.WebSocketServer
+	origins []string
+
+	delay      time.Duration
+	closeAfter time.Duration
+	closeCodes []websocket.CloseStatus
+
+	onConnect func(c *client)
+	onMessage func(c *client, opc websocket.Opcode, data []byte)
+
+	nextID  atomic.Uint64
+	mu      sync.Mutex
+	clients map[*client]struct{}
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if len(h.origins) > 0 && !slices.Contains(h.origins, origin) {
+		log.Printf("rejected %s: origin %q is not allowed", r.RemoteAddr, origin)
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	ws, err := h.server.Upgrade(w, r)
+	if err != nil {
+		log.Printf("rejected %s: %v", r.RemoteAddr, err)
+		return
+	}
+
+	c := &client{id: h.nextID.Add(1), ws: ws}
+	c.logf("connected to %s, origin %q, subprotocol %q", r.URL.Path, origin, ws.Subprotocol())
+
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+
+	defer func() {
+		h.mu.Lock()
+		delete(h.clients, c)
+		h.mu.Unlock()
+
+		ws.Close()
+	}()
+
+	if h.onConnect != nil {
+		h.onConnect(c)
+	}
+	h.serve(c)
+}
+
+// serve reads from c until the connection ends, logging every frame.
+func (h *handler) serve(c *client) {
+	for {
+		msg := c.ws.ReadMessage()
+		if msg.Err != nil {
+			if websocket.IsCloseError(msg.Err) {
+				c.logf("closed: %v", msg.Err)
+			} else {
+				c.logf("read: %v", msg.Err)
+			}
+			return
+		}
+
+		c.logf("recv %s", describe(msg.Opcode, msg.Data))
+
+		switch msg.Opcode {
+		case websocket.OpcodePingFrame:
+			c.send(websocket.OpcodePongFrame, msg.Data)
+		case websocket.OpcodeTextFrame, websocket.OpcodeBinaryFrame:
+			h.onMessage(c, msg.Opcode, msg.Data)
+		}
+	}
+}
+
+func (h *handler) echo(c *client, opc websocket.Opcode, data []byte) {
+	c.send(opc, data)
+}
+
+func (h *handler) broadcast(_ *client, opc websocket.Opcode, data []byte) {
+	h.mu.Lock()
+	clients := make([]*client, 0, len(h.clients))
+	for c := range h.clients {
+		clients = append(clients, c)
+	}
+	h.mu.Unlock()
+
+	for _, c := range clients {
+		c.send(opc, data)
+	}
+}
+
+func (h *handler) delayed(c *client, opc websocket.Opcode, data []byte) {
+	time.AfterFunc(h.delay, func() { c.send(opc, data) })
+}
+
+func (h *handler) closeRandomly(c *client) {
+	after := time.Duration(rand.Int64N(int64(h.closeAfter) + 1))
+	code := h.closeCodes[rand.IntN(len(h.closeCodes))]
+
+	time.AfterFunc(after, func() { c.close(code, "random close") })
+}
+
+// describe formats a frame for the log, with at most 64 bytes of payload.
+func describe(opc websocket.Opcode, data []byte) string {
+	if opc.IsClose() && len(data) >= 2 {
+		code := websocket.CloseStatus(int(data[0])<<8 | int(data[1]))
+		return fmt.Sprintf("close %d (%s) %q", code, code, data[2:])
+	}
+
+	preview := data
+	if len(preview) > 64 {
+		preview = preview[:64]
+	}
+
+	if opc == websocket.OpcodeBinaryFrame {
+		return fmt.Sprintf("%s %d bytes % x", opc, len(data), preview)
+	}
+	return fmt.Sprintf("%s %d bytes %q", opc, len(data), preview)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// script is the content of the -script file.
+type script struct {
+	OnConnect []action `json:"onConnect"`
+	Rules     []rule   `json:"rules"`
+}
+
+type rule struct {
+	Match   string   `json:"match"`
+	Actions []action `json:"actions"`
+
+	pattern *regexp.Regexp
+}
+
+// action is one step of a response, only one of its fields is set, which
+// compileActions checks.
+type action struct {
+	// Send sends a text message, Binary a binary message given in base64.
+	Send   string `json:"send,omitempty"`
+	Binary []byte `json:"binary,omitempty"`
+
+	// Echo sends the received message back.
+	Echo bool `json:"echo,omitempty"`
+
+	// Delay waits before the next action, e.g. "500ms".
+	Delay string `json:"delay,omitempty"`
+
+	// Close closes the connection with this code and Reason.
+	Close  websocket.CloseStatus `json:"close,omitempty"`
+	Reason string                `json:"reason,omitempty"`
+
+	delay time.Duration
+}
+
+func loadScript(name string) (*script, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var s script
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if err := compileActions(s.OnConnect); err != nil {
+		return nil, fmt.Errorf("%s: onConnect: %w", name, err)
+	}
+
+	for i := range s.Rules {
+		r := &s.Rules[i]
+		if r.pattern, err = regexp.Compile(r.Match); err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %w", name, i, err)
+		}
+
+		if err := compileActions(r.Actions); err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %w", name, i, err)
+		}
+	}
+	return &s, nil
+}
+
+func compileActions(actions []action) error {
+	for i := range actions {
+		a := &actions[i]
+
+		set := 0
+		for _, ok := range []bool{a.Send != "", a.Binary != nil, a.Echo, a.Delay != "", a.Close != 0} {
+			if ok {
+				set++
+			}
+		}
+		if set > 1 {
+			return fmt.Errorf("action %d sets more than one of send, binary, echo, delay and close", i)
+		}
+
+		if a.Delay != "" {
+			d, err := time.ParseDuration(a.Delay)
+			if err != nil {
+				return fmt.Errorf("action %d: %w", i, err)
+			}
+			a.delay = d
+		}
+
+		if a.Close != 0 && !a.Close.IsValidOnWire() {
+			return fmt.Errorf("action %d: close code %d cannot be sent", i, a.Close)
+		}
+	}
+	return nil
+}
+
+// connect runs the onConnect actions.
+func (s *script) connect(c *client) {
+	s.spawn(c, s.OnConnect, nil)
+}
+
+// answer runs the first rule matching a data message.
+func (s *script) answer(c *client, opc websocket.Opcode, data []byte) {
+	for _, r := range s.Rules {
+		if r.pattern.Match(data) {
+			s.spawn(c, r.Actions, &websocket.Message{Opcode: opc, Data: data})
+			return
+		}
+	}
+	c.logf("no rule matches")
+}
+
+// spawn runs actions away from the goroutine reading c, so that a delay does
+// not keep pings from being answered, once the actions spawned before on c
+// are done. A delay still holds up the answers to the messages that follow.
+func (s *script) spawn(c *client, actions []action, msg *websocket.Message) {
+	prev, done := c.scripted, make(chan struct{})
+	c.scripted = done
+
+	go func() {
+		defer close(done)
+		if prev != nil {
+			<-prev
+		}
+		s.run(c, actions, msg)
+	}()
+}
+
+// run performs actions in order. msg is the message being answered, nil on
+// connect.
+func (s *script) run(c *client, actions []action, msg *websocket.Message) {
+	for _, a := range actions {
+		switch {
+		case a.delay > 0:
+			time.Sleep(a.delay)
+		case a.Send != "":
+			c.send(websocket.OpcodeTextFrame, []byte(a.Send))
+		case a.Binary != nil:
+			c.send(websocket.OpcodeBinaryFrame, a.Binary)
+		case a.Echo && msg != nil:
+			c.send(msg.Opcode, msg.Data)
+		case a.Close != 0:
+			c.close(a.Close, a.Reason)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"log"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+func init() {
+	log.SetOutput(io.Discard)
+}
+
+// writeScript writes content to a script file and returns its path.
+func writeScript(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "script.json")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestLoadScript(t *testing.T) {
+	s, err := loadScript(writeScript(t, `{
+		"onConnect": [{"send": "welcome"}, {"delay": "10ms"}],
+		"rules": [{"match": "^a", "actions": [{"delay": "1.5s"}, {"close": 4000, "reason": "bye"}]}]
+	}`))
+	if err != nil {
+		t.Fatalf("loadScript: %v", err)
+	}
+
+	if len(s.OnConnect) != 2 || s.OnConnect[1].delay != 10*time.Millisecond {
+		t.Fatalf("expect the onConnect delay parsed found %+v", s.OnConnect)
+	}
+	if len(s.Rules) != 1 || !s.Rules[0].pattern.MatchString("abc") || s.Rules[0].Actions[0].delay != 1500*time.Millisecond {
+		t.Fatalf("expect the rule compiled found %+v", s.Rules)
+	}
+
+	for _, c := range []struct {
+		name, content, expect string
+	}{
+		{"invalid JSON", `{"rules": [`, "unexpected end"},
+		{"invalid regexp", `{"rules": [{"match": "^a"}, {"match": "(unclosed"}]}`, "rule 1: error parsing regexp"},
+		{"invalid delay", `{"onConnect": [{"delay": "soon"}]}`, "onConnect: action 0: time: invalid duration"},
+		{"invalid rule delay", `{"rules": [{"match": "", "actions": [{"delay": "1"}]}]}`, "rule 0: action 0: time: missing unit"},
+		{"reserved close code", `{"rules": [{"match": "", "actions": [{"close": 1005}]}]}`, "close code 1005 cannot be sent"},
+		{"unregistered close code", `{"onConnect": [{"close": 2000}]}`, "close code 2000 cannot be sent"},
+		{"delay and send", `{"rules": [{"match": "", "actions": [{"send": "a"}, {"delay": "1s", "send": "x"}]}]}`, "rule 0: action 1 sets more than one"},
+		{"echo and close", `{"onConnect": [{"echo": true, "close": 1000}]}`, "onConnect: action 0 sets more than one"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			if _, err := loadScript(writeScript(t, c.content)); err == nil || !strings.Contains(err.Error(), c.expect) {
+				t.Fatalf("expect an error with %q found %v", c.expect, err)
+			}
+		})
+	}
+
+	if _, err := loadScript(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Fatalf("expect a missing file error found %v", err)
+	}
+}
+
+func TestScriptAnswer(t *testing.T) {
+	s, err := loadScript(writeScript(t, `{
+		"onConnect": [{"send": "welcome"}],
+		"rules": [
+			{"match": "^ping$", "actions": [{"send": "pong"}]},
+			{"match": "^slow", "actions": [{"delay": "200ms"}, {"echo": true}]},
+			{"match": "^s", "actions": [{"send": "s rule"}]},
+			{"match": "^bin$", "actions": [{"binary": "AAH/"}]},
+			{"match": "^bye$", "actions": [{"close": 4000, "reason": "bye"}]}
+		]
+	}`))
+	if err != nil {
+		t.Fatalf("loadScript: %v", err)
+	}
+
+	h := &handler{
+		server:    &websocket.WebSocketServer{},
+		clients:   map[*client]struct{}{},
+		onConnect: s.connect,
+		onMessage: s.answer,
+	}
+	server := httptest.NewServer(h)
+	defer server.Close()
+
+	u, _ := url.Parse("ws" + strings.TrimPrefix(server.URL, "http"))
+	ws, err := (&websocket.WebSocketClient{}).DialWithContext(context.Background(), u, nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	expect := func(opc websocket.Opcode, payload string) {
+		t.Helper()
+
+		ws.SetReadDeadline(time.Now().Add(time.Second))
+		msg := ws.ReadMessage()
+		if msg.Err != nil || msg.Opcode != opc || string(msg.Data) != payload {
+			t.Fatalf("expect %s %q found %s %q, %v", opc, payload, msg.Opcode, msg.Data, msg.Err)
+		}
+	}
+
+	expect(websocket.OpcodeTextFrame, "welcome")
+
+	ws.WriteMessage(websocket.OpcodeTextFrame, []byte("ping"))
+	expect(websocket.OpcodeTextFrame, "pong")
+
+	// The ping is answered while the first rule matching "slow down" waits,
+	// and "sure" is answered once it is done. No rule matches "nothing".
+	ws.WriteMessage(websocket.OpcodeTextFrame, []byte("slow down"))
+	ws.WriteMessage(websocket.OpcodeTextFrame, []byte("sure"))
+	ws.WriteMessage(websocket.OpcodeTextFrame, []byte("nothing"))
+	ws.WriteMessage(websocket.OpcodePingFrame, []byte("still there?"))
+	expect(websocket.OpcodePongFrame, "still there?")
+	expect(websocket.OpcodeTextFrame, "slow down")
+	expect(websocket.OpcodeTextFrame, "s rule")
+
+	ws.WriteMessage(websocket.OpcodeTextFrame, []byte("bin"))
+	expect(websocket.OpcodeBinaryFrame, "\x00\x01\xff")
+
+	ws.WriteMessage(websocket.OpcodeTextFrame, []byte("bye"))
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	msg := ws.ReadMessage()
+	if msg.Opcode != websocket.OpcodeCloseFrame || len(msg.Data) < 2 ||
+		binary.BigEndian.Uint16(msg.Data) != 4000 || string(msg.Data[2:]) != "bye" {
+		t.Fatalf("expect close 4000 %q found %s %q, %v", "bye", msg.Opcode, msg.Data, msg.Err)
+	}
+}
@@ -0,0 +1,118 @@
+// Command wsproxy bridges WebSocket clients to a TCP service, in the way
+// websockify does.
+//
+// Accept WebSocket connections on :6080 and pipe each one to a VNC server:
+//
+//	wsproxy -listen :6080 -target localhost:5900
+//
+// Accept TCP connections on :5900 and pipe each one to a WebSocket
+// endpoint, the reverse of the above:
+//
+//	wsproxy -reverse -listen :5900 -url ws://gateway.example.com:6080/
+//
+// Both directions speak the websockify "binary" and "base64" subprotocols.
+// -cert and -key serve wss:// in the first direction only, -reverse rejects
+// them.
+// On interrupt, every bridge is closed with 1001 Going Away and wsproxy
+// waits up to -shutdown-timeout for them to end.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket/tcpbridge"
+)
+
+func main() {
+	var (
+		listen      = flag.String("listen", ":6080", "address to accept connections on")
+		target      = flag.String("target", "", "TCP host:port to pipe WebSocket connections to")
+		reverse     = flag.Bool("reverse", false, "accept TCP connections and pipe them to -url")
+		rawurl      = flag.String("url", "", "ws:// or wss:// endpoint to pipe TCP connections to, with -reverse")
+		subprotocol = flag.String("subprotocol", "", "comma separated subprotocols to offer: binary, base64; only the first with -reverse")
+		maxConns    = flag.Int("max-conns", 0, "maximum number of connections at once, 0 for no limit")
+		cert        = flag.String("cert", "", "TLS certificate file, serves wss:// with -key; not with -reverse")
+		key         = flag.String("key", "", "TLS key file")
+		shutdown    = flag.Duration("shutdown-timeout", 10*time.Second, "how long to wait for connections to close on interrupt")
+	)
+	flag.Parse()
+
+	// -reverse accepts plain TCP, there is no WebSocket server to serve TLS.
+	if *reverse && (*cert != "" || *key != "") {
+		fmt.Fprintln(os.Stderr, "-cert and -key cannot be used with -reverse")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var (
+		serve func() error
+		drain func(context.Context) error
+	)
+	switch {
+	case *reverse && *rawurl != "":
+		s := &tcpbridge.ReverseServer{URL: *rawurl, MaxConns: *maxConns}
+		if *subprotocol != "" {
+			s.Subprotocol = strings.Split(*subprotocol, ",")[0]
+		}
+		log.Printf("piping tcp://%s to %s", ln.Addr(), s.URL)
+
+		serve = func() error { return s.Serve(ln) }
+		drain = s.Shutdown
+	case !*reverse && *target != "":
+		s := &tcpbridge.Server{Target: *target, MaxConns: *maxConns}
+		if *subprotocol != "" {
+			s.Subprotocols = strings.Split(*subprotocol, ",")
+		}
+		server := &http.Server{Handler: s}
+		log.Printf("piping ws://%s to tcp://%s", ln.Addr(), s.Target)
+
+		serve = func() error {
+			if *cert != "" {
+				return server.ServeTLS(ln, *cert, *key)
+			}
+			return server.Serve(ln)
+		}
+		drain = func(ctx context.Context) error {
+			return errors.Join(server.Shutdown(ctx), s.Shutdown(ctx))
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- serve() }()
+
+	select {
+	case err := <-errc:
+		log.Fatal(err)
+	case <-ctx.Done():
+	}
+
+	log.Printf("shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdown)
+	defer cancel()
+
+	if err := drain(ctx); err != nil {
+		log.Fatal(err)
+	}
+}
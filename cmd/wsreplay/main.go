@@ -0,0 +1,274 @@
+// Command wsreplay plays a recording back against a server and diffs the
+// responses against the recorded ones.
+//
+// Recordings are JSON Lines of websocket.Record, as written by
+// websocket.NewRecorder or wscat -record, on the client side:
+//
+//	wscat -c ws://localhost:8080/ -record session.jsonl
+//	wsreplay -c ws://localhost:8080/ session.jsonl
+//
+// The records are replayed in order: sent records are sent, and every
+// received record waits up to -timeout for the next message, which must
+// have the same opcode and payload. With -timing original the messages are
+// sent at the offsets they were recorded at, with -timing fast as soon as
+// the previous response arrived. Use -flip for recordings made on the
+// server side.
+//
+// Pings and pongs depend on timing more than on the conversation, so they
+// are neither sent nor compared by default, and the pings of the server
+// are answered; -ignore "" replays them as well.
+//
+// The exit status is 0 when every response matches, 1 when some differ or
+// the replay fails, and 2 on invalid usage.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prafitradimas/websocket/internal/cliflag"
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+func main() {
+	os.Exit(run())
+}
+
+func run() int {
+	var (
+		rawurl       = flag.String("c", "", "ws://, wss://, ws+unix:// or wss+unix:// URL to replay against")
+		timing       = flag.String("timing", "original", "when to send messages: original or fast")
+		timeout      = flag.Duration("timeout", 5*time.Second, "how long to wait for each response")
+		ignore       = flag.String("ignore", "ping,pong", "comma separated opcodes neither replayed nor compared")
+		flip         = flag.Bool("flip", false, "the recording was made on the server side")
+		insecure     = flag.Bool("insecure", false, "do not verify the TLS certificate of the server")
+		header       = cliflag.Header{}
+		subprotocols cliflag.List
+	)
+	flag.Var(header, "H", "header to send with the handshake, as \"Name: value\" (repeatable)")
+	flag.Var(&subprotocols, "s", "subprotocol to offer (repeatable)")
+	flag.Parse()
+
+	if flag.NArg() != 1 || *rawurl == "" || (*timing != "original" && *timing != "fast") {
+		flag.Usage()
+		return 2
+	}
+
+	var ignored []websocket.Opcode
+	for _, name := range strings.Split(*ignore, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+
+		var opc websocket.Opcode
+		if err := opc.UnmarshalText([]byte(name)); err != nil {
+			fmt.Fprintf(os.Stderr, "-ignore %s: %v\n", name, err)
+			return 2
+		}
+		ignored = append(ignored, opc)
+	}
+
+	u, err := url.Parse(*rawurl)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	records, err := readRecords(flag.Arg(0), *flip)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	client := &websocket.WebSocketClient{Subprotocols: subprotocols}
+	if *insecure {
+		client.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	ws, err := client.DialWithContext(ctx, u, http.Header(header))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer ws.Close()
+
+	r := &replay{
+		ws:       ws,
+		out:      os.Stdout,
+		timeout:  *timeout,
+		original: *timing == "original",
+		ignored:  ignored,
+	}
+	if err := r.run(ctx, records); err != nil {
+		fmt.Fprintf(r.out, "! %v\n", err)
+		r.differ++
+	}
+
+	fmt.Fprintf(r.out, "replayed %d records: %d sent, %d received, %d differ\n", len(records), r.sent, r.received, r.differ)
+	if r.differ > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readRecords reads the recording in path. With flip, the directions of a
+// server side recording are swapped.
+func readRecords(path string, flip bool) ([]websocket.Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []websocket.Record
+	dec := json.NewDecoder(f)
+	for {
+		var rec websocket.Record
+		if err := dec.Decode(&rec); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("%s: record %d: %w", path, len(records)+1, err)
+		}
+
+		if flip {
+			switch rec.Direction {
+			case websocket.RecordSent:
+				rec.Direction = websocket.RecordReceived
+			case websocket.RecordReceived:
+				rec.Direction = websocket.RecordSent
+			}
+		}
+		records = append(records, rec)
+	}
+}
+
+// replay sends the sent records and compares the received ones, counting
+// them as it goes.
+type replay struct {
+	ws       websocket.WebSocket
+	out      io.Writer
+	timeout  time.Duration
+	original bool
+	ignored  []websocket.Opcode
+
+	sent, received, differ int
+}
+
+func (r *replay) run(ctx context.Context, records []websocket.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	start, recorded := time.Now(), records[0].Time
+	for i, rec := range records {
+		if slices.Contains(r.ignored, rec.Opcode) {
+			continue
+		}
+
+		switch rec.Direction {
+		case websocket.RecordSent:
+			if r.original {
+				select {
+				case <-time.After(time.Until(start.Add(rec.Time.Sub(recorded)))):
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+
+			if err := r.ws.WriteMessage(rec.Opcode, rec.Payload()); err != nil {
+				return fmt.Errorf("record %d: %w", i+1, err)
+			}
+			r.sent++
+		case websocket.RecordReceived:
+			msg, err := r.next()
+			if err != nil {
+				r.differ++
+				fmt.Fprintf(r.out, "record %d: expect %s found %v\n", i+1, describe(rec.Opcode, rec.Payload()), err)
+				return nil
+			}
+
+			r.received++
+			if diff := compare(rec, msg); diff != "" {
+				r.differ++
+				fmt.Fprintf(r.out, "record %d: %s\n", i+1, diff)
+			}
+		default:
+			return fmt.Errorf("record %d: unknown direction %q", i+1, rec.Direction)
+		}
+	}
+	return nil
+}
+
+// next reads the next message that is not ignored, answering the pings of
+// the server unless they are replayed.
+func (r *replay) next() (websocket.Message, error) {
+	r.ws.SetReadDeadline(time.Now().Add(r.timeout))
+	for {
+		msg := r.ws.ReadMessage()
+		if msg.Err != nil {
+			return msg, msg.Err
+		}
+
+		if !slices.Contains(r.ignored, msg.Opcode) {
+			return msg, nil
+		}
+		if msg.Opcode == websocket.OpcodePingFrame {
+			r.ws.WriteMessage(websocket.OpcodePongFrame, msg.Data)
+		}
+	}
+}
+
+// compare describes how msg differs from the recorded rec, or returns an
+// empty string when they match.
+func compare(rec websocket.Record, msg websocket.Message) string {
+	expect, found := rec.Payload(), msg.Data
+	if rec.Opcode == msg.Opcode && bytes.Equal(expect, found) {
+		return ""
+	}
+
+	diff := fmt.Sprintf("expect %s found %s", describe(rec.Opcode, expect), describe(msg.Opcode, found))
+	if rec.Opcode == msg.Opcode {
+		n := 0
+		for n < min(len(expect), len(found)) && expect[n] == found[n] {
+			n++
+		}
+		diff += fmt.Sprintf(", differ at byte %d", n)
+	}
+	return diff
+}
+
+// describe formats a message for the diff, truncating long payloads.
+func describe(opc websocket.Opcode, payload []byte) string {
+	const maxLen = 64
+
+	if opc == websocket.OpcodeCloseFrame && len(payload) >= 2 {
+		code := websocket.CloseStatus(int(payload[0])<<8 | int(payload[1]))
+		return fmt.Sprintf("%s %d %q", opc, code, payload[2:])
+	}
+
+	more := ""
+	if len(payload) > maxLen {
+		payload, more = payload[:maxLen], fmt.Sprintf("... (%d bytes)", len(payload))
+	}
+
+	if opc == websocket.OpcodeTextFrame {
+		return fmt.Sprintf("%s %q%s", opc, payload, more)
+	}
+	return fmt.Sprintf("%s %s%s", opc, hex.EncodeToString(payload), more)
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+var controlFrames = []websocket.Opcode{websocket.OpcodePingFrame, websocket.OpcodePongFrame}
+
+// newEchoServer echoes data messages and answers pings. With ping, it first
+// pings the client and sends the payload of the pongs to the returned
+// channel.
+func newEchoServer(t *testing.T, ping bool) (string, <-chan []byte) {
+	t.Helper()
+
+	pongs := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.WebSocketServer{}).Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		if ping {
+			ws.WriteMessage(websocket.OpcodePingFrame, []byte("still there?"))
+		}
+
+		for {
+			msg := ws.ReadMessage()
+			if msg.Err != nil {
+				return
+			}
+
+			switch msg.Opcode {
+			case websocket.OpcodePingFrame:
+				ws.WriteMessage(websocket.OpcodePongFrame, msg.Data)
+			case websocket.OpcodePongFrame:
+				pongs <- msg.Data
+			case websocket.OpcodeCloseFrame:
+				return
+			default:
+				ws.WriteMessage(msg.Opcode, msg.Data)
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http"), pongs
+}
+
+func dial(t *testing.T, rawurl string) websocket.WebSocket {
+	t.Helper()
+
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	ws, err := (&websocket.WebSocketClient{}).DialWithContext(context.Background(), u, nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+// writeRecords writes records as a recording and returns its path.
+func writeRecords(t *testing.T, records []websocket.Record) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, rec := range records {
+		enc.Encode(&rec)
+	}
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestReplay(t *testing.T) {
+	url, _ := newEchoServer(t, false)
+
+	var recording bytes.Buffer
+	rec := websocket.NewRecorder(dial(t, url), &recording)
+	for _, m := range []struct {
+		opcode  websocket.Opcode
+		payload string
+	}{
+		{websocket.OpcodeTextFrame, "hello"},
+		{websocket.OpcodeBinaryFrame, "\x00\x01\x02"},
+		{websocket.OpcodePingFrame, "ping"},
+	} {
+		rec.WriteMessage(m.opcode, []byte(m.payload))
+		if msg := rec.ReadMessage(); msg.Err != nil {
+			t.Fatalf("ReadMessage: %v", msg.Err)
+		}
+	}
+	rec.WriteCloseMessage(websocket.CloseNormalClosure, []byte("done"))
+	rec.ReadMessage()
+	if err := rec.Err(); err != nil {
+		t.Fatalf("recording: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "session.jsonl")
+	if err := os.WriteFile(path, recording.Bytes(), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+
+	records, err := readRecords(path, false)
+	if err != nil {
+		t.Fatalf("readRecords: %v", err)
+	}
+	if len(records) != 8 {
+		t.Fatalf("expect 8 records found %d", len(records))
+	}
+
+	var out bytes.Buffer
+	r := &replay{ws: dial(t, url), out: &out, timeout: time.Second, original: true, ignored: controlFrames}
+	if err := r.run(context.Background(), records); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if r.differ != 0 || r.sent != 3 || r.received != 3 {
+		t.Fatalf("expect 3 sent, 3 received and no difference found %d, %d and %d:\n%s", r.sent, r.received, r.differ, &out)
+	}
+
+	// The echo of the second record no longer matches from its fourth byte.
+	records[1].Text = "helLo"
+
+	out.Reset()
+	r = &replay{ws: dial(t, url), out: &out, timeout: time.Second, ignored: controlFrames}
+	if err := r.run(context.Background(), records); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if r.differ != 1 || !strings.Contains(out.String(), "record 2: ") || !strings.Contains(out.String(), "differ at byte 3") {
+		t.Fatalf("expect record 2 to differ at byte 3 found %d differences:\n%s", r.differ, &out)
+	}
+}
+
+func TestReplayTiming(t *testing.T) {
+	url, _ := newEchoServer(t, false)
+
+	start := time.Now()
+	records := []websocket.Record{
+		{Direction: websocket.RecordSent, Time: start, Opcode: websocket.OpcodeTextFrame, Text: "a"},
+		{Direction: websocket.RecordReceived, Time: start, Opcode: websocket.OpcodeTextFrame, Text: "a"},
+		{Direction: websocket.RecordSent, Time: start.Add(200 * time.Millisecond), Opcode: websocket.OpcodeTextFrame, Text: "b"},
+		{Direction: websocket.RecordReceived, Time: start.Add(200 * time.Millisecond), Opcode: websocket.OpcodeTextFrame, Text: "b"},
+	}
+
+	for _, original := range []bool{true, false} {
+		var out bytes.Buffer
+		r := &replay{ws: dial(t, url), out: &out, timeout: time.Second, original: original}
+
+		start := time.Now()
+		if err := r.run(context.Background(), records); err != nil || r.differ != 0 {
+			t.Fatalf("run: %v, %d differences:\n%s", err, r.differ, &out)
+		}
+
+		elapsed := time.Since(start)
+		if original && elapsed < 200*time.Millisecond {
+			t.Fatalf("expect the original timing to take 200ms found %s", elapsed)
+		}
+		if !original && elapsed >= 200*time.Millisecond {
+			t.Fatalf("expect the fast timing not to wait found %s", elapsed)
+		}
+	}
+}
+
+func TestReplayAnswersPings(t *testing.T) {
+	url, pongs := newEchoServer(t, true)
+
+	records := []websocket.Record{
+		{Direction: websocket.RecordSent, Opcode: websocket.OpcodeTextFrame, Text: "hi"},
+		{Direction: websocket.RecordReceived, Opcode: websocket.OpcodeTextFrame, Text: "hi"},
+	}
+
+	var out bytes.Buffer
+	r := &replay{ws: dial(t, url), out: &out, timeout: time.Second, ignored: controlFrames}
+	if err := r.run(context.Background(), records); err != nil || r.differ != 0 {
+		t.Fatalf("run: %v, %d differences:\n%s", err, r.differ, &out)
+	}
+
+	select {
+	case data := <-pongs:
+		if string(data) != "still there?" {
+			t.Fatalf("expect the pong of %q found %q", "still there?", data)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expect the ping of the server to be answered")
+	}
+
+	// Without ignoring them, the ping is compared with the echo.
+	out.Reset()
+	r = &replay{ws: dial(t, url), out: &out, timeout: time.Second}
+	if err := r.run(context.Background(), records); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if r.differ != 1 || !strings.Contains(out.String(), "found PING") {
+		t.Fatalf("expect the ping to differ found %d differences:\n%s", r.differ, &out)
+	}
+}
+
+func TestReadRecordsFlip(t *testing.T) {
+	path := writeRecords(t, []websocket.Record{
+		{Direction: websocket.RecordReceived, Opcode: websocket.OpcodeTextFrame, Text: "request"},
+		{Direction: websocket.RecordSent, Opcode: websocket.OpcodeBinaryFrame, Data: []byte{0xff}},
+	})
+
+	records, err := readRecords(path, true)
+	if err != nil {
+		t.Fatalf("readRecords: %v", err)
+	}
+
+	if len(records) != 2 ||
+		records[0].Direction != websocket.RecordSent || string(records[0].Payload()) != "request" ||
+		records[1].Direction != websocket.RecordReceived || !bytes.Equal(records[1].Payload(), []byte{0xff}) {
+		t.Fatalf("expect the directions swapped found %+v", records)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"direction":"sent","opcode":"text","text":"a"}`+"\n{"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := readRecords(path, false); err == nil || !strings.Contains(err.Error(), "record 2") {
+		t.Fatalf("expect an error on record 2 found %v", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	text := func(s string) websocket.Record {
+		return websocket.Record{Direction: websocket.RecordReceived, Opcode: websocket.OpcodeTextFrame, Text: s}
+	}
+
+	for _, c := range []struct {
+		rec    websocket.Record
+		msg    websocket.Message
+		expect string
+	}{
+		{text("hello"), websocket.Message{Opcode: websocket.OpcodeTextFrame, Data: []byte("hello")}, ""},
+		{text("hello"), websocket.Message{Opcode: websocket.OpcodeTextFrame, Data: []byte("hellO")}, "differ at byte 4"},
+		{text("hello"), websocket.Message{Opcode: websocket.OpcodeTextFrame, Data: []byte("hell")}, "differ at byte 4"},
+		{text("hello"), websocket.Message{Opcode: websocket.OpcodeTextFrame, Data: []byte("")}, "differ at byte 0"},
+		{text("hello"), websocket.Message{Opcode: websocket.OpcodeBinaryFrame, Data: []byte("hello")}, "found BINARY"},
+	} {
+		diff := compare(c.rec, c.msg)
+		if (c.expect == "") != (diff == "") || !strings.Contains(diff, c.expect) {
+			t.Errorf("compare %q with %q: expect %q found %q", c.rec.Text, c.msg.Data, c.expect, diff)
+		}
+	}
+
+	if diff := compare(text("hello"), websocket.Message{Opcode: websocket.OpcodeBinaryFrame}); strings.Contains(diff, "differ at") {
+		t.Errorf("expect no byte offset across opcodes found %q", diff)
+	}
+}
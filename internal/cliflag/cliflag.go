@@ -0,0 +1,32 @@
+// Package cliflag holds the flag.Value types shared by the commands.
+package cliflag
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// List collects the values of a flag given several times.
+type List []string
+
+func (l *List) String() string { return strings.Join(*l, ", ") }
+
+func (l *List) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// Header collects "Name: value" headers.
+type Header http.Header
+
+func (h Header) String() string { return fmt.Sprint(http.Header(h)) }
+
+func (h Header) Set(value string) error {
+	name, v, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("expect \"Name: value\" found %q", value)
+	}
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(v))
+	return nil
+}
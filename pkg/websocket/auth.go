@@ -0,0 +1,302 @@
+package websocket
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Authenticator adds credentials to the opening handshake of a client.
+//
+// Authorize is called with every handshake request before it is sent. When
+// the server answers with 401 Unauthorized and a WWW-Authenticate header,
+// Challenge is given the response, whose Request is the handshake request;
+// if it returns true the handshake is retried once on a new connection,
+// calling Authorize again.
+type Authenticator interface {
+	Authorize(req *http.Request) error
+	Challenge(res *http.Response) (bool, error)
+}
+
+// authenticator returns the Authenticator of the handshake to u: the one of
+// client, or basic authentication with the userinfo of u.
+func (client *WebSocketClient) authenticator(u *url.URL) Authenticator {
+	if client.Authenticator != nil {
+		return client.Authenticator
+	}
+
+	if u.User != nil {
+		password, _ := u.User.Password()
+		return &BasicAuth{Username: u.User.Username(), Password: password}
+	}
+	return nil
+}
+
+// dial performs the opening handshake to u, answering a 401 challenge of
+// the server with a second handshake when the authenticator accepts it.
+func (client *WebSocketClient) dial(ctx context.Context, u *url.URL, extraHeader http.Header) (WebSocket, error) {
+	ws, err := client.dialOnce(ctx, u, extraHeader)
+
+	var resErr *responseError
+	if !errors.As(err, &resErr) || resErr.res.StatusCode != http.StatusUnauthorized || resErr.res.Header.Get("WWW-Authenticate") == "" {
+		return ws, err
+	}
+
+	auth := client.authenticator(u)
+	if auth == nil {
+		return nil, err
+	}
+
+	retry, challengeErr := auth.Challenge(resErr.res)
+	if challengeErr != nil {
+		return nil, wrapError(challengeErr)
+	}
+
+	if !retry {
+		return nil, err
+	}
+	return client.dialOnce(ctx, u, extraHeader)
+}
+
+// BasicAuth sends a username and password with every handshake, as in RFC
+// 7617. It does not retry after a challenge, the credentials having been
+// sent already.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+func (a *BasicAuth) Authorize(req *http.Request) error {
+	req.SetBasicAuth(a.Username, a.Password)
+	return nil
+}
+
+func (a *BasicAuth) Challenge(res *http.Response) (bool, error) {
+	return false, nil
+}
+
+// BearerAuth sends the token returned by Token with every handshake, as in
+// RFC 6750. After a Bearer challenge the handshake is retried with a new
+// token, Token being called with refresh set so that providers caching
+// their tokens can replace an expired one.
+type BearerAuth struct {
+	Token func(ctx context.Context, refresh bool) (string, error)
+
+	mu      sync.Mutex
+	refresh bool
+}
+
+func (a *BearerAuth) Authorize(req *http.Request) error {
+	a.mu.Lock()
+	refresh := a.refresh
+	a.refresh = false
+	a.mu.Unlock()
+
+	token, err := a.Token(req.Context(), refresh)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+func (a *BearerAuth) Challenge(res *http.Response) (bool, error) {
+	if _, ok := findChallenge(res.Header, "Bearer"); !ok {
+		return false, nil
+	}
+
+	a.mu.Lock()
+	a.refresh = true
+	a.mu.Unlock()
+	return true, nil
+}
+
+// DigestAuth answers Digest challenges, as in RFC 7616, with the MD5 and
+// SHA-256 algorithms and their session variants. The first handshake goes
+// without credentials; once challenged, later handshakes reuse the nonce
+// of the server until it is challenged again.
+//
+// https://datatracker.ietf.org/doc/html/rfc7616
+type DigestAuth struct {
+	Username string
+	Password string
+
+	mu        sync.Mutex
+	challenge map[string]string
+	nc        int
+}
+
+func (a *DigestAuth) Challenge(res *http.Response) (bool, error) {
+	params, ok := findChallenge(res.Header, "Digest")
+	if !ok {
+		return false, nil
+	}
+
+	if params["realm"] == "" || params["nonce"] == "" {
+		return false, fmt.Errorf("%w: bad Digest challenge", ErrBadHandshake)
+	}
+
+	if _, err := digestHash(params["algorithm"]); err != nil {
+		return false, err
+	}
+
+	if qop := params["qop"]; qop != "" && !headerListContains(qop, "auth") {
+		return false, fmt.Errorf("%w: unsupported Digest qop %q", ErrBadHandshake, qop)
+	}
+
+	a.mu.Lock()
+	a.challenge = params
+	a.nc = 0
+	a.mu.Unlock()
+	return true, nil
+}
+
+func (a *DigestAuth) Authorize(req *http.Request) error {
+	a.mu.Lock()
+	challenge := a.challenge
+	a.nc++
+	nc := fmt.Sprintf("%08x", a.nc)
+	a.mu.Unlock()
+
+	if challenge == nil {
+		return nil
+	}
+
+	newHash, err := digestHash(challenge["algorithm"])
+	if err != nil {
+		return err
+	}
+
+	h := func(s string) string {
+		sum := newHash()
+		sum.Write([]byte(s))
+		return hex.EncodeToString(sum.Sum(nil))
+	}
+
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+
+	var (
+		realm     = challenge["realm"]
+		nonce     = challenge["nonce"]
+		algorithm = challenge["algorithm"]
+		uri       = req.URL.RequestURI()
+		cnonce    = hex.EncodeToString(random)
+	)
+
+	ha1 := h(a.Username + ":" + realm + ":" + a.Password)
+	if strings.HasSuffix(strings.ToLower(algorithm), "-sess") {
+		ha1 = h(ha1 + ":" + nonce + ":" + cnonce)
+	}
+	ha2 := h(req.Method + ":" + uri)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Digest username=%s, realm=%s, nonce=%s, uri=%s",
+		quoteParam(a.Username), quoteParam(realm), quoteParam(nonce), quoteParam(uri))
+	if algorithm != "" {
+		fmt.Fprintf(&b, ", algorithm=%s", algorithm)
+	}
+
+	if challenge["qop"] == "" {
+		fmt.Fprintf(&b, ", response=%q", h(ha1+":"+nonce+":"+ha2))
+	} else {
+		response := h(ha1 + ":" + nonce + ":" + nc + ":" + cnonce + ":auth:" + ha2)
+		fmt.Fprintf(&b, ", response=%q, qop=auth, nc=%s, cnonce=%q", response, nc, cnonce)
+	}
+
+	if opaque, ok := challenge["opaque"]; ok {
+		fmt.Fprintf(&b, ", opaque=%s", quoteParam(opaque))
+	}
+
+	req.Header.Set("Authorization", b.String())
+	return nil
+}
+
+func digestHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToUpper(strings.TrimSuffix(strings.ToLower(algorithm), "-sess")) {
+	case "", "MD5":
+		return md5.New, nil
+	case "SHA-256":
+		return sha256.New, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported Digest algorithm %q", ErrBadHandshake, algorithm)
+	}
+}
+
+func headerListContains(list, token string) bool {
+	for _, v := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(v), token) {
+			return true
+		}
+	}
+	return false
+}
+
+func quoteParam(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// findChallenge returns the parameters of the first challenge of the
+// WWW-Authenticate headers using scheme. Parameter names are lowercased.
+//
+// https://datatracker.ietf.org/doc/html/rfc9110#section-11.6.1
+func findChallenge(header http.Header, scheme string) (map[string]string, bool) {
+	for _, value := range header.Values("WWW-Authenticate") {
+		p := &extensionParser{s: value}
+
+		var params map[string]string
+		for !p.done() {
+			p.skipSpace()
+			if p.consume(',') {
+				continue
+			}
+
+			token := p.token()
+			if token == "" {
+				break
+			}
+
+			p.skipSpace()
+			if !p.consume('=') {
+				// A token not followed by "=" starts a new challenge; the
+				// parameters found so far belong to the previous one.
+				if params != nil {
+					return params, true
+				}
+				if strings.EqualFold(token, scheme) {
+					params = map[string]string{}
+				}
+				continue
+			}
+
+			p.skipSpace()
+			v := p.token()
+			if !p.done() && p.s[p.i] == '"' {
+				var err error
+				if v, err = p.quotedString(); err != nil {
+					break
+				}
+			}
+			if params != nil {
+				params[strings.ToLower(token)] = v
+			}
+		}
+
+		if params != nil {
+			return params, true
+		}
+	}
+	return nil, false
+}
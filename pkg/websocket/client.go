@@ -3,94 +3,482 @@ package websocket
 import (
 	"bufio"
 	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
 	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 	"net/http/httptrace"
 	"net/url"
+	"slices"
+	"strings"
+	"time"
 )
 
 type WebSocketClient struct {
 	Subprotocols []string
+
+	// TLSClientConfig configures wss:// connections. When nil the default
+	// configuration is used, with ServerName taken from the URL.
+	TLSClientConfig *tls.Config
+
+	// Extensions are offered to the server, in order.
+	Extensions []Extension
+
+	// HTTP2 opens the connection as an extended CONNECT stream over HTTP/2
+	// (RFC 8441) instead of upgrading an HTTP/1.1 connection. ws:// URLs
+	// use h2c with prior knowledge, wss:// URLs negotiate h2 over TLS.
+	// Every connection gets its own HTTP/2 connection.
+	HTTP2 bool
+
+	// NetDialContext opens the connection to the server, net.Dialer's
+	// DialContext when nil. The network is "tcp", or "unix" for
+	// ws+unix:// and wss+unix:// URLs, whose address is the socket path.
+	NetDialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+
+	// Jar supplies the cookies of the opening handshake, and stores the
+	// cookies the server sets in its response. Cookies are not used when
+	// nil.
+	Jar http.CookieJar
+
+	// MaxRedirects is the number of redirects the opening handshake may
+	// follow. Redirects are not followed when zero.
+	MaxRedirects int
+
+	// CheckRedirect, when set, is called before following a redirect to
+	// next, with the URLs dialed so far in via, oldest first. A non-nil
+	// error stops the dial; it is returned in a *HandshakeError.
+	CheckRedirect func(next *url.URL, via []*url.URL) error
+
+	// Authenticator adds credentials to the opening handshake, and answers
+	// the challenges of the server. When nil, the userinfo of the URL is
+	// sent with basic authentication.
+	Authenticator Authenticator
+
+	// Metrics counts the handshakes and connections of the client,
+	// DefaultMetrics when nil.
+	Metrics *Metrics
+
+	// Logger receives the records of the handshakes and connections of the
+	// client. Nothing is logged when nil.
+	Logger *slog.Logger
+
+	// FrameLogLevel is the level of the records logged for every frame,
+	// LevelFrame when nil. SetLogger changes it for a single connection.
+	FrameLogLevel slog.Leveler
 }
 
-func clientKey() string {
-	return "dGhlIHNhbXBsZSBub25jZQ=="
+// clientHeaders are the headers of the opening handshake the client sets
+// itself, which the extra header of a dial may not override.
+var clientHeaders = []string{
+	"Upgrade",
+	"Connection",
+	"Sec-WebSocket-Key",
+	"Sec-WebSocket-Version",
+	"Sec-WebSocket-Protocol",
+	"Sec-WebSocket-Extensions",
 }
 
-func defaultClientHeader() http.Header {
+// clientKey returns a fresh nonce for Sec-WebSocket-Key.
+//
+// https://datatracker.ietf.org/doc/html/rfc6455#section-4.1
+func clientKey() (string, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+func defaultClientHeader(key string) http.Header {
 	return http.Header{
 		"Upgrade":               []string{"websocket"},
 		"Connection":            []string{"Upgrade"},
-		"Sec-WebSocket-Key":     []string{clientKey()},
+		"Sec-WebSocket-Key":     []string{key},
 		"Sec-WebSocket-Version": []string{"13"},
 	}
 }
 
+// DialOptions configures Dial.
+type DialOptions struct {
+	// Client performs the dial, a zero WebSocketClient when nil.
+	Client *WebSocketClient
+
+	// Header is sent with the opening handshake, as the extraHeader of
+	// DialWithContext.
+	Header http.Header
+
+	// HandshakeTimeout bounds the whole dial: name resolution, the TCP and
+	// TLS handshakes, and the opening handshake with its redirects and
+	// retries. There is no timeout when zero.
+	HandshakeTimeout time.Duration
+}
+
+// Dial connects to urlString with the options of opts, which may be nil.
+// Neither urlString nor opts are modified. ctx and opts.HandshakeTimeout
+// bound the whole dial, the connection being closed when either expires;
+// they no longer affect the connection once Dial returns.
+func Dial(ctx context.Context, urlString string, opts *DialOptions) (WebSocket, error) {
+	if opts == nil {
+		opts = &DialOptions{}
+	}
+
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = &WebSocketClient{}
+	}
+
+	if opts.HandshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.HandshakeTimeout)
+		defer cancel()
+	}
+	return client.DialWithContext(ctx, u, opts.Header)
+}
+
+// DialWithContext connects to the ws://, wss://, ws+unix:// or wss+unix://
+// URL and performs the opening handshake, both bound to ctx. Neither url
+// nor extraHeader are modified. extraHeader carries the additional request
+// headers, such as Origin or Authorization, and may set Host, but not the
+// headers of the WebSocket protocol, which are set from the fields of
+// client.
+//
+// Redirects are followed up to MaxRedirects times, http:// and https://
+// locations being dialed as ws:// and wss://. The credentials, cookies and
+// Host of extraHeader are dropped, and the Authenticator is no longer used,
+// when a redirect leads to another host or from wss:// to ws://.
 func (client *WebSocketClient) DialWithContext(ctx context.Context, url *url.URL, extraHeader http.Header) (WebSocket, error) {
-	request := http.Request{
-		Method:     http.MethodGet,
-		URL:        url,
-		Proto:      "HTTP/1.1",
-		ProtoMajor: 1,
-		ProtoMinor: 1,
-		Header:     defaultClientHeader(),
+	metrics := client.Metrics
+	if metrics == nil {
+		metrics = DefaultMetrics
+	}
+
+	var (
+		ws  WebSocket
+		err error
+	)
+	if client.MaxRedirects > 0 {
+		ws, err = client.dialRedirects(ctx, url, extraHeader)
+	} else {
+		ws, err = client.dial(ctx, url, extraHeader)
+	}
+
+	metrics.handshake(RoleClient, err)
+
+	c, _ := ws.(*webSocketConn)
+	attrs := []any{"url", url.Redacted(), "origin", extraHeader.Get("Origin")}
+	if c != nil {
+		attrs = append(attrs, "remote_addr", c.RemoteAddr().String())
+	}
+	logHandshake(client.Logger, c, err, attrs...)
+	if err != nil {
+		return nil, err
 	}
 
+	c.setMetrics(metrics)
+	c.setLogger(client.Logger, client.FrameLogLevel, "role", RoleClient.String(), "url", url.Redacted())
+	return c, nil
+}
+
+// dialOnce connects to url and performs one opening handshake.
+func (client *WebSocketClient) dialOnce(ctx context.Context, url *url.URL, extraHeader http.Header) (WebSocket, error) {
+	target := *url
+	url = &target
+
+	network, addr := "tcp", url.Host
 	switch url.Scheme {
 	case "ws":
 		url.Scheme = "http"
 	case "wss":
 		url.Scheme = "https"
+	case "ws+unix", "wss+unix":
+		socket, target, err := unixTarget(url)
+		if err != nil {
+			return nil, err
+		}
+		network, addr, url = "unix", socket, target
 	default:
-		return nil, fmt.Errorf("websocket: invalid url scheme, expect 'ws' or 'wss' instead of '%s'", url.Scheme)
+		return nil, fmt.Errorf("websocket: invalid url scheme, expect 'ws', 'wss', 'ws+unix' or 'wss+unix' instead of '%s'", url.Scheme)
 	}
 
-	req := request.WithContext(ctx)
-	if len(client.Subprotocols) > 0 {
-		req.Header["Sec-WebSocket-Protocol"] = client.Subprotocols
+	if network == "tcp" && url.Port() == "" {
+		port := "80"
+		if url.Scheme == "https" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(url.Hostname(), port)
+	}
+
+	dial := client.NetDialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
 	}
 
+	// DNS lookups and connects made with ctx, as by net.Dialer, report to
+	// the DNSStart, DNSDone, ConnectStart and ConnectDone hooks.
 	tracer := httptrace.ContextClientTrace(ctx)
-	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", url.Host)
+	if tracer != nil && tracer.GetConn != nil {
+		tracer.GetConn(addr)
+	}
+
+	conn, err := dial(ctx, network, addr)
 	if err != nil {
 		return nil, wrapError(err)
 	}
 
+	if url.Scheme == "https" {
+		conn, err = client.handshakeTLS(ctx, conn, url.Hostname())
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	if tracer != nil && tracer.GotConn != nil {
 		tracer.GotConn(httptrace.GotConnInfo{Conn: conn})
 	}
 
-	shouldCloseConn := true
-	defer func() {
-		if shouldCloseConn {
-			conn.Close()
+	handshake := client.Handshake
+	if client.HTTP2 {
+		handshake = client.handshakeHTTP2
+	}
+
+	ws, err := handshake(ctx, conn, url, extraHeader)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return ws, nil
+}
+
+// handshakeTLS wraps conn in a TLS client connection, closing conn when the
+// TLS handshake fails.
+func (client *WebSocketClient) handshakeTLS(ctx context.Context, conn net.Conn, serverName string) (net.Conn, error) {
+	config := client.TLSClientConfig
+	if config == nil {
+		config = &tls.Config{}
+	}
+
+	if config.ServerName == "" || client.HTTP2 {
+		config = config.Clone()
+		if config.ServerName == "" {
+			config.ServerName = serverName
+		}
+		if client.HTTP2 {
+			config.NextProtos = []string{"h2"}
 		}
-	}()
+	}
 
-	if err = req.Write(conn); err != nil {
+	tracer := httptrace.ContextClientTrace(ctx)
+	if tracer != nil && tracer.TLSHandshakeStart != nil {
+		tracer.TLSHandshakeStart()
+	}
+
+	tlsConn := tls.Client(conn, config)
+	err := tlsConn.HandshakeContext(ctx)
+	if tracer != nil && tracer.TLSHandshakeDone != nil {
+		tracer.TLSHandshakeDone(tlsConn.ConnectionState(), err)
+	}
+
+	if err != nil {
+		conn.Close()
+		return nil, wrapError(err)
+	}
+
+	if client.HTTP2 && tlsConn.ConnectionState().NegotiatedProtocol != "h2" {
+		tlsConn.Close()
+		return nil, fmt.Errorf("%w: server does not speak h2", ErrBadHandshake)
+	}
+	return tlsConn, nil
+}
+
+// Handshake performs the opening handshake over an already established
+// connection. The caller keeps ownership of conn when an error is returned.
+func (client *WebSocketClient) Handshake(ctx context.Context, conn net.Conn, url *url.URL, extraHeader http.Header) (WebSocket, error) {
+	key, err := clientKey()
+	if err != nil {
 		return nil, wrapError(err)
 	}
 
+	req, err := client.newRequest(ctx, http.MethodGet, url, extraHeader)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range defaultClientHeader(key) {
+		req.Header[name] = values
+	}
+	if len(client.Subprotocols) > 0 {
+		req.Header["Sec-WebSocket-Protocol"] = client.Subprotocols
+	}
+	if len(client.Extensions) > 0 {
+		req.Header.Set("Sec-WebSocket-Extensions", FormatExtensions(offerExtensions(client.Extensions)))
+	}
+
+	// The handshake is bound to ctx: once it is done, the request write or
+	// response read in progress fails.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	// Write reports to the WroteHeaderField, WroteHeaders and WroteRequest
+	// hooks of the ClientTrace of ctx.
+	if err = req.Write(conn); err != nil {
+		return nil, contextError(ctx, err)
+	}
+
 	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
 	ws := NewConn(conn, rw.Reader, rw.Writer, true).(*webSocketConn)
+	ws.setTrace(ContextConnTrace(ctx))
 
+	tracer := httptrace.ContextClientTrace(ctx)
 	if tracer != nil && tracer.GotFirstResponseByte != nil {
-		if _, err = ws.reader.Peek(1); err != nil {
+		if _, err := ws.reader.Peek(1); err == nil {
 			tracer.GotFirstResponseByte()
 		}
 	}
 
 	res, err := http.ReadResponse(ws.reader, req)
 	if err != nil {
-		return nil, wrapError(err)
+		return nil, contextError(ctx, err)
 	}
 
-	if res.StatusCode != http.StatusSwitchingProtocols {
-		return nil, ErrBadHandshake
+	if err := checkHandshakeResponse(res, key, client.Subprotocols); err != nil {
+		return nil, err
 	}
+	ws.subprotocol = res.Header.Get("Sec-WebSocket-Protocol")
 
-	// stops deferred function from closing the connection
-	shouldCloseConn = false
+	extensions, err := acceptedExtensions(client.Extensions, res.Header)
+	if err != nil {
+		return nil, err
+	}
+	ws.setExtensions(extensions)
+
+	if !stop() {
+		return nil, contextError(ctx, nil)
+	}
+	conn.SetDeadline(time.Time{})
+
+	client.storeCookies(url, res.Header)
 	return ws, nil
 }
+
+// contextError returns the error of a handshake that failed with err: the
+// error of ctx if it is done, since err is then only its consequence.
+func contextError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return wrapOpError("handshake", ctx.Err())
+	}
+	return wrapError(err)
+}
+
+// newRequest returns the request of the opening handshake without the
+// headers the client sets itself. It carries extraHeader, the cookies of
+// client.Jar and the credentials of the authenticator for u. The Host header
+// comes from the URL unless extraHeader overrides it, and the request target
+// is the path and query of the URL.
+func (client *WebSocketClient) newRequest(ctx context.Context, method string, u *url.URL, extraHeader http.Header) (*http.Request, error) {
+	header := http.Header{}
+	for name, values := range extraHeader {
+		for _, h := range clientHeaders {
+			if strings.EqualFold(h, name) {
+				return nil, fmt.Errorf("%w: %s is set by the client", ErrHeaderNotAllowed, h)
+			}
+		}
+
+		for _, value := range values {
+			header.Add(name, value)
+		}
+	}
+
+	host := header.Get("Host")
+	if host == "" {
+		host = u.Host
+	}
+	header.Del("Host")
+
+	request := http.Request{
+		Method:     method,
+		URL:        u,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Host:       host,
+	}
+	req := request.WithContext(ctx)
+
+	if client.Jar != nil {
+		for _, cookie := range client.Jar.Cookies(u) {
+			req.AddCookie(cookie)
+		}
+	}
+
+	if auth := client.authenticator(u); auth != nil {
+		if err := auth.Authorize(req); err != nil {
+			return nil, wrapError(err)
+		}
+	}
+	return req, nil
+}
+
+// storeCookies saves the cookies set by the response of the opening
+// handshake in client.Jar.
+func (client *WebSocketClient) storeCookies(u *url.URL, header http.Header) {
+	if client.Jar == nil {
+		return
+	}
+
+	res := http.Response{Header: header}
+	if cookies := res.Cookies(); len(cookies) > 0 {
+		client.Jar.SetCookies(u, cookies)
+	}
+}
+
+// checkHandshakeResponse validates the server side of the opening handshake.
+//
+// https://datatracker.ietf.org/doc/html/rfc6455#section-4.1
+func checkHandshakeResponse(res *http.Response, key string, subprotocols []string) error {
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		return &responseError{res: res}
+	}
+
+	if !headerContainsToken(res.Header, "Upgrade", "websocket") || !headerContainsToken(res.Header, "Connection", "upgrade") {
+		return fmt.Errorf("%w: missing upgrade headers", ErrBadHandshake)
+	}
+
+	if res.Header.Get("Sec-WebSocket-Accept") != serverKey(key) {
+		return fmt.Errorf("%w: mismatched Sec-WebSocket-Accept", ErrBadHandshake)
+	}
+
+	return checkSubprotocol(res.Header, subprotocols)
+}
+
+// responseError is returned when the server answers the opening handshake
+// with a status that does not accept it. It is an ErrBadHandshake, which
+// keeps the response to follow redirects and answer challenges.
+type responseError struct {
+	res *http.Response
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("%v: unexpected status %s", ErrBadHandshake, e.res.Status)
+}
+
+func (e *responseError) Unwrap() error {
+	return ErrBadHandshake
+}
+
+// checkSubprotocol checks that the subprotocol selected by the server, if
+// any, is one the client offered.
+func checkSubprotocol(header http.Header, subprotocols []string) error {
+	if subprotocol := header.Get("Sec-WebSocket-Protocol"); subprotocol != "" && !slices.Contains(subprotocols, subprotocol) {
+		return fmt.Errorf("%w: unexpected subprotocol %q", ErrBadHandshake, subprotocol)
+	}
+	return nil
+}
@@ -1,5 +1,11 @@
 package websocket
 
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
 type CloseStatus int
 
 // https://datatracker.ietf.org/doc/html/rfc6455#section-7.4
@@ -20,5 +26,111 @@ const (
 	CloseInternalServerErr                CloseStatus = 1011
 	CloseServiceRestart                   CloseStatus = 1012
 	CloseTryAgainLater                    CloseStatus = 1013
+	CloseBadGateway                       CloseStatus = 1014
 	CloseTLSHandshake                     CloseStatus = 1015
 )
+
+// https://datatracker.ietf.org/doc/html/rfc6455#section-7.4.2
+const (
+	closeRegisteredMin CloseStatus = 3000
+	closeRegisteredMax CloseStatus = 3999
+	closePrivateMin    CloseStatus = 4000
+	closePrivateMax    CloseStatus = 4999
+)
+
+var (
+	ErrInvalidCloseStatus    = newProtocolError(CloseProtocolError, "invalid close status")
+	ErrCloseStatusNotPrivate = errors.New("websocket: close status is not in the private use range")
+	ErrCloseStatusRegistered = errors.New("websocket: close status is already registered")
+)
+
+var closeStatusNames = map[CloseStatus]string{
+	CloseNormalClosure:                    "Normal Closure",
+	CloseGoingAway:                        "Going Away",
+	CloseProtocolError:                    "Protocol Error",
+	CloseUnsupportedData:                  "Unsupported Data",
+	CloseReservedButNotSpecifiedByRFC6455: "Reserved",
+	CloseNoStatusReceived:                 "No Status Received",
+	CloseAbnormalClosure:                  "Abnormal Closure",
+	CloseInvalidFramePayloadData:          "Invalid Frame Payload Data",
+	ClosePolicyViolation:                  "Policy Violation",
+	CloseMessageTooBig:                    "Message Too Big",
+	CloseMandatoryExtension:               "Mandatory Extension",
+	CloseInternalServerErr:                "Internal Server Error",
+	CloseServiceRestart:                   "Service Restart",
+	CloseTryAgainLater:                    "Try Again Later",
+	CloseBadGateway:                       "Bad Gateway",
+	CloseTLSHandshake:                     "TLS Handshake",
+}
+
+// privateCloseStatuses holds the names applications gave to their own codes
+// in the 4000-4999 range.
+var privateCloseStatuses = struct {
+	sync.RWMutex
+	names map[CloseStatus]string
+}{names: map[CloseStatus]string{}}
+
+// RegisterCloseStatus names an application defined close status. Only codes
+// in the private use range (4000-4999) can be registered, and only once.
+func RegisterCloseStatus(status CloseStatus, name string) error {
+	if !status.IsPrivate() {
+		return ErrCloseStatusNotPrivate
+	}
+
+	privateCloseStatuses.Lock()
+	defer privateCloseStatuses.Unlock()
+
+	if _, ok := privateCloseStatuses.names[status]; ok {
+		return ErrCloseStatusRegistered
+	}
+	privateCloseStatuses.names[status] = name
+	return nil
+}
+
+// IsRegistered reports whether status is in the range reserved for codes
+// registered with IANA by libraries, frameworks and applications.
+func (status CloseStatus) IsRegistered() bool {
+	return status >= closeRegisteredMin && status <= closeRegisteredMax
+}
+
+// IsPrivate reports whether status is in the private use range.
+func (status CloseStatus) IsPrivate() bool {
+	return status >= closePrivateMin && status <= closePrivateMax
+}
+
+// IsValidOnWire reports whether status may appear in a close frame. The
+// reserved 1004, 1005, 1006 and 1015 codes are only meaningful locally.
+func (status CloseStatus) IsValidOnWire() bool {
+	switch status {
+	case CloseNormalClosure,
+		CloseGoingAway,
+		CloseProtocolError,
+		CloseUnsupportedData,
+		CloseInvalidFramePayloadData,
+		ClosePolicyViolation,
+		CloseMessageTooBig,
+		CloseMandatoryExtension,
+		CloseInternalServerErr,
+		CloseServiceRestart,
+		CloseTryAgainLater,
+		CloseBadGateway:
+		return true
+	}
+	return status.IsRegistered() || status.IsPrivate()
+}
+
+func (status CloseStatus) String() string {
+	if name, ok := closeStatusNames[status]; ok {
+		return name
+	}
+
+	if status.IsPrivate() {
+		privateCloseStatuses.RLock()
+		name, ok := privateCloseStatuses.names[status]
+		privateCloseStatuses.RUnlock()
+		if ok {
+			return name
+		}
+	}
+	return fmt.Sprintf("CloseStatus(%d)", int(status))
+}
@@ -0,0 +1,601 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// Case is a single conformance test. The numbering follows the sections of
+// the Autobahn test suite so results can be compared side by side.
+type Case struct {
+	ID          string
+	Description string
+
+	// Target limits the case to one side, zero runs it against both.
+	Target Target
+
+	Run func(s *Session) error
+}
+
+var (
+	textPayload   = []byte("Hello-µ@ßöäüàá-UTF-8!!")
+	binaryPayload = []byte{0x00, 0xFF, 0xFE, 0xFD, 0xFC, 0xFB, 0x00, 0xFF}
+
+	// https://github.com/crossbario/autobahn-testsuite case 6.3.1
+	invalidUTF8 = []byte{0xce, 0xba, 0xe1, 0xbd, 0xb9, 0xcf, 0x83, 0xce, 0xbc, 0xce, 0xb5, 0xed, 0xa0, 0x80, 0x65, 0x64, 0x69, 0x74, 0x65, 0x64}
+)
+
+// Cases returns the full suite in execution order.
+func Cases() []Case {
+	var cases []Case
+	cases = append(cases, framingCases()...)
+	cases = append(cases, pingPongCases()...)
+	cases = append(cases, reservedBitsCases()...)
+	cases = append(cases, opcodeCases()...)
+	cases = append(cases, fragmentationCases()...)
+	cases = append(cases, utf8Cases()...)
+	cases = append(cases, closeCases()...)
+	cases = append(cases, limitsCases()...)
+	cases = append(cases, maskingCases()...)
+	return cases
+}
+
+// Select filters cases by ID. Patterns use path.Match syntax, so "6.*"
+// selects every UTF-8 case. An empty include list selects every case.
+func Select(cases []Case, include, exclude []string) []Case {
+	var selected []Case
+	for _, c := range cases {
+		if len(include) > 0 && !matchID(c.ID, include) {
+			continue
+		}
+		if matchID(c.ID, exclude) {
+			continue
+		}
+		selected = append(selected, c)
+	}
+	return selected
+}
+
+func matchID(id string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == id {
+			return true
+		}
+		if ok, _ := path.Match(pattern, id); ok {
+			return true
+		}
+		// "6.*" also selects nested IDs such as 6.1.2.
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(id, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func echoCase(id, description string, opc websocket.Opcode, payload []byte) Case {
+	return Case{
+		ID:          id,
+		Description: description,
+		Run: func(s *Session) error {
+			if err := s.SendMessage(opc, payload); err != nil {
+				return err
+			}
+			if err := s.ExpectMessage(opc, payload); err != nil {
+				return err
+			}
+			return s.Close()
+		},
+	}
+}
+
+func failCase(id, description string, send func(s *Session) error, codes ...websocket.CloseStatus) Case {
+	return Case{
+		ID:          id,
+		Description: description,
+		Run: func(s *Session) error {
+			if err := send(s); err != nil {
+				return err
+			}
+			return s.ExpectFail(codes...)
+		},
+	}
+}
+
+func sendFrames(frames ...Frame) func(s *Session) error {
+	return func(s *Session) error {
+		for _, f := range frames {
+			if err := s.Send(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func closePayload(status websocket.CloseStatus, reason string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(status)), reason...)
+}
+
+// 1.x: single frame text and binary messages around the length boundaries.
+func framingCases() []Case {
+	sizes := []int{0, 125, 126, 127, 128, 65535, 65536}
+
+	var cases []Case
+	for i, size := range sizes {
+		cases = append(cases, echoCase(
+			fmt.Sprintf("1.1.%d", i+1),
+			fmt.Sprintf("Send text message with payload length %d", size),
+			websocket.OpcodeTextFrame,
+			bytes.Repeat([]byte("*"), size),
+		))
+	}
+	cases = append(cases, Case{
+		ID:          "1.1.8",
+		Description: "Send text message with payload length 65536, written in chops of 997 octets",
+		Run: func(s *Session) error {
+			payload := bytes.Repeat([]byte("*"), 65536)
+			if err := s.SendChopped(Frame{Fin: true, Opcode: websocket.OpcodeTextFrame, Payload: payload}, 997); err != nil {
+				return err
+			}
+			if err := s.ExpectMessage(websocket.OpcodeTextFrame, payload); err != nil {
+				return err
+			}
+			return s.Close()
+		},
+	})
+
+	for i, size := range sizes {
+		cases = append(cases, echoCase(
+			fmt.Sprintf("1.2.%d", i+1),
+			fmt.Sprintf("Send binary message with payload length %d", size),
+			websocket.OpcodeBinaryFrame,
+			bytes.Repeat([]byte{0xFE}, size),
+		))
+	}
+	return cases
+}
+
+// 2.x: pings, pongs and control frame payload limits.
+func pingPongCases() []Case {
+	ping := func(id, description string, payload []byte) Case {
+		return Case{
+			ID:          id,
+			Description: description,
+			Run: func(s *Session) error {
+				if err := s.Send(Frame{Fin: true, Opcode: websocket.OpcodePingFrame, Payload: payload}); err != nil {
+					return err
+				}
+				if err := s.ExpectPong(payload); err != nil {
+					return err
+				}
+				return s.Close()
+			},
+		}
+	}
+
+	return []Case{
+		ping("2.1", "Send ping without payload", nil),
+		ping("2.2", "Send ping with small text payload", []byte("Hello, world!")),
+		ping("2.3", "Send ping with small binary payload", binaryPayload),
+		ping("2.4", "Send ping with binary payload of 125 octets", bytes.Repeat([]byte{0xFE}, 125)),
+		failCase("2.5", "Send ping with binary payload of 126 octets",
+			sendFrames(Frame{Fin: true, Opcode: websocket.OpcodePingFrame, Payload: bytes.Repeat([]byte{0xFE}, 126)}),
+			websocket.CloseProtocolError),
+		{
+			ID:          "2.6",
+			Description: "Send unsolicited pong without payload, then a text message",
+			Run: func(s *Session) error {
+				if err := s.Send(Frame{Fin: true, Opcode: websocket.OpcodePongFrame}); err != nil {
+					return err
+				}
+				if err := s.SendMessage(websocket.OpcodeTextFrame, textPayload); err != nil {
+					return err
+				}
+				if err := s.ExpectMessage(websocket.OpcodeTextFrame, textPayload); err != nil {
+					return err
+				}
+				return s.Close()
+			},
+		},
+		{
+			ID:          "2.7",
+			Description: "Send 10 pings, expect 10 pongs in order",
+			Run: func(s *Session) error {
+				for i := range 10 {
+					payload := []byte(fmt.Sprintf("payload-%d", i))
+					if err := s.Send(Frame{Fin: true, Opcode: websocket.OpcodePingFrame, Payload: payload}); err != nil {
+						return err
+					}
+				}
+				for i := range 10 {
+					if err := s.ExpectPong([]byte(fmt.Sprintf("payload-%d", i))); err != nil {
+						return err
+					}
+				}
+				return s.Close()
+			},
+		},
+	}
+}
+
+// 3.x: frames with reserved bits set while no extension is negotiated.
+func reservedBitsCases() []Case {
+	var cases []Case
+	for i, rsv := range []byte{1, 2, 3, 4, 5, 6, 7} {
+		opc := websocket.OpcodeTextFrame
+		if i%2 == 1 {
+			opc = websocket.OpcodeBinaryFrame
+		}
+		cases = append(cases, failCase(
+			fmt.Sprintf("3.%d", i+1),
+			fmt.Sprintf("Send %s message with RSV = %d", opc, rsv),
+			sendFrames(Frame{Fin: true, Rsv: rsv, Opcode: opc, Payload: textPayload}),
+			websocket.CloseProtocolError,
+		))
+	}
+	cases = append(cases, failCase(
+		"3.8",
+		"Send ping with RSV = 4 after a valid text message",
+		func(s *Session) error {
+			if err := s.SendMessage(websocket.OpcodeTextFrame, textPayload); err != nil {
+				return err
+			}
+			if err := s.ExpectMessage(websocket.OpcodeTextFrame, textPayload); err != nil {
+				return err
+			}
+			return s.Send(Frame{Fin: true, Rsv: 4, Opcode: websocket.OpcodePingFrame})
+		},
+		websocket.CloseProtocolError,
+	))
+	return cases
+}
+
+// 4.x: reserved data and control opcodes.
+func opcodeCases() []Case {
+	var cases []Case
+	for i, opc := range []websocket.Opcode{3, 4, 5, 6, 7} {
+		cases = append(cases, failCase(
+			fmt.Sprintf("4.1.%d", i+1),
+			fmt.Sprintf("Send frame with reserved non-control opcode %d", opc),
+			sendFrames(Frame{Fin: true, Opcode: opc, Payload: textPayload}),
+			websocket.CloseProtocolError,
+		))
+	}
+	for i, opc := range []websocket.Opcode{11, 12, 13, 14, 15} {
+		cases = append(cases, failCase(
+			fmt.Sprintf("4.2.%d", i+1),
+			fmt.Sprintf("Send frame with reserved control opcode %d", opc),
+			sendFrames(Frame{Fin: true, Opcode: opc, Payload: textPayload}),
+			websocket.CloseProtocolError,
+		))
+	}
+	return cases
+}
+
+// 5.x: fragmented messages and control frames in between fragments.
+func fragmentationCases() []Case {
+	fragmentedEcho := func(id, description string, opc websocket.Opcode, frames []Frame, pongs ...[]byte) Case {
+		return Case{
+			ID:          id,
+			Description: description,
+			Run: func(s *Session) error {
+				if err := sendFrames(frames...)(s); err != nil {
+					return err
+				}
+
+				for _, pong := range pongs {
+					if err := s.ExpectPong(pong); err != nil {
+						return err
+					}
+				}
+
+				var payload []byte
+				for _, f := range frames {
+					if !f.Opcode.IsControl() {
+						payload = append(payload, f.Payload...)
+					}
+				}
+				if err := s.ExpectMessage(opc, payload); err != nil {
+					return err
+				}
+				return s.Close()
+			},
+		}
+	}
+
+	oneByteFragments := func(opc websocket.Opcode, payload []byte) []Frame {
+		frames := make([]Frame, len(payload))
+		for i := range payload {
+			frames[i] = Frame{Fin: i == len(payload)-1, Opcode: websocket.OpcodeContinueFrame, Payload: payload[i : i+1]}
+		}
+		frames[0].Opcode = opc
+		return frames
+	}
+
+	return []Case{
+		failCase("5.1", "Send ping fragmented into 2 fragments",
+			sendFrames(
+				Frame{Opcode: websocket.OpcodePingFrame, Payload: []byte("frag1")},
+				Frame{Fin: true, Opcode: websocket.OpcodeContinueFrame, Payload: []byte("frag2")},
+			),
+			websocket.CloseProtocolError),
+		failCase("5.2", "Send pong fragmented into 2 fragments",
+			sendFrames(
+				Frame{Opcode: websocket.OpcodePongFrame, Payload: []byte("frag1")},
+				Frame{Fin: true, Opcode: websocket.OpcodeContinueFrame, Payload: []byte("frag2")},
+			),
+			websocket.CloseProtocolError),
+		fragmentedEcho("5.3", "Send text message fragmented into 2 fragments", websocket.OpcodeTextFrame, []Frame{
+			{Opcode: websocket.OpcodeTextFrame, Payload: []byte("fragment1")},
+			{Fin: true, Opcode: websocket.OpcodeContinueFrame, Payload: []byte("fragment2")},
+		}),
+		fragmentedEcho("5.4", "Send binary message fragmented into 1 octet fragments", websocket.OpcodeBinaryFrame,
+			oneByteFragments(websocket.OpcodeBinaryFrame, binaryPayload)),
+		fragmentedEcho("5.5", "Send text message fragmented into 2 fragments with a ping in between", websocket.OpcodeTextFrame, []Frame{
+			{Opcode: websocket.OpcodeTextFrame, Payload: []byte("fragment1")},
+			{Fin: true, Opcode: websocket.OpcodePingFrame, Payload: []byte("ping")},
+			{Fin: true, Opcode: websocket.OpcodeContinueFrame, Payload: []byte("fragment2")},
+		}, []byte("ping")),
+		fragmentedEcho("5.6", "Send text message fragmented into 3 fragments with a pong in between", websocket.OpcodeTextFrame, []Frame{
+			{Opcode: websocket.OpcodeTextFrame, Payload: []byte("fragment1")},
+			{Fin: true, Opcode: websocket.OpcodePongFrame, Payload: []byte("pong")},
+			{Opcode: websocket.OpcodeContinueFrame, Payload: []byte("fragment2")},
+			{Fin: true, Opcode: websocket.OpcodeContinueFrame, Payload: []byte("fragment3")},
+		}),
+		failCase("5.7", "Send unfragmented continuation frame",
+			sendFrames(Frame{Fin: true, Opcode: websocket.OpcodeContinueFrame, Payload: []byte("fragment")}),
+			websocket.CloseProtocolError),
+		failCase("5.8", "Send fragmented continuation frames without a message in progress",
+			sendFrames(
+				Frame{Opcode: websocket.OpcodeContinueFrame, Payload: []byte("fragment1")},
+				Frame{Fin: true, Opcode: websocket.OpcodeContinueFrame, Payload: []byte("fragment2")},
+			),
+			websocket.CloseProtocolError),
+		failCase("5.9", "Send text fragment followed by a new text message",
+			sendFrames(
+				Frame{Opcode: websocket.OpcodeTextFrame, Payload: []byte("fragment1")},
+				Frame{Fin: true, Opcode: websocket.OpcodeTextFrame, Payload: []byte("fragment2")},
+			),
+			websocket.CloseProtocolError),
+		{
+			ID:          "5.10",
+			Description: "Send text message fragmented into 2 fragments, then a second unfragmented message",
+			Run: func(s *Session) error {
+				err := sendFrames(
+					Frame{Opcode: websocket.OpcodeTextFrame, Payload: []byte("fragment1")},
+					Frame{Fin: true, Opcode: websocket.OpcodeContinueFrame, Payload: []byte("fragment2")},
+					Frame{Fin: true, Opcode: websocket.OpcodeTextFrame, Payload: []byte("message")},
+				)(s)
+				if err != nil {
+					return err
+				}
+				if err := s.ExpectMessage(websocket.OpcodeTextFrame, []byte("fragment1fragment2")); err != nil {
+					return err
+				}
+				if err := s.ExpectMessage(websocket.OpcodeTextFrame, []byte("message")); err != nil {
+					return err
+				}
+				return s.Close()
+			},
+		},
+	}
+}
+
+// 6.x: UTF-8 validation of text messages.
+func utf8Cases() []Case {
+	splitAt := func(payload []byte, i int) []Frame {
+		return []Frame{
+			{Opcode: websocket.OpcodeTextFrame, Payload: payload[:i]},
+			{Fin: true, Opcode: websocket.OpcodeContinueFrame, Payload: payload[i:]},
+		}
+	}
+
+	return []Case{
+		echoCase("6.1.1", "Send valid UTF-8 text message", websocket.OpcodeTextFrame, textPayload),
+		echoCase("6.1.2", "Send text message with 4 octet UTF-8 sequences", websocket.OpcodeTextFrame, []byte("\U0001F600\U0001F4A9")),
+		{
+			ID:          "6.2.1",
+			Description: "Send valid UTF-8 text message split in the middle of a code point",
+			Run: func(s *Session) error {
+				if err := sendFrames(splitAt(textPayload, 7)...)(s); err != nil {
+					return err
+				}
+				if err := s.ExpectMessage(websocket.OpcodeTextFrame, textPayload); err != nil {
+					return err
+				}
+				return s.Close()
+			},
+		},
+		{
+			ID:          "6.2.2",
+			Description: "Send text message fragmented into empty fragments",
+			Run: func(s *Session) error {
+				err := sendFrames(
+					Frame{Opcode: websocket.OpcodeTextFrame},
+					Frame{Opcode: websocket.OpcodeContinueFrame},
+					Frame{Fin: true, Opcode: websocket.OpcodeContinueFrame},
+				)(s)
+				if err != nil {
+					return err
+				}
+				if err := s.ExpectMessage(websocket.OpcodeTextFrame, nil); err != nil {
+					return err
+				}
+				return s.Close()
+			},
+		},
+		failCase("6.3.1", "Send invalid UTF-8 text message",
+			sendFrames(Frame{Fin: true, Opcode: websocket.OpcodeTextFrame, Payload: invalidUTF8}),
+			websocket.CloseInvalidFramePayloadData),
+		failCase("6.3.2", "Send invalid UTF-8 text message split across fragments",
+			sendFrames(splitAt(invalidUTF8, 12)...),
+			websocket.CloseInvalidFramePayloadData),
+		failCase("6.4.1", "Send text message ending in a truncated code point",
+			sendFrames(Frame{Fin: true, Opcode: websocket.OpcodeTextFrame, Payload: []byte{0x48, 0x65, 0x6c, 0x6c, 0xf0, 0x9f}}),
+			websocket.CloseInvalidFramePayloadData),
+		failCase("6.4.2", "Send text message with an overlong encoding",
+			sendFrames(Frame{Fin: true, Opcode: websocket.OpcodeTextFrame, Payload: []byte{0xc0, 0xaf}}),
+			websocket.CloseInvalidFramePayloadData),
+		failCase("6.4.3", "Send text message with a UTF-16 surrogate",
+			sendFrames(Frame{Fin: true, Opcode: websocket.OpcodeTextFrame, Payload: []byte{0xed, 0xa0, 0x80}}),
+			websocket.CloseInvalidFramePayloadData),
+	}
+}
+
+// 7.x: the close handshake.
+func closeCases() []Case {
+	closeEcho := func(id, description string, payload []byte, codes ...websocket.CloseStatus) Case {
+		return Case{
+			ID:          id,
+			Description: description,
+			Run: func(s *Session) error {
+				if err := s.Send(Frame{Fin: true, Opcode: websocket.OpcodeCloseFrame, Payload: payload}); err != nil {
+					return err
+				}
+				return s.ExpectClose(codes...)
+			},
+		}
+	}
+
+	cases := []Case{
+		closeEcho("7.1.1", "Send close with status 1000", closePayload(websocket.CloseNormalClosure, ""), websocket.CloseNormalClosure),
+		closeEcho("7.1.2", "Send close without payload", nil, websocket.CloseNoStatusReceived, websocket.CloseNormalClosure),
+		failCase("7.1.3", "Send close with 1 octet payload",
+			sendFrames(Frame{Fin: true, Opcode: websocket.OpcodeCloseFrame, Payload: []byte{0x03}}),
+			websocket.CloseProtocolError),
+		closeEcho("7.1.4", "Send close with status 1000 and a reason", closePayload(websocket.CloseNormalClosure, "Hello World!"), websocket.CloseNormalClosure),
+		closeEcho("7.1.5", "Send close with status 1000 and a 123 octet reason", closePayload(websocket.CloseNormalClosure, strings.Repeat("*", 123)), websocket.CloseNormalClosure),
+		failCase("7.1.6", "Send close with status 1000 and a 124 octet reason",
+			sendFrames(Frame{Fin: true, Opcode: websocket.OpcodeCloseFrame, Payload: closePayload(websocket.CloseNormalClosure, strings.Repeat("*", 124))}),
+			websocket.CloseProtocolError),
+		failCase("7.1.7", "Send close with status 1000 and an invalid UTF-8 reason",
+			sendFrames(Frame{Fin: true, Opcode: websocket.OpcodeCloseFrame, Payload: append(closePayload(websocket.CloseNormalClosure, ""), invalidUTF8...)}),
+			websocket.CloseProtocolError, websocket.CloseInvalidFramePayloadData),
+		{
+			ID:          "7.2.1",
+			Description: "Send text message after the close frame",
+			Run: func(s *Session) error {
+				err := sendFrames(
+					Frame{Fin: true, Opcode: websocket.OpcodeCloseFrame, Payload: closePayload(websocket.CloseNormalClosure, "")},
+					Frame{Fin: true, Opcode: websocket.OpcodeTextFrame, Payload: textPayload},
+				)(s)
+				if err != nil {
+					return err
+				}
+				return s.ExpectClose(websocket.CloseNormalClosure)
+			},
+		},
+		{
+			ID:          "7.2.2",
+			Description: "Send ping after the close frame",
+			Run: func(s *Session) error {
+				err := sendFrames(
+					Frame{Fin: true, Opcode: websocket.OpcodeCloseFrame, Payload: closePayload(websocket.CloseNormalClosure, "")},
+					Frame{Fin: true, Opcode: websocket.OpcodePingFrame, Payload: []byte("ping")},
+				)(s)
+				if err != nil {
+					return err
+				}
+				return s.ExpectClose(websocket.CloseNormalClosure)
+			},
+		},
+	}
+
+	valid := []websocket.CloseStatus{1000, 1001, 1002, 1003, 1007, 1008, 1009, 1010, 1011, 3000, 3999, 4000, 4999}
+	for i, status := range valid {
+		cases = append(cases, closeEcho(
+			fmt.Sprintf("7.3.%d", i+1),
+			fmt.Sprintf("Send close with valid status %d", status),
+			closePayload(status, ""),
+			status, websocket.CloseNormalClosure,
+		))
+	}
+
+	invalid := []websocket.CloseStatus{0, 999, 1004, 1005, 1006, 1015, 1016, 1100, 2000, 2999, 5000, 65535}
+	for i, status := range invalid {
+		cases = append(cases, failCase(
+			fmt.Sprintf("7.4.%d", i+1),
+			fmt.Sprintf("Send close with invalid status %d", status),
+			sendFrames(Frame{Fin: true, Opcode: websocket.OpcodeCloseFrame, Payload: closePayload(status, "")}),
+			websocket.CloseProtocolError,
+		))
+	}
+	return cases
+}
+
+// 9.x: large messages and frame length encodings.
+func limitsCases() []Case {
+	header := func(b0 byte, length []byte) func(s *Session) error {
+		return func(s *Session) error {
+			b1 := byte(127)
+			if len(length) == 2 {
+				b1 = 126
+			}
+			if s.Target() == TargetServer {
+				b1 |= 0x80
+			}
+
+			b := append([]byte{b0, b1}, length...)
+			if s.Target() == TargetServer {
+				b = append(b, 0, 0, 0, 0)
+			}
+			return s.SendRaw(b)
+		}
+	}
+
+	largeEcho := func(id, description string, opc websocket.Opcode, size int) Case {
+		c := echoCase(id, description, opc, bytes.Repeat([]byte("*"), size))
+		run := c.Run
+		c.Run = func(s *Session) error {
+			s.timeout = max(s.timeout, 10*time.Second)
+			return run(s)
+		}
+		return c
+	}
+
+	return []Case{
+		largeEcho("9.1.1", "Send text message with payload length 256 KiB", websocket.OpcodeTextFrame, 256<<10),
+		largeEcho("9.1.2", "Send text message with payload length 1 MiB", websocket.OpcodeTextFrame, 1<<20),
+		largeEcho("9.2.1", "Send binary message with payload length 1 MiB", websocket.OpcodeBinaryFrame, 1<<20),
+		largeEcho("9.2.2", "Send binary message with payload length 4 MiB", websocket.OpcodeBinaryFrame, 4<<20),
+		failCase("9.3.1", "Send frame with the most significant bit of the 64 bit length set",
+			header(0x82, []byte{0x80, 0, 0, 0, 0, 0, 0, 0x10}),
+			websocket.CloseProtocolError, websocket.CloseMessageTooBig),
+		failCase("9.3.2", "Send frame with a 16 bit length that fits in 7 bits",
+			sendFrames(Frame{Fin: true, Opcode: websocket.OpcodeTextFrame, Payload: []byte("short"), LenEncoding: LenEncoding16}),
+			websocket.CloseProtocolError),
+		failCase("9.3.3", "Send frame with a 64 bit length that fits in 16 bits",
+			sendFrames(Frame{Fin: true, Opcode: websocket.OpcodeBinaryFrame, Payload: bytes.Repeat([]byte{0xFE}, 200), LenEncoding: LenEncoding64}),
+			websocket.CloseProtocolError),
+		failCase("9.3.4", "Send ping with a 16 bit length",
+			sendFrames(Frame{Fin: true, Opcode: websocket.OpcodePingFrame, Payload: bytes.Repeat([]byte{0xFE}, 200)}),
+			websocket.CloseProtocolError),
+	}
+}
+
+// 10.x: masking direction.
+func maskingCases() []Case {
+	unmasked := func(s *Session) error {
+		return s.SendUnmasked(Frame{Fin: true, Opcode: websocket.OpcodeTextFrame, Payload: textPayload})
+	}
+
+	return []Case{
+		func() Case {
+			c := failCase("10.1.1", "Send unmasked text message from the client", unmasked, websocket.CloseProtocolError)
+			c.Target = TargetServer
+			return c
+		}(),
+		func() Case {
+			c := failCase("10.1.2", "Send masked text message from the server", unmasked, websocket.CloseProtocolError)
+			c.Target = TargetClient
+			return c
+		}(),
+	}
+}
@@ -0,0 +1,64 @@
+package conformance
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// EchoHandler is the server side endpoint the suite expects, built on the
+// websocket package. It is what the suite runs against in CI.
+func EchoHandler(server *websocket.WebSocketServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := server.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		echo(ws)
+	})
+}
+
+// EchoClient dials rawurl with the websocket package and echoes every data
+// message until the connection is closed. It matches the connect argument
+// of RunClient.
+func EchoClient(ctx context.Context, rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+
+	client := &websocket.WebSocketClient{}
+	ws, err := client.DialWithContext(ctx, u, nil)
+	if err != nil {
+		return err
+	}
+	return echo(ws)
+}
+
+func echo(ws websocket.WebSocket) error {
+	defer ws.Close()
+
+	for {
+		msg := ws.ReadMessage()
+		if msg.Err != nil {
+			return msg.Err
+		}
+
+		switch msg.Opcode {
+		case websocket.OpcodePingFrame:
+			if err := ws.WriteMessage(websocket.OpcodePongFrame, msg.Data); err != nil {
+				return err
+			}
+		case websocket.OpcodePongFrame:
+		case websocket.OpcodeCloseFrame:
+			// The close frame has already been answered by ReadMessage.
+			return nil
+		default:
+			if err := ws.WriteMessage(msg.Opcode, msg.Data); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package conformance
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// Length encodings accepted by Frame.LenEncoding. The zero value picks the
+// minimal encoding, the others force a wider one than necessary.
+const (
+	LenEncodingMinimal = 0
+	LenEncoding16      = 16
+	LenEncoding64      = 64
+)
+
+// Frame is a raw frame sent or received by a Session. Unlike the frames
+// produced by the websocket package it can carry any combination of bits, so
+// cases can build frames that violate the protocol on purpose.
+type Frame struct {
+	Fin         bool
+	Rsv         byte
+	Opcode      websocket.Opcode
+	Masked      bool
+	Payload     []byte
+	LenEncoding int
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%s fin=%v rsv=%d masked=%v len=%d", f.Opcode, f.Fin, f.Rsv, f.Masked, len(f.Payload))
+}
+
+// Encode serializes the frame, masking the payload with a fresh key when
+// Masked is set.
+func (f Frame) Encode() []byte {
+	n := len(f.Payload)
+	buf := make([]byte, 0, 14+n)
+
+	b0 := byte(f.Opcode&0xF) | (f.Rsv&0x7)<<4
+	if f.Fin {
+		b0 |= 0x80
+	}
+	buf = append(buf, b0)
+
+	b1 := byte(0)
+	if f.Masked {
+		b1 |= 0x80
+	}
+
+	switch {
+	case f.LenEncoding == LenEncoding64 || n > 0xFFFF:
+		buf = append(buf, b1|127)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(n))
+	case f.LenEncoding == LenEncoding16 || n > 125:
+		buf = append(buf, b1|126)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(n))
+	default:
+		buf = append(buf, b1|byte(n))
+	}
+
+	if !f.Masked {
+		return append(buf, f.Payload...)
+	}
+
+	mask := make([]byte, 4)
+	_, _ = rand.Read(mask)
+	buf = append(buf, mask...)
+
+	start := len(buf)
+	buf = append(buf, f.Payload...)
+	for i := range f.Payload {
+		buf[start+i] ^= mask[i&3]
+	}
+	return buf
+}
+
+var errFrameTooLarge = errors.New("frame payload too large")
+
+// readFrame decodes a single frame without validating it, the caller
+// decides which properties are violations. Payloads above maxPayload are
+// refused to keep a misbehaving peer from exhausting memory.
+func readFrame(r io.Reader, maxPayload int64) (Frame, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return Frame{}, err
+	}
+
+	f := Frame{
+		Fin:    header[0]&0x80 != 0,
+		Rsv:    (header[0] >> 4) & 0x7,
+		Opcode: websocket.Opcode(header[0] & 0xF),
+		Masked: header[1]&0x80 != 0,
+	}
+
+	n := uint64(header[1] & 0x7F)
+	switch n {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return f, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext))
+		f.LenEncoding = LenEncoding16
+	case 127:
+		ext := make([]byte, 8)
+		if _, err := io.ReadFull(r, ext); err != nil {
+			return f, err
+		}
+		n = binary.BigEndian.Uint64(ext)
+		f.LenEncoding = LenEncoding64
+	}
+
+	if n > uint64(maxPayload) {
+		return f, errFrameTooLarge
+	}
+
+	mask := make([]byte, 4)
+	if f.Masked {
+		if _, err := io.ReadFull(r, mask); err != nil {
+			return f, err
+		}
+	}
+
+	f.Payload = make([]byte, n)
+	if _, err := io.ReadFull(r, f.Payload); err != nil {
+		return f, err
+	}
+
+	for i := 0; f.Masked && i < len(f.Payload); i++ {
+		f.Payload[i] ^= mask[i&3]
+	}
+	return f, nil
+}
@@ -0,0 +1,90 @@
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusPass Status = "PASS"
+	StatusFail Status = "FAIL"
+)
+
+// Result is the outcome of a single case.
+type Result struct {
+	ID          string        `json:"id"`
+	Description string        `json:"description"`
+	Status      Status        `json:"status"`
+	Detail      string        `json:"detail,omitempty"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// Report collects the results of a run against one peer.
+type Report struct {
+	Target  Target   `json:"target"`
+	Agent   string   `json:"agent"`
+	Results []Result `json:"results"`
+}
+
+func (t Target) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (r *Report) Passed() int {
+	return r.count(StatusPass)
+}
+
+func (r *Report) Failed() int {
+	return r.count(StatusFail)
+}
+
+func (r *Report) count(status Status) int {
+	n := 0
+	for _, result := range r.Results {
+		if result.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteText writes a human readable table of the results.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Conformance report for %s %s\n\n", r.Target, r.Agent)
+	fmt.Fprintln(tw, "CASE\tRESULT\tDURATION\tDESCRIPTION")
+
+	for _, result := range r.Results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", result.ID, result.Status, result.Duration.Round(time.Millisecond), result.Description)
+		if result.Detail != "" {
+			fmt.Fprintf(tw, "\t\t\t  %s\n", result.Detail)
+		}
+	}
+
+	fmt.Fprintf(tw, "\nPassed %d/%d\n", r.Passed(), len(r.Results))
+	return tw.Flush()
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteReportsJSON writes reports as a single indented JSON array, such as
+// the server and client reports of one run.
+func WriteReportsJSON(w io.Writer, reports []*Report) error {
+	if reports == nil {
+		reports = []*Report{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(reports)
+}
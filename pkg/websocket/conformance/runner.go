@@ -0,0 +1,334 @@
+// Package conformance checks WebSocket peers against RFC 6455 with cases
+// modeled on the Autobahn test suite. The suite speaks raw frames so it can
+// send traffic no well behaved implementation would produce.
+package conformance
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Options tunes a run of the suite.
+type Options struct {
+	// Timeout bounds every expectation, a peer that does not react within
+	// it fails the case. Defaults to one second.
+	Timeout time.Duration
+
+	// Header is sent with every handshake when testing a server.
+	Header http.Header
+}
+
+func (opts Options) timeout() time.Duration {
+	if opts.Timeout > 0 {
+		return opts.Timeout
+	}
+	return time.Second
+}
+
+func appliesTo(c Case, target Target) bool {
+	return c.Target == 0 || c.Target == target
+}
+
+func runCase(c Case, s *Session) Result {
+	start := time.Now()
+	err := c.Run(s)
+
+	result := Result{
+		ID:          c.ID,
+		Description: c.Description,
+		Status:      StatusPass,
+		Duration:    time.Since(start),
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Detail = err.Error()
+	}
+	return result
+}
+
+// RunServer runs cases against the server at rawurl, one connection per
+// case. The server is expected to echo every data message back.
+func RunServer(ctx context.Context, rawurl string, cases []Case, opts Options) *Report {
+	report := &Report{Target: TargetServer, Agent: rawurl}
+
+	for _, c := range cases {
+		if !appliesTo(c, TargetServer) {
+			continue
+		}
+
+		if ctx.Err() != nil {
+			report.Results = append(report.Results, Result{ID: c.ID, Description: c.Description, Status: StatusFail, Detail: ctx.Err().Error()})
+			continue
+		}
+
+		conn, reader, err := dial(ctx, rawurl, opts)
+		if err != nil {
+			report.Results = append(report.Results, Result{ID: c.ID, Description: c.Description, Status: StatusFail, Detail: err.Error()})
+			continue
+		}
+
+		report.Results = append(report.Results, runCase(c, newSession(TargetServer, conn, reader, opts.timeout())))
+		conn.Close()
+	}
+	return report
+}
+
+func dial(ctx context.Context, rawurl string, opts Options) (net.Conn, *bufio.Reader, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		switch u.Scheme {
+		case "ws":
+			host = net.JoinHostPort(u.Hostname(), "80")
+		case "wss":
+			host = net.JoinHostPort(u.Hostname(), "443")
+		}
+	}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "ws":
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", host)
+	case "wss":
+		conn, err = (&tls.Dialer{Config: &tls.Config{ServerName: u.Hostname()}}).DialContext(ctx, "tcp", host)
+	default:
+		return nil, nil, fmt.Errorf("invalid url scheme, expect 'ws' or 'wss' instead of '%s'", u.Scheme)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := newKey()
+	var b strings.Builder
+	fmt.Fprintf(&b, "GET %s HTTP/1.1\r\n", u.RequestURI())
+	fmt.Fprintf(&b, "Host: %s\r\n", u.Host)
+	b.WriteString("Upgrade: websocket\r\n")
+	b.WriteString("Connection: Upgrade\r\n")
+	fmt.Fprintf(&b, "Sec-WebSocket-Key: %s\r\n", key)
+	b.WriteString("Sec-WebSocket-Version: 13\r\n")
+	for name, values := range opts.Header {
+		for _, value := range values {
+			fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+		}
+	}
+	b.WriteString("\r\n")
+
+	conn.SetDeadline(time.Now().Add(opts.timeout()))
+	if _, err := conn.Write([]byte(b.String())); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("handshake: %w", err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		conn.Close()
+		return nil, nil, fmt.Errorf("handshake: expected status 101, received %s", res.Status)
+	}
+
+	if accept := res.Header.Get("Sec-WebSocket-Accept"); accept != acceptKey(key) {
+		conn.Close()
+		return nil, nil, fmt.Errorf("handshake: expected Sec-WebSocket-Accept %q, received %q", acceptKey(key), accept)
+	}
+
+	conn.SetDeadline(time.Time{})
+	return conn, reader, nil
+}
+
+func newKey() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// FuzzingServer plays the server side of the suite to test clients. A client
+// runs case ID by connecting to /runCase?case=ID and echoing every data
+// message it receives; /cases lists the IDs and /report returns the results
+// recorded so far as JSON.
+type FuzzingServer struct {
+	opts  Options
+	cases map[string]Case
+	order []string
+
+	mu      sync.Mutex
+	results []Result
+
+	// onResult, when set, is called after every case.
+	onResult func(Result)
+}
+
+func NewFuzzingServer(cases []Case, opts Options) *FuzzingServer {
+	fs := &FuzzingServer{
+		opts:  opts,
+		cases: map[string]Case{},
+	}
+
+	for _, c := range cases {
+		if appliesTo(c, TargetClient) {
+			fs.cases[c.ID] = c
+			fs.order = append(fs.order, c.ID)
+		}
+	}
+	return fs
+}
+
+func (fs *FuzzingServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/cases":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, strings.Join(fs.order, "\n"))
+	case "/report":
+		w.Header().Set("Content-Type", "application/json")
+		fs.Report(r.URL.Query().Get("agent")).WriteJSON(w)
+	case "/runCase":
+		fs.runCase(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Report returns the results recorded so far.
+func (fs *FuzzingServer) Report(agent string) *Report {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	return &Report{
+		Target:  TargetClient,
+		Agent:   agent,
+		Results: append([]Result(nil), fs.results...),
+	}
+}
+
+func (fs *FuzzingServer) runCase(w http.ResponseWriter, r *http.Request) {
+	c, ok := fs.cases[r.URL.Query().Get("case")]
+	if !ok {
+		http.Error(w, "unknown case", http.StatusNotFound)
+		return
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "expected websocket handshake", http.StatusBadRequest)
+		return
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err := rw.Flush(); err != nil {
+		return
+	}
+
+	result := runCase(c, newSession(TargetClient, conn, rw.Reader, fs.opts.timeout()))
+
+	fs.mu.Lock()
+	fs.results = append(fs.results, result)
+	onResult := fs.onResult
+	fs.mu.Unlock()
+
+	if onResult != nil {
+		onResult(result)
+	}
+}
+
+// RunClient tests a client by serving cases from a local FuzzingServer.
+// connect is called once per case with the URL to dial and must echo every
+// data message until the connection is closed.
+func RunClient(ctx context.Context, cases []Case, opts Options, connect func(ctx context.Context, url string) error) (*Report, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	fs := NewFuzzingServer(cases, opts)
+	resultCh := make(chan Result, len(fs.order))
+	fs.onResult = func(result Result) {
+		select {
+		case resultCh <- result:
+		default:
+		}
+	}
+
+	server := &http.Server{Handler: fs}
+	go server.Serve(ln)
+	defer server.Close()
+
+	report := &Report{Target: TargetClient, Agent: "ws://" + ln.Addr().String()}
+	for _, id := range fs.order {
+		c := fs.cases[id]
+		caseURL := fmt.Sprintf("ws://%s/runCase?case=%s", ln.Addr(), url.QueryEscape(id))
+
+		caseCtx, cancel := context.WithTimeout(ctx, 10*opts.timeout()+10*time.Second)
+		connectErr := make(chan error, 1)
+		go func() { connectErr <- connect(caseCtx, caseURL) }()
+
+		result, err := waitResult(caseCtx, id, resultCh, connectErr, opts.timeout())
+		if err != nil {
+			result = Result{ID: c.ID, Description: c.Description, Status: StatusFail, Detail: err.Error()}
+		}
+		cancel()
+
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+// waitResult waits for the result of case id, skipping late results of
+// earlier cases that timed out.
+func waitResult(ctx context.Context, id string, resultCh <-chan Result, connectErr <-chan error, grace time.Duration) (Result, error) {
+	var (
+		deadline <-chan time.Time
+		err      error
+	)
+
+	for {
+		select {
+		case result := <-resultCh:
+			if result.ID == id {
+				return result, nil
+			}
+		case err = <-connectErr:
+			// The client may legitimately return before the server side
+			// recorded the result, give it a moment to catch up.
+			connectErr = nil
+			deadline = time.After(grace)
+		case <-deadline:
+			return Result{}, fmt.Errorf("client did not run the case: %v", err)
+		case <-ctx.Done():
+			return Result{}, ctx.Err()
+		}
+	}
+}
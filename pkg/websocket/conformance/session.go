@@ -0,0 +1,319 @@
+package conformance
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// Target is the side of the connection that is being tested.
+type Target int
+
+const (
+	// TargetServer tests a server, the suite plays the client.
+	TargetServer Target = iota + 1
+	// TargetClient tests a client, the suite plays the server.
+	TargetClient
+)
+
+func (t Target) String() string {
+	switch t {
+	case TargetServer:
+		return "server"
+	case TargetClient:
+		return "client"
+	default:
+		return "unknown"
+	}
+}
+
+// maxMessageSize bounds every message the suite is willing to buffer.
+const maxMessageSize = 16 << 20
+
+// Session is one raw connection to the peer under test. Cases drive it with
+// frames and state what they expect back; every method returns a descriptive
+// error as soon as the peer deviates from RFC 6455.
+type Session struct {
+	target  Target
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+}
+
+func newSession(target Target, conn net.Conn, reader *bufio.Reader, timeout time.Duration) *Session {
+	return &Session{
+		target:  target,
+		conn:    conn,
+		reader:  reader,
+		timeout: timeout,
+	}
+}
+
+// Target reports which side of the connection is under test.
+func (s *Session) Target() Target {
+	return s.target
+}
+
+// Send writes f, masked as the role played by the suite requires.
+func (s *Session) Send(f Frame) error {
+	f.Masked = s.target == TargetServer
+	return s.SendRaw(f.Encode())
+}
+
+// SendUnmasked writes f with the mask bit inverted from what RFC 6455
+// requires for the role played by the suite.
+func (s *Session) SendUnmasked(f Frame) error {
+	f.Masked = s.target != TargetServer
+	return s.SendRaw(f.Encode())
+}
+
+// SendRaw writes b as is.
+func (s *Session) SendRaw(b []byte) error {
+	s.conn.SetWriteDeadline(time.Now().Add(s.timeout))
+	_, err := s.conn.Write(b)
+	return err
+}
+
+// SendChopped writes f in chunks of size bytes so the peer sees short reads.
+func (s *Session) SendChopped(f Frame, size int) error {
+	f.Masked = s.target == TargetServer
+	b := f.Encode()
+	for len(b) > 0 {
+		n := min(size, len(b))
+		if err := s.SendRaw(b[:n]); err != nil {
+			return err
+		}
+		b = b[n:]
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+// SendMessage writes a single unfragmented data message.
+func (s *Session) SendMessage(opc websocket.Opcode, payload []byte) error {
+	return s.Send(Frame{Fin: true, Opcode: opc, Payload: payload})
+}
+
+// ReadFrame reads the next frame and checks the properties every frame must
+// have regardless of the case: the mask bit matching the peer role and no
+// reserved bits.
+func (s *Session) ReadFrame() (Frame, error) {
+	s.conn.SetReadDeadline(time.Now().Add(s.timeout))
+
+	f, err := readFrame(s.reader, maxMessageSize)
+	if err != nil {
+		return f, err
+	}
+
+	if expectMasked := s.target == TargetClient; f.Masked != expectMasked {
+		return f, fmt.Errorf("received %s with mask=%v, peer is a %s", f, f.Masked, s.target)
+	}
+
+	if f.Rsv != 0 {
+		return f, fmt.Errorf("received %s with reserved bits set", f)
+	}
+	return f, nil
+}
+
+// ReadMessage reads the next data message, reassembling fragments. Control
+// frames are only accepted when they are pongs, which are skipped.
+func (s *Session) ReadMessage() (websocket.Opcode, []byte, error) {
+	var (
+		opc     websocket.Opcode
+		payload []byte
+		started bool
+	)
+
+	for {
+		f, err := s.ReadFrame()
+		if err != nil {
+			return opc, payload, err
+		}
+
+		switch {
+		case f.Opcode == websocket.OpcodePongFrame:
+			continue
+		case f.Opcode.IsControl():
+			return f.Opcode, f.Payload, fmt.Errorf("expected data message, received %s", f)
+		case !started && f.Opcode.IsContinue():
+			return f.Opcode, f.Payload, fmt.Errorf("received continuation without a message in progress")
+		case started && !f.Opcode.IsContinue():
+			return f.Opcode, f.Payload, fmt.Errorf("received %s while a message was in progress", f)
+		}
+
+		if !started {
+			opc, started = f.Opcode, true
+		}
+
+		payload = append(payload, f.Payload...)
+		if len(payload) > maxMessageSize {
+			return opc, payload, errFrameTooLarge
+		}
+
+		if f.Fin {
+			return opc, payload, nil
+		}
+	}
+}
+
+// ExpectMessage reads the next data message and compares it against opc and
+// payload.
+func (s *Session) ExpectMessage(opc websocket.Opcode, payload []byte) error {
+	got, data, err := s.ReadMessage()
+	if err != nil {
+		return fmt.Errorf("expected %s message: %w", opc, err)
+	}
+
+	if got != opc {
+		return fmt.Errorf("expected %s message, received %s", opc, got)
+	}
+
+	if !bytes.Equal(data, payload) {
+		return fmt.Errorf("expected %s message of %d bytes, received %d different bytes", opc, len(payload), len(data))
+	}
+	return nil
+}
+
+// ExpectPong reads the next frame and checks it is a pong echoing payload.
+func (s *Session) ExpectPong(payload []byte) error {
+	f, err := s.ReadFrame()
+	if err != nil {
+		return fmt.Errorf("expected pong: %w", err)
+	}
+
+	if f.Opcode != websocket.OpcodePongFrame {
+		return fmt.Errorf("expected pong, received %s", f)
+	}
+
+	if !f.Fin {
+		return fmt.Errorf("received fragmented pong")
+	}
+
+	if !bytes.Equal(f.Payload, payload) {
+		return fmt.Errorf("expected pong payload %q, received %q", payload, f.Payload)
+	}
+	return nil
+}
+
+// ExpectNothing checks the peer stays silent for d.
+func (s *Session) ExpectNothing(d time.Duration) error {
+	s.conn.SetReadDeadline(time.Now().Add(d))
+	defer s.conn.SetReadDeadline(time.Time{})
+
+	if _, err := s.reader.Peek(1); err != nil {
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			return nil
+		}
+		return fmt.Errorf("expected connection to stay open: %w", err)
+	}
+
+	f, _ := readFrame(s.reader, maxMessageSize)
+	return fmt.Errorf("expected no frame, received %s", f)
+}
+
+// ExpectClose reads the next frame and checks it is a close frame carrying
+// one of codes. CloseNoStatusReceived in codes accepts an empty close body.
+// When the suite plays the client it then waits for the server to drop the
+// TCP connection as RFC 6455 section 7.1.1 requires.
+func (s *Session) ExpectClose(codes ...websocket.CloseStatus) error {
+	f, err := s.ReadFrame()
+	if err != nil {
+		return fmt.Errorf("expected close frame: %w", err)
+	}
+
+	if f.Opcode != websocket.OpcodeCloseFrame {
+		return fmt.Errorf("expected close frame, received %s", f)
+	}
+
+	if err := checkCloseFrame(f, codes); err != nil {
+		return err
+	}
+
+	if s.target == TargetServer {
+		return s.expectEOF()
+	}
+	return nil
+}
+
+// ExpectFail checks the peer fails the connection, either by sending a close
+// frame with one of codes or by dropping the TCP connection. Receiving a
+// data message or no reaction at all before the timeout fails the case.
+func (s *Session) ExpectFail(codes ...websocket.CloseStatus) error {
+	for {
+		f, err := s.ReadFrame()
+		if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || isConnReset(err) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("expected peer to fail the connection: %w", err)
+		}
+
+		switch f.Opcode {
+		case websocket.OpcodePongFrame:
+			continue
+		case websocket.OpcodeCloseFrame:
+			return checkCloseFrame(f, codes)
+		default:
+			return fmt.Errorf("expected peer to fail the connection, received %s", f)
+		}
+	}
+}
+
+// Close runs a clean close handshake initiated by the suite.
+func (s *Session) Close() error {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(websocket.CloseNormalClosure))
+	if err := s.Send(Frame{Fin: true, Opcode: websocket.OpcodeCloseFrame, Payload: payload}); err != nil {
+		return err
+	}
+	return s.ExpectClose(websocket.CloseNormalClosure)
+}
+
+func (s *Session) expectEOF() error {
+	s.conn.SetReadDeadline(time.Now().Add(s.timeout))
+
+	if _, err := s.reader.Peek(1); err == nil {
+		return fmt.Errorf("expected server to close the connection after the close handshake")
+	} else if !errors.Is(err, io.EOF) && !isConnReset(err) {
+		return fmt.Errorf("expected server to close the connection: %w", err)
+	}
+	return nil
+}
+
+func checkCloseFrame(f Frame, codes []websocket.CloseStatus) error {
+	if len(f.Payload) == 0 {
+		if len(codes) == 0 || slices.Contains(codes, websocket.CloseNoStatusReceived) {
+			return nil
+		}
+		return fmt.Errorf("expected close status %v, received empty close frame", codes)
+	}
+
+	if len(f.Payload) == 1 {
+		return fmt.Errorf("received close frame with 1 byte payload")
+	}
+
+	if !utf8.Valid(f.Payload[2:]) {
+		return fmt.Errorf("received close reason that is not valid UTF-8")
+	}
+
+	code := websocket.CloseStatus(binary.BigEndian.Uint16(f.Payload))
+	if len(codes) > 0 && !slices.Contains(codes, code) {
+		return fmt.Errorf("expected close status %v, received %d", codes, code)
+	}
+	return nil
+}
+
+func isConnReset(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && !opErr.Timeout()
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/binary"
 	"errors"
 	"io"
+	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 type WebSocket interface {
@@ -21,17 +24,67 @@ type WebSocket interface {
 
 	RemoteAddr() net.Addr
 
+	// SetDeadline, SetReadDeadline and SetWriteDeadline set the deadlines
+	// of the underlying connection. No deadline is set by default.
+	SetDeadline(t time.Time) error
+
+	SetReadDeadline(t time.Time) error
+
+	SetWriteDeadline(t time.Time) error
+
 	IsClosed() bool
 
+	Role() Role
+
+	// Subprotocol returns the subprotocol negotiated during the opening
+	// handshake, or an empty string when there is none.
+	Subprotocol() string
+
 	Close() error
 }
 
+// Role is the side of the connection a WebSocket plays. It decides the
+// masking direction: clients mask every frame they send, servers never do.
+//
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.1
+type Role int
+
+const (
+	RoleServer Role = iota
+	RoleClient
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleServer:
+		return "server"
+	case RoleClient:
+		return "client"
+	default:
+		return "unknown"
+	}
+}
+
 func NewConn(connection net.Conn, reader *bufio.Reader, writer *bufio.Writer, isClient bool) WebSocket {
-	return &webSocketConn{
-		conn:   connection,
-		reader: reader,
-		writer: writer,
+	// The reader may hold bytes the peer sent right after the handshake, so
+	// frames are always read through it.
+	if reader == nil {
+		reader = bufio.NewReader(connection)
 	}
+
+	messages := newMessageReader(reader)
+	messages.checkMask = true
+	messages.expectMasked = !isClient
+
+	c := &webSocketConn{
+		conn:     connection,
+		reader:   reader,
+		writer:   writer,
+		messages: messages,
+		isClient: isClient,
+	}
+	messages.trace = c
+	return c
 }
 
 type webSocketConn struct {
@@ -40,11 +93,23 @@ type webSocketConn struct {
 	reader *bufio.Reader
 	writer *bufio.Writer
 
+	messages *messageReader
+
 	readMu  sync.Mutex
 	writeMu sync.Mutex
 
-	isClient bool
-	isClosed bool
+	isClient    bool
+	subprotocol string
+	extensions  extensionPipeline
+	trace       *ConnTrace
+	metrics     *Metrics
+	logger      atomic.Pointer[connLogger]
+	isClosed    atomic.Bool
+	closeSent   bool
+
+	// closeErr is set once a close frame has been received from the peer.
+	// Like closeSent, it is written holding writeMu.
+	closeErr *CloseError
 }
 
 func (c *webSocketConn) LocalAddr() net.Addr {
@@ -55,12 +120,72 @@ func (c *webSocketConn) RemoteAddr() net.Addr {
 	return c.conn.RemoteAddr()
 }
 
+func (c *webSocketConn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+func (c *webSocketConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *webSocketConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func (c *webSocketConn) Role() Role {
+	if c.isClient {
+		return RoleClient
+	}
+	return RoleServer
+}
+
+func (c *webSocketConn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// setExtensions installs the extensions negotiated during the opening
+// handshake.
+func (c *webSocketConn) setExtensions(extensions extensionPipeline) {
+	c.extensions = extensions
+	c.messages.extensions = extensions
+	c.messages.rsv = extensions.rsv()
+}
+
+// setTrace installs the ConnTrace of the connection, before it is used.
+func (c *webSocketConn) setTrace(trace *ConnTrace) {
+	c.trace = trace
+}
+
+// frame implements frameTracer, running the ConnTrace of the connection and
+// logging the frame.
+func (c *webSocketConn) frame(written bool, opcode Opcode, length int64, fin bool, start time.Time) {
+	c.trace.frame(written, opcode, length, fin, start)
+	if l := c.logger.Load(); l != nil {
+		l.frame(written, opcode, length, fin, start)
+	}
+}
+
+// setMetrics counts the connection, now open, and its activity in m.
+func (c *webSocketConn) setMetrics(m *Metrics) {
+	c.metrics = m
+	m.opened(c.Role())
+}
+
+// setLogger logs the connection to logger, with args added to every record.
+func (c *webSocketConn) setLogger(logger *slog.Logger, frameLevel slog.Leveler, args ...any) {
+	if logger != nil {
+		c.logger.Store(newConnLogger(logger.With(args...), frameLevel))
+	}
+}
+
 func (c *webSocketConn) IsClosed() bool {
-	return c.isClosed
+	return c.isClosed.Load()
 }
 
 func (c *webSocketConn) Close() error {
-	c.isClosed = true
+	if !c.isClosed.Swap(true) {
+		c.metrics.closed(c.Role())
+	}
 	return c.conn.Close()
 }
 
@@ -68,28 +193,141 @@ func (c *webSocketConn) WriteMessage(opc Opcode, payload []byte) error {
 	c.writeMu.Lock()
 	defer c.writeMu.Unlock()
 
-	c.conn.SetWriteDeadline(time.Now().Add(time.Second * 2))
+	return c.writeMessage(opc, payload)
+}
 
-	buf := make([]byte, 512)
-	writer := NewFrameWriter(opc, c.conn, buf, c.isClient)
-	_, err := writer.Write(payload)
+func (c *webSocketConn) writeMessage(opc Opcode, payload []byte) error {
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	n := len(payload)
+
+	var rsv byte
+	if len(c.extensions) > 0 && opc.IsData() {
+		m := ExtensionFrame{Opcode: opc, Fin: true, Payload: payload}
+		if err := c.extensions.writeMessage(&m); err != nil {
+			c.metrics.writeError()
+			return wrapOpError("write", err)
+		}
+		payload, rsv = m.Payload, m.RSV
+	}
 
-	return err
+	buf := make([]byte, 512)
+	writer := NewFrameWriter(opc, c.conn, buf, c.isClient).(*frameWriter)
+	writer.rsv = rsv
+	writer.extensions = c.extensions
+	writer.trace = c
+	if _, err := writer.Write(payload); err != nil {
+		c.metrics.writeError()
+		err = wrapOpError("write", err)
+		if l := c.logger.Load(); l != nil {
+			l.failure("write", err)
+		}
+		return err
+	}
+	c.metrics.message(directionOut, opc, n)
+
+	if opc.IsClose() {
+		c.closeSent = true
+		if closeErr, err := parseClosePayload(payload); err == nil {
+			c.trace.close(true, closeErr)
+			c.metrics.closeCode(directionOut, closeErr.Code)
+			if l := c.logger.Load(); l != nil {
+				l.close(true, closeErr, c.closeInitiator(c.closeErr == nil))
+			}
+		}
+	}
+	return nil
 }
 
 func (c *webSocketConn) WriteCloseMessage(status CloseStatus, payload []byte) error {
-	if len(payload) > 125 {
-		return errors.New("too large")
+	if !status.IsValidOnWire() {
+		return ErrInvalidCloseStatus
 	}
 
-	buf := make([]byte, 0, 125)
-	binary.BigEndian.AppendUint16(buf, uint16(status))
-	buf = append(buf, payload...)
+	if len(payload) > 123 {
+		return ErrCloseTooLarge
+	}
+
+	return c.WriteMessage(OpcodeCloseFrame, formatClosePayload(status, payload))
+}
 
-	err := c.WriteMessage(OpcodeCloseFrame, buf)
+// CloseHandshakeTimeout is how long the side starting the close handshake
+// waits for the peer to answer its close frame before dropping the
+// connection.
+const CloseHandshakeTimeout = 5 * time.Second
+
+// StartClose sends a close frame with status and reason and sets the read
+// deadline of ws CloseHandshakeTimeout ahead, so the read waiting for the
+// answer of the peer gives up then. The deadline is also set when a close
+// frame was sent already, StartClose then returning ErrCloseSent.
+func StartClose(ws WebSocket, status CloseStatus, reason []byte) error {
+	err := ws.WriteCloseMessage(status, reason)
+	if err == nil || errors.Is(err, ErrCloseSent) {
+		ws.SetReadDeadline(time.Now().Add(CloseHandshakeTimeout))
+	}
 	return err
 }
 
+// formatClosePayload builds the body of a close frame. CloseNoStatusReceived
+// is never sent on the wire, it is encoded as an empty body instead.
+func formatClosePayload(status CloseStatus, reason []byte) []byte {
+	if status == CloseNoStatusReceived {
+		return []byte{}
+	}
+
+	buf := make([]byte, 0, 2+len(reason))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(status))
+	return append(buf, reason...)
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.5.1
+func parseClosePayload(payload []byte) (*CloseError, error) {
+	switch len(payload) {
+	case 0:
+		return &CloseError{Code: CloseNoStatusReceived}, nil
+	case 1:
+		return nil, ErrBadClosePayload
+	}
+
+	status := CloseStatus(binary.BigEndian.Uint16(payload))
+	if !status.IsValidOnWire() {
+		return nil, ErrInvalidCloseStatus
+	}
+
+	if !utf8.Valid(payload[2:]) {
+		return nil, ErrInvalidUTF8
+	}
+
+	return &CloseError{
+		Code: status,
+		Text: string(payload[2:]),
+	}, nil
+}
+
+// fail tears down the connection after a read error. Protocol errors are
+// reported to the peer with their matching close status first.
+func (c *webSocketConn) fail(err error) error {
+	if l := c.logger.Load(); l != nil {
+		l.failure("read", wrapOpError("read", err))
+	}
+
+	var pe *ProtocolError
+	if errors.As(err, &pe) {
+		reason := []byte(pe.Reason)
+		if len(reason) > 123 {
+			reason = reason[:123]
+		}
+
+		c.writeMu.Lock()
+		_ = c.writeMessage(OpcodeCloseFrame, formatClosePayload(pe.Status, reason))
+		c.writeMu.Unlock()
+
+		_ = c.Close()
+	}
+	return wrapOpError("read", err)
+}
+
 type Message struct {
 	Opcode Opcode
 	Data   []byte
@@ -102,29 +340,75 @@ func (m *Message) String() string {
 
 // https://datatracker.ietf.org/doc/html/rfc6455#section-5.2
 func (c *webSocketConn) ReadMessage() Message {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	if c.closeErr != nil {
+		return Message{
+			Err: c.closeErr,
+		}
+	}
+
 	if c.IsClosed() {
 		return Message{
 			Err: io.EOF,
 		}
 	}
 
-	c.readMu.Lock()
-	defer c.readMu.Unlock()
-
-	c.conn.SetReadDeadline(time.Now().Add(time.Second * 2))
-
-	reader := NewFrameReader(c.conn)
+	opc, buf, err := c.messages.next()
 
 	msg := Message{}
-	msg.Opcode = reader.Opcode()
+	msg.Opcode = opc
 
-	if msg.Err == nil {
-		msg.Data, msg.Err = io.ReadAll(reader)
+	if err != nil {
+		c.metrics.readError()
+		msg.Err = c.fail(err)
+		return msg
+	}
+
+	msg.Data = buf.Bytes()
+	c.metrics.message(directionIn, opc, len(msg.Data))
+	if msg.Opcode.IsClose() {
+		msg.Err = c.handleClose(msg.Data)
 	}
 
 	return msg
 }
 
+// closeInitiator names the role of the side that started the closing
+// handshake, this one when local is set.
+func (c *webSocketConn) closeInitiator(local bool) string {
+	if local == c.isClient {
+		return RoleClient.String()
+	}
+	return RoleServer.String()
+}
+
+// handleClose records the close frame received from the peer and answers it
+// with the same status if no close frame has been sent yet.
+func (c *webSocketConn) handleClose(payload []byte) error {
+	closeErr, err := parseClosePayload(payload)
+	if err != nil {
+		return c.fail(err)
+	}
+
+	// closeErr and closeSent are shared with the write path.
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.closeErr = closeErr
+	c.trace.close(false, closeErr)
+	c.metrics.closeCode(directionIn, closeErr.Code)
+	if l := c.logger.Load(); l != nil {
+		l.close(false, closeErr, c.closeInitiator(c.closeSent))
+	}
+
+	if !c.closeSent {
+		_ = c.writeMessage(OpcodeCloseFrame, formatClosePayload(closeErr.Code, nil))
+	}
+	return nil
+}
+
 func (c *webSocketConn) MessageIter() <-chan Message {
 	ch := make(chan Message)
 
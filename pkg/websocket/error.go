@@ -3,20 +3,168 @@ package websocket
 import (
 	"errors"
 	"fmt"
+	"net"
+	"net/url"
+	"slices"
 	"strings"
 )
 
 var (
-	ErrBadUpgrade           = errors.New("websocket: bad upgrade")
-	ErrBadHandshake         = errors.New("websocket: bad handshake")
-	ErrMethodNotAllowed     = errors.New("websocket: method not allowed")
-	ErrBadOpcode            = errors.New("websocket: bad opcode")
-	ErrUnexpectedPayloadLen = errors.New("websocket: unexpected payloadLen")
+	ErrBadUpgrade       = errors.New("websocket: bad upgrade")
+	ErrBadHandshake     = errors.New("websocket: bad handshake")
+	ErrMethodNotAllowed = errors.New("websocket: method not allowed")
+	ErrCloseSent        = errors.New("websocket: close sent")
+	ErrCloseTooLarge    = errors.New("websocket: close payload too large")
+	ErrHeaderNotAllowed = errors.New("websocket: header not allowed")
 )
 
+// Protocol violations detected while reading frames. Each one maps to the
+// close status that is sent to the peer before the connection is torn down.
+var (
+	ErrBadOpcode              = newProtocolError(CloseProtocolError, "bad opcode")
+	ErrUnexpectedPayloadLen   = newProtocolError(CloseProtocolError, "unexpected payloadLen")
+	ErrFragmentedControlFrame = newProtocolError(CloseProtocolError, "control frames must not be fragmented")
+	ErrUnexpectedContinuation = newProtocolError(CloseProtocolError, "unexpected continuation frame")
+	ErrExpectedContinuation   = newProtocolError(CloseProtocolError, "unexpected new frame when continuation expected")
+	ErrReservedBits           = newProtocolError(CloseProtocolError, "reserved bits are set")
+	ErrBadClosePayload        = newProtocolError(CloseProtocolError, "bad close frame payload")
+	ErrControlFrameTooLarge   = newProtocolError(CloseProtocolError, "control frame payload exceeds 125 bytes")
+	ErrNonMinimalLength       = newProtocolError(CloseProtocolError, "payload length is not minimally encoded")
+	ErrInvalidUTF8            = newProtocolError(CloseInvalidFramePayloadData, "invalid UTF-8 in text payload")
+	ErrMessageTooBig          = newProtocolError(CloseMessageTooBig, "message exceeds the read limit")
+	ErrUnmaskedFrame          = newProtocolError(CloseProtocolError, "received unmasked frame from client")
+	ErrMaskedFrame            = newProtocolError(CloseProtocolError, "received masked frame from server")
+)
+
+// ProtocolError reports a violation of RFC 6455 by the peer. Status is the
+// close status sent to the peer when the error is detected.
+type ProtocolError struct {
+	Status CloseStatus
+	Reason string
+}
+
+func newProtocolError(status CloseStatus, reason string) error {
+	return &ProtocolError{Status: status, Reason: reason}
+}
+
+func (e *ProtocolError) Error() string {
+	return "websocket: " + e.Reason
+}
+
+// CloseError is returned by ReadMessage once the peer has closed the
+// connection with a close frame.
+type CloseError struct {
+	Code CloseStatus
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	if e.Text == "" {
+		return fmt.Sprintf("websocket: close %d (%s)", e.Code, e.Code)
+	}
+	return fmt.Sprintf("websocket: close %d (%s): %s", e.Code, e.Code, e.Text)
+}
+
+// TimeoutError is returned when a read or write deadline expires. It
+// implements net.Error so callers can keep using the usual Timeout() check.
+type TimeoutError struct {
+	Op  string
+	Err error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("websocket: %s timeout: %v", e.Op, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+func (e *TimeoutError) Temporary() bool {
+	return true
+}
+
+var _ net.Error = (*TimeoutError)(nil)
+
+// HandshakeError is returned when the client stops following the redirects
+// of the opening handshake. URLs is the redirect chain: the URL of the dial,
+// then every location the client was redirected to, the last one being the
+// location it did not follow.
+type HandshakeError struct {
+	URLs []*url.URL
+	Err  error
+}
+
+func (e *HandshakeError) Error() string {
+	chain := make([]string, len(e.URLs))
+	for i, u := range e.URLs {
+		chain[i] = u.String()
+	}
+	return fmt.Sprintf("%v (redirects: %s)", e.Err, strings.Join(chain, " -> "))
+}
+
+func (e *HandshakeError) Unwrap() error {
+	return e.Err
+}
+
+// IsCloseError reports whether err is a *CloseError with one of the given
+// codes. With no codes, any *CloseError matches.
+func IsCloseError(err error, codes ...CloseStatus) bool {
+	var ce *CloseError
+	if !errors.As(err, &ce) {
+		return false
+	}
+	return len(codes) == 0 || slices.Contains(codes, ce.Code)
+}
+
+// IsUnexpectedCloseError reports whether err is a *CloseError whose code is
+// not one of expectedCodes.
+func IsUnexpectedCloseError(err error, expectedCodes ...CloseStatus) bool {
+	var ce *CloseError
+	if !errors.As(err, &ce) {
+		return false
+	}
+	return !slices.Contains(expectedCodes, ce.Code)
+}
+
+func isWebSocketError(err error) bool {
+	var (
+		pe *ProtocolError
+		ce *CloseError
+		te *TimeoutError
+		he *HandshakeError
+	)
+	if errors.As(err, &pe) || errors.As(err, &ce) || errors.As(err, &te) || errors.As(err, &he) {
+		return true
+	}
+
+	for _, sentinel := range []error{ErrBadUpgrade, ErrBadHandshake, ErrMethodNotAllowed, ErrCloseSent, ErrCloseTooLarge, ErrHeaderNotAllowed} {
+		if errors.Is(err, sentinel) {
+			return true
+		}
+	}
+	return false
+}
+
 func wrapError(err error) error {
-	if strings.HasPrefix(err.Error(), "websocket:") {
+	return wrapOpError("", err)
+}
+
+func wrapOpError(op string, err error) error {
+	if err == nil || isWebSocketError(err) {
 		return err
 	}
+
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		if op == "" {
+			op = "i/o"
+		}
+		return &TimeoutError{Op: op, Err: err}
+	}
 	return fmt.Errorf("websocket: %w", err)
 }
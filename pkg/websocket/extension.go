@@ -0,0 +1,455 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Reserved bits of the first byte of a frame header, which extensions may
+// claim to give frames a meaning of their own.
+const (
+	RSV1 = rsv1BitMask
+	RSV2 = rsv2BitMask
+	RSV3 = rsv3BitMask
+)
+
+// ErrBadExtensions is returned for a Sec-WebSocket-Extensions header that
+// cannot be parsed.
+var ErrBadExtensions = errors.New("websocket: malformed Sec-WebSocket-Extensions")
+
+// Extension is a WebSocket extension a client offers and a server accepts
+// during the opening handshake. It is shared by every connection, the
+// state of a negotiated extension lives in the ExtensionConn it returns.
+//
+// https://datatracker.ietf.org/doc/html/rfc6455#section-9
+type Extension interface {
+	// Name returns the extension token, e.g. "permessage-deflate".
+	Name() string
+
+	// Offer returns the parameters a client offers.
+	Offer() []ExtensionParam
+
+	// Accept is called on the server with the parameters offered by a
+	// client. It returns the extension for the connection and the
+	// parameters of the response, or a nil ExtensionConn to decline the
+	// offer.
+	Accept(params []ExtensionParam) (ExtensionConn, []ExtensionParam)
+
+	// Accepted is called on the client with the parameters of the server
+	// response. An error fails the handshake.
+	Accepted(params []ExtensionParam) (ExtensionConn, error)
+}
+
+// ExtensionConn is an extension negotiated on one connection. It transforms
+// frames by implementing FrameTransformer, messages by implementing
+// MessageTransformer, or both.
+//
+// On the write path, the transforms of the negotiated extensions run in the
+// order of the Sec-WebSocket-Extensions response header; on the read path
+// they run in the reverse order.
+type ExtensionConn interface {
+	// RSV returns the reserved bits the extension may set, any combination
+	// of RSV1, RSV2 and RSV3. Frames with other reserved bits set fail the
+	// connection with CloseProtocolError.
+	RSV() byte
+}
+
+// ExtensionFrame is a frame, or a whole data message, going through the
+// transforms of the negotiated extensions. A transform may replace Payload
+// and set or clear the reserved bits it claims.
+type ExtensionFrame struct {
+	Opcode Opcode
+
+	// Fin is always true for a message.
+	Fin bool
+
+	// RSV holds the reserved bits of the frame, or of the first frame of a
+	// message.
+	RSV byte
+
+	Payload []byte
+}
+
+// FrameTransformer transforms every frame, control frames included, right
+// before it is written and right after it is read.
+type FrameTransformer interface {
+	WriteFrame(f *ExtensionFrame) error
+	ReadFrame(f *ExtensionFrame) error
+}
+
+// MessageTransformer transforms data messages before they are split into
+// frames, and after their frames are reassembled. Text messages are checked
+// for valid UTF-8 after the read transforms.
+type MessageTransformer interface {
+	WriteMessage(m *ExtensionFrame) error
+	ReadMessage(m *ExtensionFrame) error
+}
+
+// ExtensionParam is a parameter of an extension. Value is empty for a
+// parameter without a value.
+type ExtensionParam struct {
+	Name  string
+	Value string
+}
+
+// ExtensionSpec is one element of a Sec-WebSocket-Extensions header: an
+// extension token and its parameters, in order.
+type ExtensionSpec struct {
+	Name   string
+	Params []ExtensionParam
+}
+
+// Param returns the value of the parameter name and whether it is present.
+func (s ExtensionSpec) Param(name string) (string, bool) {
+	for _, p := range s.Params {
+		if p.Name == name {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// ParseExtensions parses every Sec-WebSocket-Extensions value of header, in
+// order.
+//
+//	Sec-WebSocket-Extensions = extension-list
+//	extension-list = 1#extension
+//	extension = extension-token *( ";" extension-param )
+//	extension-param = token [ "=" (token | quoted-string) ]
+//
+// https://datatracker.ietf.org/doc/html/rfc6455#section-9.1
+func ParseExtensions(header http.Header) ([]ExtensionSpec, error) {
+	var specs []ExtensionSpec
+	for _, value := range header.Values("Sec-WebSocket-Extensions") {
+		p := extensionParser{s: value}
+		for {
+			p.skipSpace()
+			if p.done() {
+				break
+			}
+
+			// Empty list elements are allowed by the # rule.
+			if p.consume(',') {
+				continue
+			}
+
+			spec, err := p.extension()
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v in %q", ErrBadExtensions, err, value)
+			}
+			specs = append(specs, spec)
+
+			p.skipSpace()
+			if !p.done() && !p.consume(',') {
+				return nil, fmt.Errorf("%w: unexpected %q in %q", ErrBadExtensions, p.s[p.i], value)
+			}
+		}
+	}
+	return specs, nil
+}
+
+// FormatExtensions returns the Sec-WebSocket-Extensions value listing specs.
+// Values that are not tokens are quoted.
+func FormatExtensions(specs []ExtensionSpec) string {
+	var b strings.Builder
+	for i, spec := range specs {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+
+		b.WriteString(spec.Name)
+		for _, param := range spec.Params {
+			b.WriteString("; ")
+			b.WriteString(param.Name)
+			if param.Value == "" {
+				continue
+			}
+
+			b.WriteByte('=')
+			if isToken(param.Value) {
+				b.WriteString(param.Value)
+			} else {
+				b.WriteByte('"')
+				for j := 0; j < len(param.Value); j++ {
+					if c := param.Value[j]; c == '"' || c == '\\' {
+						b.WriteByte('\\')
+					}
+					b.WriteByte(param.Value[j])
+				}
+				b.WriteByte('"')
+			}
+		}
+	}
+	return b.String()
+}
+
+type extensionParser struct {
+	s string
+	i int
+}
+
+func (p *extensionParser) done() bool {
+	return p.i >= len(p.s)
+}
+
+func (p *extensionParser) skipSpace() {
+	for !p.done() && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+}
+
+func (p *extensionParser) consume(c byte) bool {
+	if !p.done() && p.s[p.i] == c {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *extensionParser) token() string {
+	start := p.i
+	for !p.done() && isTokenChar(p.s[p.i]) {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+func (p *extensionParser) quotedString() (string, error) {
+	var b strings.Builder
+	for p.i++; !p.done(); p.i++ {
+		switch c := p.s[p.i]; c {
+		case '"':
+			p.i++
+			return b.String(), nil
+		case '\\':
+			p.i++
+			if p.done() {
+				return "", errors.New("unterminated quoted-string")
+			}
+			b.WriteByte(p.s[p.i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", errors.New("unterminated quoted-string")
+}
+
+func (p *extensionParser) extension() (ExtensionSpec, error) {
+	spec := ExtensionSpec{Name: p.token()}
+	if spec.Name == "" {
+		return spec, errors.New("missing extension token")
+	}
+
+	for {
+		p.skipSpace()
+		if !p.consume(';') {
+			return spec, nil
+		}
+
+		p.skipSpace()
+		param := ExtensionParam{Name: p.token()}
+		if param.Name == "" {
+			return spec, errors.New("missing parameter name")
+		}
+
+		p.skipSpace()
+		if p.consume('=') {
+			p.skipSpace()
+			if !p.done() && p.s[p.i] == '"' {
+				value, err := p.quotedString()
+				if err != nil {
+					return spec, err
+				}
+				param.Value = value
+			} else {
+				param.Value = p.token()
+			}
+
+			if param.Value == "" {
+				return spec, fmt.Errorf("missing value of parameter %q", param.Name)
+			}
+		}
+		spec.Params = append(spec.Params, param)
+	}
+}
+
+// https://datatracker.ietf.org/doc/html/rfc7230#section-3.2.6
+func isTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isTokenChar(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// extensionPipeline holds the extensions negotiated on a connection, in the
+// order of the Sec-WebSocket-Extensions response header.
+type extensionPipeline []ExtensionConn
+
+// rsv returns the reserved bits claimed by the extensions.
+func (p extensionPipeline) rsv() byte {
+	var rsv byte
+	for _, ext := range p {
+		rsv |= ext.RSV()
+	}
+	return rsv
+}
+
+func (p extensionPipeline) writeMessage(m *ExtensionFrame) error {
+	for _, ext := range p {
+		if t, ok := ext.(MessageTransformer); ok {
+			if err := t.WriteMessage(m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p extensionPipeline) readMessage(m *ExtensionFrame) error {
+	for i := len(p) - 1; i >= 0; i-- {
+		if t, ok := p[i].(MessageTransformer); ok {
+			if err := t.ReadMessage(m); err != nil {
+				return extensionError(err)
+			}
+		}
+	}
+	return nil
+}
+
+func (p extensionPipeline) writeFrame(f *ExtensionFrame) error {
+	for _, ext := range p {
+		if t, ok := ext.(FrameTransformer); ok {
+			if err := t.WriteFrame(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (p extensionPipeline) readFrame(f *ExtensionFrame) error {
+	for i := len(p) - 1; i >= 0; i-- {
+		if t, ok := p[i].(FrameTransformer); ok {
+			if err := t.ReadFrame(f); err != nil {
+				return extensionError(err)
+			}
+		}
+	}
+	return nil
+}
+
+// extensionError turns an error of a read transform into a ProtocolError,
+// so the connection is failed with a close status. A transform may return
+// a *ProtocolError to pick the status.
+func extensionError(err error) error {
+	var pe *ProtocolError
+	if errors.As(err, &pe) {
+		return err
+	}
+	return newProtocolError(CloseProtocolError, "extension: "+err.Error())
+}
+
+// acceptExtensions picks, for every extension of the server, the first
+// offer of the client it accepts. Offers whose reserved bits are already
+// claimed are declined.
+func acceptExtensions(extensions []Extension, offers []ExtensionSpec) (extensionPipeline, []ExtensionSpec) {
+	var (
+		pipeline extensionPipeline
+		response []ExtensionSpec
+		accepted = map[string]bool{}
+		rsv      byte
+	)
+
+	for _, offer := range offers {
+		if accepted[offer.Name] {
+			continue
+		}
+
+		for _, ext := range extensions {
+			if ext.Name() != offer.Name {
+				continue
+			}
+
+			conn, params := ext.Accept(offer.Params)
+			if conn == nil || conn.RSV()&rsv != 0 {
+				continue
+			}
+
+			rsv |= conn.RSV()
+			accepted[offer.Name] = true
+			pipeline = append(pipeline, conn)
+			response = append(response, ExtensionSpec{Name: offer.Name, Params: params})
+			break
+		}
+	}
+	return pipeline, response
+}
+
+// offerExtensions returns the Sec-WebSocket-Extensions elements of a client.
+func offerExtensions(extensions []Extension) []ExtensionSpec {
+	offers := make([]ExtensionSpec, 0, len(extensions))
+	for _, ext := range extensions {
+		offers = append(offers, ExtensionSpec{Name: ext.Name(), Params: ext.Offer()})
+	}
+	return offers
+}
+
+// acceptedExtensions checks the extensions of a server response against
+// the ones offered by the client.
+func acceptedExtensions(extensions []Extension, header http.Header) (extensionPipeline, error) {
+	specs, err := ParseExtensions(header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadHandshake, err)
+	}
+
+	var (
+		pipeline extensionPipeline
+		used     = map[string]bool{}
+		rsv      byte
+	)
+
+	for _, spec := range specs {
+		var ext Extension
+		for _, e := range extensions {
+			if e.Name() == spec.Name {
+				ext = e
+				break
+			}
+		}
+
+		if ext == nil || used[spec.Name] {
+			return nil, fmt.Errorf("%w: unexpected extension %q", ErrBadHandshake, spec.Name)
+		}
+		used[spec.Name] = true
+
+		conn, err := ext.Accepted(spec.Params)
+		if err != nil {
+			return nil, fmt.Errorf("%w: extension %q: %w", ErrBadHandshake, spec.Name, err)
+		}
+		if conn == nil {
+			return nil, fmt.Errorf("%w: extension %q accepted without a connection", ErrBadHandshake, spec.Name)
+		}
+
+		if conn.RSV()&rsv != 0 {
+			return nil, fmt.Errorf("%w: extension %q reuses reserved bits", ErrBadHandshake, spec.Name)
+		}
+		rsv |= conn.RSV()
+		pipeline = append(pipeline, conn)
+	}
+	return pipeline, nil
+}
@@ -4,8 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
-	"errors"
 	"io"
+	"time"
+	"unicode/utf8"
 )
 
 const (
@@ -13,6 +14,12 @@ const (
 	frameMaskSize         = 4
 	frameMaxPayloadLength = 8
 	frameMaxHeaderSize    = frameMinHeaderSize + frameMaxPayloadLength + frameMaskSize
+
+	// https://datatracker.ietf.org/doc/html/rfc6455#section-5.5
+	frameMaxControlPayload = 125
+
+	// defaultReadLimit bounds the size of a reassembled message.
+	defaultReadLimit = 64 << 20
 )
 
 type FrameReader interface {
@@ -24,13 +31,15 @@ type FrameReader interface {
 }
 
 type frameReader struct {
-	opcode     Opcode
-	buffer     *bytes.Buffer
-	compressed bool
-	err        error
+	opcode Opcode
+	buffer *bytes.Buffer
+	err    error
 }
 
 func (frameReader *frameReader) Read(b []byte) (n int, err error) {
+	if frameReader.err != nil {
+		return 0, frameReader.err
+	}
 	return frameReader.buffer.Read(b)
 }
 
@@ -39,122 +48,286 @@ func (frameReader *frameReader) Opcode() Opcode {
 }
 
 func (frameReader *frameReader) Len() int {
+	if frameReader.buffer == nil {
+		return 0
+	}
 	return frameReader.buffer.Len()
 }
 
 func (frameReader *frameReader) Data() []byte {
-	if frameReader.err != nil {
-		return frameReader.buffer.Bytes()
+	if frameReader.err != nil || frameReader.buffer == nil {
+		return []byte{}
 	}
-	return []byte{}
+	return frameReader.buffer.Bytes()
 }
 
 func (frameReader *frameReader) Err() error {
 	return frameReader.err
 }
 
+// NewFrameReader reads the next message from reader, reassembling its
+// fragments. A control frame received between fragments is returned on its
+// own and the fragments read so far are dropped, use a WebSocket to keep
+// reading the rest of the stream.
 func NewFrameReader(reader io.Reader) FrameReader {
-	frameBuff := bytes.NewBuffer(make([]byte, 0, 512))
+	mr := newMessageReader(reader)
+
 	fr := &frameReader{}
-	fr.buffer = frameBuff
+	fr.opcode, fr.buffer, fr.err = mr.next()
+	return fr
+}
+
+// frameHeader is the decoded header of a single frame.
+//
+//	 0                   1                   2                   3
+//	 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//	+-+-+-+-+-------+-+-------------+-------------------------------+
+//	|F|R|R|R| opcode|M| Payload len |    Extended payload length    |
+//	|I|S|S|S|  (4)  |A|     (7)     |             (16/64)           |
+//	|N|V|V|V|       |S|             |   (if payload len==126/127)   |
+//	| |1|2|3|       |K|             |                               |
+//	+-+-+-+-+-------+-+-------------+ - - - - - - - - - - - - - - - +
+type frameHeader struct {
+	fin    bool
+	rsv    byte
+	opcode Opcode
+	masked bool
+	mask   [frameMaskSize]byte
+	length int64
+}
 
-	first, final := true, false
-	for fr.err == nil && !final {
-		header := make([]byte, frameMinHeaderSize)
-		if _, err := io.ReadFull(reader, header); err != nil {
-			return fr
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.2
+func readFrameHeader(reader io.Reader) (frameHeader, error) {
+	var h frameHeader
+	var buf [frameMaxPayloadLength]byte
+
+	if _, err := io.ReadFull(reader, buf[:frameMinHeaderSize]); err != nil {
+		return h, err
+	}
+
+	b0, b1 := buf[0], buf[1]
+	h.fin = b0&finBitMask != 0
+	h.rsv = b0 & (rsv1BitMask | rsv2BitMask | rsv3BitMask)
+	h.opcode = Opcode(b0 & opcodeBitMask)
+	h.masked = b1&maskBitMask != 0
+	h.length = int64(b1 & payloadLenBitMask)
+
+	if err := h.opcode.Valid(); err != nil {
+		return h, err
+	}
+
+	// The minimal number of bytes MUST be used to encode the length.
+	switch h.length {
+	case 126:
+		if _, err := io.ReadFull(reader, buf[:2]); err != nil {
+			return h, unexpectedEOF(err)
+		}
+		h.length = int64(binary.BigEndian.Uint16(buf[:2]))
+		if h.length <= frameMaxControlPayload {
+			return h, ErrNonMinimalLength
+		}
+	case 127:
+		if _, err := io.ReadFull(reader, buf[:frameMaxPayloadLength]); err != nil {
+			return h, unexpectedEOF(err)
+		}
+		length := binary.BigEndian.Uint64(buf[:frameMaxPayloadLength])
+		if length>>63 != 0 {
+			return h, ErrUnexpectedPayloadLen
+		}
+		if length <= 0xFFFF {
+			return h, ErrNonMinimalLength
 		}
+		h.length = int64(length)
+	}
 
-		b0 := header[0]
-		final = b0&finBitMask != 0
-		rsv1 := b0&rsv1BitMask != 0
-		rsv2 := b0&rsv2BitMask != 0
-		rsv3 := b0&rsv3BitMask != 0
-		opc := Opcode(b0 & opcodeBitMask)
+	if h.opcode.IsControl() {
+		if !h.fin {
+			return h, ErrFragmentedControlFrame
+		}
+		if h.length > frameMaxControlPayload {
+			return h, ErrControlFrameTooLarge
+		}
+	}
 
-		if err := opc.Valid(); err != nil {
-			return fr
+	if h.masked {
+		if _, err := io.ReadFull(reader, h.mask[:]); err != nil {
+			return h, unexpectedEOF(err)
 		}
+	}
 
-		// If this is a control frame, it must be final.
-		if first {
-			if opc.IsControl() && !final {
-				fr.err = errors.New("control frames must not be fragmented")
-				return fr
+	return h, nil
+}
+
+// readFramePayload appends the unmasked payload of h to buf. The buffer
+// grows with the data actually received, so a header announcing a huge
+// length cannot force a large allocation up front.
+func readFramePayload(reader io.Reader, h frameHeader, buf *bytes.Buffer) error {
+	start := buf.Len()
+	if _, err := io.CopyN(buf, reader, h.length); err != nil {
+		return unexpectedEOF(err)
+	}
+
+	if h.masked {
+		maskBytes(h.mask[:], buf.Bytes()[start:])
+	}
+	return nil
+}
+
+// unexpectedEOF reports a stream that ends in the middle of a frame.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// messageReader reassembles messages from frames. It keeps the fragments of
+// a data message across calls so control frames sent in between them can be
+// returned as soon as they arrive.
+type messageReader struct {
+	reader io.Reader
+	limit  int64
+
+	// checkMask enforces the masking direction of the peer when the role
+	// of the connection is known.
+	checkMask    bool
+	expectMasked bool
+
+	// extensions transform the frames and messages read, rsv holds the
+	// reserved bits they claim. Any other reserved bit fails the read.
+	extensions extensionPipeline
+	rsv        byte
+
+	opcode    Opcode
+	buffer    *bytes.Buffer
+	bufferRSV byte
+
+	trace frameTracer
+}
+
+func newMessageReader(reader io.Reader) *messageReader {
+	return &messageReader{
+		reader: reader,
+		limit:  defaultReadLimit,
+	}
+}
+
+func (mr *messageReader) traceFrame(h frameHeader, start time.Time) {
+	if mr.trace != nil {
+		mr.trace.frame(false, h.opcode, h.length, h.fin, start)
+	}
+}
+
+// https://datatracker.ietf.org/doc/html/rfc6455#section-5.4
+func (mr *messageReader) next() (Opcode, *bytes.Buffer, error) {
+	for {
+		h, err := readFrameHeader(mr.reader)
+		if err != nil {
+			return h.opcode, nil, err
+		}
+
+		start := time.Now()
+
+		if h.rsv&^mr.rsv != 0 {
+			return h.opcode, nil, ErrReservedBits
+		}
+
+		if mr.checkMask && h.masked != mr.expectMasked {
+			if h.masked {
+				return h.opcode, nil, ErrMaskedFrame
+			}
+			return h.opcode, nil, ErrUnmaskedFrame
+		}
+
+		if h.opcode.IsControl() {
+			buf := bytes.NewBuffer(make([]byte, 0, h.length))
+			if err := readFramePayload(mr.reader, h, buf); err != nil {
+				return h.opcode, nil, err
 			}
-			fr.opcode = opc
-			first = false
-		} else {
-			if !opc.IsContinue() {
-				fr.err = errors.New("unexpected new frame when continuation expected")
-				return fr
+
+			if err := mr.transformFrame(&h, buf, 0); err != nil {
+				return h.opcode, nil, err
 			}
+
+			mr.traceFrame(h, start)
+			return h.opcode, buf, nil
+		}
+
+		if h.opcode.IsContinue() && mr.buffer == nil {
+			return h.opcode, nil, ErrUnexpectedContinuation
 		}
 
-		if rsv1 {
-			panic("TODO: implement `permessage-deflate` extension")
+		if !h.opcode.IsContinue() && mr.buffer != nil {
+			return h.opcode, nil, ErrExpectedContinuation
 		}
 
-		if rsv2 {
-			fr.err = errors.New("RSV2 is set")
-			return fr
+		first := mr.buffer == nil
+		if first {
+			mr.opcode = h.opcode
+			mr.buffer = bytes.NewBuffer(make([]byte, 0, 512))
 		}
-		if rsv3 {
-			fr.err = errors.New("RSV3 is set")
-			return fr
+
+		// Compared this way round, a length near MaxInt64 cannot overflow.
+		if h.length < 0 || h.length > mr.limit-int64(mr.buffer.Len()) {
+			return mr.opcode, nil, ErrMessageTooBig
 		}
 
-		b1 := header[1]
-		masked := b1&maskBitMask != 0
-		payloadLen := int64(b1 & payloadLenBitMask)
+		offset := mr.buffer.Len()
+		if err := readFramePayload(mr.reader, h, mr.buffer); err != nil {
+			return mr.opcode, nil, err
+		}
 
-		switch payloadLen {
-		case 126:
-			extPayloadLen := make([]byte, 2)
-			if _, err := reader.Read(extPayloadLen); err != nil {
-				fr.err = err
-				return fr
-			} else {
-				payloadLen = int64(binary.BigEndian.Uint16(extPayloadLen))
-			}
-		case 127:
-			extPayloadLen := make([]byte, frameMaxPayloadLength)
-			if _, err := reader.Read(extPayloadLen); err != nil {
-				fr.err = err
-				return fr
-			} else {
-				payloadLen = int64(binary.BigEndian.Uint64(extPayloadLen))
-			}
+		if err := mr.transformFrame(&h, mr.buffer, offset); err != nil {
+			return mr.opcode, nil, err
 		}
+		mr.traceFrame(h, start)
 
-		mask := make([]byte, frameMaskSize)
-		if masked {
-			_, err := reader.Read(mask)
-			if err != nil {
-				fr.err = err
-				return fr
-			}
+		if first {
+			mr.bufferRSV = h.rsv
 		}
 
-		payload := make([]byte, payloadLen)
-		_, err := reader.Read(payload)
-		if err != nil {
-			fr.err = err
-			return fr
+		if !h.fin {
+			continue
 		}
 
-		for i := 0; masked && i < len(payload); i++ {
-			payload[i] ^= mask[i&3]
+		opc, buf := mr.opcode, mr.buffer
+		mr.buffer = nil
+
+		if len(mr.extensions) > 0 {
+			m := ExtensionFrame{Opcode: opc, Fin: true, RSV: mr.bufferRSV, Payload: buf.Bytes()}
+			if err := mr.extensions.readMessage(&m); err != nil {
+				return opc, nil, err
+			}
+
+			if int64(len(m.Payload)) > mr.limit {
+				return opc, nil, ErrMessageTooBig
+			}
+			buf = bytes.NewBuffer(m.Payload)
 		}
 
-		_, err = frameBuff.Write(payload)
-		if err != nil {
-			fr.err = err
-			return fr
+		if opc == OpcodeTextFrame && !utf8.Valid(buf.Bytes()) {
+			return opc, nil, ErrInvalidUTF8
 		}
+		return opc, buf, nil
+	}
+}
+
+// transformFrame runs the read transforms of the extensions over the
+// payload of h, which starts at start in buf.
+func (mr *messageReader) transformFrame(h *frameHeader, buf *bytes.Buffer, start int) error {
+	if len(mr.extensions) == 0 {
+		return nil
 	}
 
-	return fr
+	f := ExtensionFrame{Opcode: h.opcode, Fin: h.fin, RSV: h.rsv, Payload: buf.Bytes()[start:]}
+	if err := mr.extensions.readFrame(&f); err != nil {
+		return err
+	}
+
+	h.rsv = f.RSV
+	buf.Truncate(start)
+	buf.Write(f.Payload)
+	return nil
 }
 
 // https://github.com/golang/go/issues/17064
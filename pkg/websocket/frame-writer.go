@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"io"
+	"time"
 )
 
 const (
@@ -28,6 +29,13 @@ type frameWriter struct {
 	opcode    Opcode
 	masked    bool
 	err       error
+
+	// rsv holds the reserved bits of the next frame, extensions transform
+	// every frame before it is written.
+	rsv        byte
+	extensions extensionPipeline
+
+	trace frameTracer
 }
 
 func NewFrameWriter(opc Opcode, writer io.Writer, buf []byte, masked bool) FrameWriter {
@@ -45,7 +53,8 @@ func (frameWriter *frameWriter) Write(b []byte) (int, error) {
 	n := len(b)
 	first := true
 	var offset, size, remaining int
-	for frameWriter.err == nil && n > offset {
+	// An empty message is still sent as a single empty frame.
+	for frameWriter.err == nil && (n > offset || first) {
 		if frameWriter.err != nil {
 			return 0, frameWriter.err
 		}
@@ -67,6 +76,7 @@ func (frameWriter *frameWriter) Write(b []byte) (int, error) {
 		if first {
 			first = false
 			frameWriter.opcode = OpcodeContinueFrame
+			frameWriter.rsv = 0
 		}
 	}
 
@@ -78,12 +88,28 @@ func (frameWriter *frameWriter) Flush(payload []byte, masked, final bool) (n int
 		return 0, frameWriter.err
 	}
 
+	start := time.Now()
 	n = len(payload)
 	if n > frameWriter.writeSize-frameMaxHeaderSize {
 		return 0, bytes.ErrTooLarge
 	}
 
-	b0 := byte(frameWriter.opcode)
+	rsv := frameWriter.rsv
+	if len(frameWriter.extensions) > 0 {
+		f := ExtensionFrame{Opcode: frameWriter.opcode, Fin: final, RSV: rsv, Payload: payload}
+		if err := frameWriter.extensions.writeFrame(&f); err != nil {
+			frameWriter.err = err
+			return 0, err
+		}
+		payload, rsv = f.Payload, f.RSV
+		n = len(payload)
+
+		if size := frameMaxHeaderSize + len(payload); size > len(frameWriter.buf) {
+			frameWriter.buf = make([]byte, size)
+		}
+	}
+
+	b0 := byte(frameWriter.opcode) | rsv
 	if final {
 		b0 |= finBitMask
 	}
@@ -111,28 +137,38 @@ func (frameWriter *frameWriter) Flush(payload []byte, masked, final bool) (n int
 		pos += 8
 	}
 
+	var mask []byte
 	if masked {
-		mask, maskErr := generateMaskingKey()
-		if maskErr != nil {
-			return 0, maskErr
+		mask, err = generateMaskingKey()
+		if err != nil {
+			return 0, err
 		}
 
 		pos += copy(frameWriter.buf[pos:pos+frameMaskSize], mask[:frameMaskSize])
-
-		for i := range payload {
-			payload[i] ^= mask[i&3]
-		}
 	}
 
+	// Mask the copy in buf, the caller's payload must stay untouched.
 	copy(frameWriter.buf[pos:], payload)
+	if masked {
+		maskBytes(mask, frameWriter.buf[pos:pos+n])
+	}
 	if _, err = frameWriter.writer.Write(frameWriter.buf[:pos+n]); err != nil {
 		frameWriter.err = err
 		return 0, err
 	}
 
+	if frameWriter.trace != nil {
+		frameWriter.trace.frame(true, frameWriter.opcode, int64(n), final, start)
+	}
 	return n, nil
 }
 
+func maskBytes(mask []byte, b []byte) {
+	for i := range b {
+		b[i] ^= mask[i&3]
+	}
+}
+
 func generateMaskingKey() (maskingKey []byte, err error) {
 	maskingKey = make([]byte, 4)
 	_, err = io.ReadFull(rand.Reader, maskingKey)
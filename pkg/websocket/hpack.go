@@ -0,0 +1,295 @@
+package websocket
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// HPACK is the header compression of HTTP/2. The client only needs a small
+// part of it: header blocks are sent as literals that the server does not
+// index, and the header blocks of the server are decoded in full.
+//
+// https://datatracker.ietf.org/doc/html/rfc7541
+
+var errHPACK = errors.New("websocket: hpack: invalid header block")
+
+// hpackDefaultTableSize is the SETTINGS_HEADER_TABLE_SIZE of the client,
+// which it never changes.
+const hpackDefaultTableSize = 4096
+
+type hpackField struct {
+	name  string
+	value string
+}
+
+// size is the size of an entry of the dynamic table.
+//
+// https://datatracker.ietf.org/doc/html/rfc7541#section-4.1
+func (f hpackField) size() int {
+	return len(f.name) + len(f.value) + 32
+}
+
+// hpackAppendField appends a literal header field without indexing, with
+// a literal name.
+//
+// https://datatracker.ietf.org/doc/html/rfc7541#section-6.2.2
+func hpackAppendField(dst []byte, name, value string) []byte {
+	dst = append(dst, 0)
+	dst = hpackAppendString(dst, strings.ToLower(name))
+	return hpackAppendString(dst, value)
+}
+
+func hpackAppendString(dst []byte, s string) []byte {
+	dst = hpackAppendInt(dst, 7, 0, uint64(len(s)))
+	return append(dst, s...)
+}
+
+// https://datatracker.ietf.org/doc/html/rfc7541#section-5.1
+func hpackAppendInt(dst []byte, prefix uint, flags byte, i uint64) []byte {
+	limit := uint64(1)<<prefix - 1
+	if i < limit {
+		return append(dst, flags|byte(i))
+	}
+
+	dst = append(dst, flags|byte(limit))
+	for i -= limit; i >= 128; i >>= 7 {
+		dst = append(dst, byte(i&0x7f)|0x80)
+	}
+	return append(dst, byte(i))
+}
+
+// hpackDecoder decodes the header blocks of one connection, in the order
+// they are received.
+type hpackDecoder struct {
+	// dynamic holds the dynamic table, the newest entry first.
+	dynamic []hpackField
+	size    int
+	maxSize int
+}
+
+func newHPACKDecoder() *hpackDecoder {
+	return &hpackDecoder{maxSize: hpackDefaultTableSize}
+}
+
+// https://datatracker.ietf.org/doc/html/rfc7541#section-6
+func (d *hpackDecoder) decode(block []byte) ([]hpackField, error) {
+	var fields []hpackField
+	for len(block) > 0 {
+		var (
+			field hpackField
+			err   error
+		)
+
+		b := block[0]
+		switch {
+		case b&0x80 != 0:
+			var index uint64
+			if index, block, err = hpackReadInt(block, 7); err != nil {
+				return nil, err
+			}
+
+			if field, err = d.at(index); err != nil {
+				return nil, err
+			}
+
+		case b&0xc0 == 0x40:
+			if field, block, err = d.readLiteral(block, 6); err != nil {
+				return nil, err
+			}
+			d.add(field)
+
+		case b&0xe0 == 0x20:
+			var size uint64
+			if size, block, err = hpackReadInt(block, 5); err != nil {
+				return nil, err
+			}
+
+			if size > hpackDefaultTableSize {
+				return nil, errHPACK
+			}
+			d.maxSize = int(size)
+			d.evict()
+			continue
+
+		default:
+			if field, block, err = d.readLiteral(block, 4); err != nil {
+				return nil, err
+			}
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// at returns the entry of the static or dynamic table at index.
+func (d *hpackDecoder) at(index uint64) (hpackField, error) {
+	switch {
+	case index == 0:
+		return hpackField{}, errHPACK
+	case index <= uint64(len(hpackStaticTable)):
+		return hpackStaticTable[index-1], nil
+	case index-uint64(len(hpackStaticTable)) <= uint64(len(d.dynamic)):
+		return d.dynamic[index-uint64(len(hpackStaticTable))-1], nil
+	default:
+		return hpackField{}, errHPACK
+	}
+}
+
+// readLiteral reads a literal header field, whose name is either indexed
+// or a literal when the index is zero.
+func (d *hpackDecoder) readLiteral(block []byte, prefix uint) (hpackField, []byte, error) {
+	var (
+		field hpackField
+		index uint64
+		err   error
+	)
+
+	if index, block, err = hpackReadInt(block, prefix); err != nil {
+		return field, nil, err
+	}
+
+	if index == 0 {
+		if field.name, block, err = hpackReadString(block); err != nil {
+			return field, nil, err
+		}
+	} else {
+		name, err := d.at(index)
+		if err != nil {
+			return field, nil, err
+		}
+		field.name = name.name
+	}
+
+	if field.value, block, err = hpackReadString(block); err != nil {
+		return field, nil, err
+	}
+	return field, block, nil
+}
+
+// https://datatracker.ietf.org/doc/html/rfc7541#section-4.4
+func (d *hpackDecoder) add(field hpackField) {
+	d.dynamic = append([]hpackField{field}, d.dynamic...)
+	d.size += field.size()
+	d.evict()
+}
+
+func (d *hpackDecoder) evict() {
+	for d.size > d.maxSize && len(d.dynamic) > 0 {
+		last := d.dynamic[len(d.dynamic)-1]
+		d.dynamic = d.dynamic[:len(d.dynamic)-1]
+		d.size -= last.size()
+	}
+}
+
+func hpackReadInt(block []byte, prefix uint) (uint64, []byte, error) {
+	if len(block) == 0 {
+		return 0, nil, errHPACK
+	}
+
+	limit := uint64(1)<<prefix - 1
+	i := uint64(block[0]) & limit
+	block = block[1:]
+	if i < limit {
+		return i, block, nil
+	}
+
+	for shift := uint(0); len(block) > 0; shift += 7 {
+		if shift > 56 {
+			return 0, nil, errHPACK
+		}
+
+		b := block[0]
+		block = block[1:]
+		i += uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return i, block, nil
+		}
+	}
+	return 0, nil, errHPACK
+}
+
+// https://datatracker.ietf.org/doc/html/rfc7541#section-5.2
+func hpackReadString(block []byte) (string, []byte, error) {
+	if len(block) == 0 {
+		return "", nil, errHPACK
+	}
+
+	huffman := block[0]&0x80 != 0
+	length, block, err := hpackReadInt(block, 7)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if length > uint64(len(block)) {
+		return "", nil, errHPACK
+	}
+
+	data, block := block[:length], block[length:]
+	if !huffman {
+		return string(data), block, nil
+	}
+
+	s, err := hpackHuffmanDecode(data)
+	return s, block, err
+}
+
+// hpackHuffmanNode is a node of the Huffman decoding tree. Leaves have no
+// children.
+type hpackHuffmanNode struct {
+	children [2]*hpackHuffmanNode
+	symbol   byte
+}
+
+var hpackHuffmanRoot = sync.OnceValue(func() *hpackHuffmanNode {
+	root := &hpackHuffmanNode{}
+	for symbol, code := range hpackHuffmanCodes {
+		node := root
+		for bit := int(hpackHuffmanCodeLen[symbol]) - 1; bit >= 0; bit-- {
+			b := (code >> bit) & 1
+			if node.children[b] == nil {
+				node.children[b] = &hpackHuffmanNode{}
+			}
+			node = node.children[b]
+		}
+		node.symbol = byte(symbol)
+	}
+	return root
+})
+
+// hpackHuffmanDecode decodes data bit by bit. The padding must be shorter
+// than 8 bits and made of ones, the start of the EOS code.
+//
+// https://datatracker.ietf.org/doc/html/rfc7541#section-5.2
+func hpackHuffmanDecode(data []byte) (string, error) {
+	root := hpackHuffmanRoot()
+
+	var (
+		b       strings.Builder
+		node    = root
+		pending int
+		ones    = true
+	)
+
+	for _, octet := range data {
+		for bit := 7; bit >= 0; bit-- {
+			v := (octet >> bit) & 1
+			node = node.children[v]
+			if node == nil {
+				return "", errHPACK
+			}
+
+			pending++
+			ones = ones && v == 1
+			if node.children[0] == nil && node.children[1] == nil {
+				b.WriteByte(node.symbol)
+				node, pending, ones = root, 0, true
+			}
+		}
+	}
+
+	if pending >= 8 || !ones {
+		return "", errHPACK
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,705 @@
+package websocket
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrExtendedConnect is returned when an HTTP/2 server does not advertise
+// SETTINGS_ENABLE_CONNECT_PROTOCOL.
+var ErrExtendedConnect = errors.New("websocket: server does not support extended CONNECT")
+
+// The client speaks just enough HTTP/2 to open one extended CONNECT stream
+// per connection and move the WebSocket frames in its DATA frames.
+//
+// https://datatracker.ietf.org/doc/html/rfc9113
+const (
+	http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+	http2FrameHeaderSize = 9
+	http2DefaultWindow   = 65535
+	http2MaxFrameSize    = 16384
+
+	// http2Stream is the only stream the client opens.
+	http2Stream = 1
+)
+
+// HTTP/2 frame types.
+const (
+	http2FrameData         = 0x0
+	http2FrameHeaders      = 0x1
+	http2FrameRSTStream    = 0x3
+	http2FrameSettings     = 0x4
+	http2FramePushPromise  = 0x5
+	http2FramePing         = 0x6
+	http2FrameGoAway       = 0x7
+	http2FrameWindowUpdate = 0x8
+	http2FrameContinuation = 0x9
+)
+
+// HTTP/2 frame flags.
+const (
+	http2FlagEndStream  = 0x1
+	http2FlagAck        = 0x1
+	http2FlagEndHeaders = 0x4
+	http2FlagPadded     = 0x8
+	http2FlagPriority   = 0x20
+)
+
+// HTTP/2 settings.
+const (
+	http2SettingEnablePush            = 0x2
+	http2SettingInitialWindowSize     = 0x4
+	http2SettingMaxFrameSize          = 0x5
+	http2SettingEnableConnectProtocol = 0x8
+)
+
+// hopHeaders are not allowed in HTTP/2 requests.
+//
+// https://datatracker.ietf.org/doc/html/rfc9113#section-8.2.2
+var hopHeaders = []string{"Connection", "Keep-Alive", "Proxy-Connection", "Transfer-Encoding", "Upgrade", "Host"}
+
+// handshakeHTTP2 opens an extended CONNECT stream over conn, which already
+// speaks HTTP/2: h2c with prior knowledge, or TLS that negotiated h2.
+//
+// https://datatracker.ietf.org/doc/html/rfc8441#section-4
+func (client *WebSocketClient) handshakeHTTP2(ctx context.Context, conn net.Conn, u *url.URL, extraHeader http.Header) (WebSocket, error) {
+	s := &http2ClientConn{
+		conn:          conn,
+		reader:        bufio.NewReader(conn),
+		decoder:       newHPACKDecoder(),
+		sendWindow:    http2DefaultWindow,
+		connWindow:    http2DefaultWindow,
+		initialWindow: http2DefaultWindow,
+		maxFrame:      http2MaxFrameSize,
+		settings:      make(chan struct{}),
+		response:      make(chan []hpackField, 1),
+		done:          make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+
+	// The handshake is bound to ctx, the stream is not.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+
+	settings := make([]byte, 0, 6)
+	settings = binary.BigEndian.AppendUint16(settings, http2SettingEnablePush)
+	settings = binary.BigEndian.AppendUint32(settings, 0)
+
+	if _, err := io.WriteString(conn, http2Preface); err != nil {
+		return nil, wrapError(err)
+	}
+
+	if err := s.writeFrame(http2FrameSettings, 0, 0, settings); err != nil {
+		return nil, wrapError(err)
+	}
+
+	go s.readLoop()
+
+	select {
+	case <-s.settings:
+	case <-s.done:
+		return nil, s.handshakeError(ctx)
+	}
+
+	s.mu.Lock()
+	allowed := s.connectProtocol
+	s.mu.Unlock()
+	if !allowed {
+		s.Close()
+		return nil, ErrExtendedConnect
+	}
+
+	req, err := client.newRequest(ctx, http.MethodConnect, u, extraHeader)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	path := u.RequestURI()
+	block := hpackAppendField(nil, ":method", http.MethodConnect)
+	block = hpackAppendField(block, ":protocol", "websocket")
+	block = hpackAppendField(block, ":scheme", u.Scheme)
+	block = hpackAppendField(block, ":path", path)
+	block = hpackAppendField(block, ":authority", req.Host)
+	block = hpackAppendField(block, "sec-websocket-version", "13")
+	if len(client.Subprotocols) > 0 {
+		block = hpackAppendField(block, "sec-websocket-protocol", strings.Join(client.Subprotocols, ", "))
+	}
+	if len(client.Extensions) > 0 {
+		block = hpackAppendField(block, "sec-websocket-extensions", FormatExtensions(offerExtensions(client.Extensions)))
+	}
+	for name, values := range req.Header {
+		if isHopHeader(name) {
+			continue
+		}
+		for _, value := range values {
+			block = hpackAppendField(block, name, value)
+		}
+	}
+
+	if len(block) > http2MaxFrameSize {
+		s.Close()
+		return nil, fmt.Errorf("%w: request header too large", ErrBadHandshake)
+	}
+
+	tracer := httptrace.ContextClientTrace(ctx)
+	err = s.writeFrame(http2FrameHeaders, http2FlagEndHeaders, http2Stream, block)
+	if tracer != nil && tracer.WroteHeaders != nil && err == nil {
+		tracer.WroteHeaders()
+	}
+	if tracer != nil && tracer.WroteRequest != nil {
+		tracer.WroteRequest(httptrace.WroteRequestInfo{Err: err})
+	}
+
+	if err != nil {
+		s.Close()
+		return nil, wrapError(err)
+	}
+
+	var fields []hpackField
+	select {
+	case fields = <-s.response:
+	case <-s.done:
+		return nil, s.handshakeError(ctx)
+	}
+
+	if tracer != nil && tracer.GotFirstResponseByte != nil {
+		tracer.GotFirstResponseByte()
+	}
+
+	header := http.Header{}
+	var status string
+	for _, f := range fields {
+		if f.name == ":status" {
+			status = f.value
+		} else if !strings.HasPrefix(f.name, ":") {
+			header.Add(f.name, f.value)
+		}
+	}
+
+	// Any 2xx status accepts the request.
+	//
+	// https://datatracker.ietf.org/doc/html/rfc8441#section-5
+	if code, _ := strconv.Atoi(status); code < 200 || code > 299 {
+		s.Close()
+		return nil, &responseError{res: &http.Response{
+			Status:     strings.TrimSpace(status + " " + http.StatusText(code)),
+			StatusCode: code,
+			Proto:      "HTTP/2.0",
+			ProtoMajor: 2,
+			Header:     header,
+			Request:    req,
+		}}
+	}
+
+	if err := checkSubprotocol(header, client.Subprotocols); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	extensions, err := acceptedExtensions(client.Extensions, header)
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	if !stop() {
+		s.Close()
+		return nil, contextError(ctx, nil)
+	}
+	conn.SetDeadline(time.Time{})
+
+	ws := NewConn(s, bufio.NewReader(s), nil, true).(*webSocketConn)
+	ws.setTrace(ContextConnTrace(ctx))
+	ws.subprotocol = header.Get("Sec-WebSocket-Protocol")
+	ws.setExtensions(extensions)
+	client.storeCookies(u, header)
+	return ws, nil
+}
+
+func isHopHeader(name string) bool {
+	for _, h := range hopHeaders {
+		if strings.EqualFold(h, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// http2ClientConn is the extended CONNECT stream of a client seen as a
+// net.Conn. A goroutine reads the frames of the connection, DATA frames of
+// the stream are buffered until they are read.
+type http2ClientConn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	decoder *hpackDecoder
+
+	writeMu sync.Mutex
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	// buf holds the data received and not read yet, unacked the data read
+	// and not given back to the flow control windows of the server yet.
+	buf     []byte
+	unacked int
+	readErr error
+
+	// sendWindow and connWindow are the flow control windows of the stream
+	// and of the connection, initialWindow the SETTINGS_INITIAL_WINDOW_SIZE
+	// of the server and maxFrame the largest DATA frame it accepts.
+	sendWindow    int64
+	connWindow    int64
+	initialWindow int64
+	maxFrame      int
+	writeErr      error
+
+	connectProtocol bool
+	settingsSeen    bool
+	settings        chan struct{}
+	response        chan []hpackField
+	responseSeen    bool
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+	timers        [2]*time.Timer
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// handshakeError returns why the connection ended during the handshake.
+func (s *http2ClientConn) handshakeError(ctx context.Context) error {
+	s.mu.Lock()
+	err := s.readErr
+	s.mu.Unlock()
+
+	s.Close()
+	return contextError(ctx, err)
+}
+
+func (s *http2ClientConn) writeFrame(typ, flags byte, stream uint32, payload []byte) error {
+	var header [http2FrameHeaderSize]byte
+	header[0] = byte(len(payload) >> 16)
+	header[1] = byte(len(payload) >> 8)
+	header[2] = byte(len(payload))
+	header[3] = typ
+	header[4] = flags
+	binary.BigEndian.PutUint32(header[5:], stream)
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if _, err := s.conn.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := s.conn.Write(payload)
+	return err
+}
+
+// readLoop handles the frames of the server until the connection fails.
+func (s *http2ClientConn) readLoop() {
+	defer close(s.done)
+
+	var (
+		header [http2FrameHeaderSize]byte
+		block  []byte
+	)
+
+	for {
+		if _, err := io.ReadFull(s.reader, header[:]); err != nil {
+			s.fail(err)
+			return
+		}
+
+		length := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+		typ, flags := header[3], header[4]
+		stream := binary.BigEndian.Uint32(header[5:]) & 0x7fffffff
+
+		if length > http2MaxFrameSize {
+			s.fail(errors.New("http2: frame too large"))
+			return
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(s.reader, payload); err != nil {
+			s.fail(err)
+			return
+		}
+
+		var err error
+		switch typ {
+		case http2FrameData:
+			err = s.handleData(flags, stream, payload)
+
+		case http2FrameHeaders, http2FrameContinuation:
+			if typ == http2FrameHeaders {
+				if payload, err = http2Unpad(flags, payload); err != nil {
+					break
+				}
+
+				if flags&http2FlagPriority != 0 {
+					if len(payload) < 5 {
+						err = errors.New("http2: short HEADERS frame")
+						break
+					}
+					payload = payload[5:]
+				}
+			}
+
+			block = append(block, payload...)
+			if flags&http2FlagEndHeaders != 0 {
+				err = s.handleHeaders(flags, stream, block)
+				block = nil
+			}
+
+		case http2FrameRSTStream:
+			if stream == http2Stream && len(payload) == 4 {
+				code := binary.BigEndian.Uint32(payload)
+				s.failStream(fmt.Errorf("http2: stream reset with error code %d", code))
+			}
+
+		case http2FrameSettings:
+			err = s.handleSettings(flags, payload)
+
+		case http2FramePushPromise:
+			err = errors.New("http2: unexpected PUSH_PROMISE")
+
+		case http2FramePing:
+			if flags&http2FlagAck == 0 {
+				err = s.writeFrame(http2FramePing, http2FlagAck, 0, payload)
+			}
+
+		case http2FrameGoAway:
+			if len(payload) >= 8 && binary.BigEndian.Uint32(payload)&0x7fffffff < http2Stream {
+				s.failStream(errors.New("http2: stream refused by GOAWAY"))
+			}
+
+		case http2FrameWindowUpdate:
+			err = s.handleWindowUpdate(stream, payload)
+		}
+
+		if err != nil {
+			s.fail(err)
+			s.conn.Close()
+			return
+		}
+	}
+}
+
+// http2Unpad removes the padding of a DATA or HEADERS frame.
+func http2Unpad(flags byte, payload []byte) ([]byte, error) {
+	if flags&http2FlagPadded == 0 {
+		return payload, nil
+	}
+
+	if len(payload) == 0 || int(payload[0]) >= len(payload) {
+		return nil, errors.New("http2: invalid padding")
+	}
+	return payload[1 : len(payload)-int(payload[0])], nil
+}
+
+func (s *http2ClientConn) handleData(flags byte, stream uint32, payload []byte) error {
+	size := len(payload)
+	payload, err := http2Unpad(flags, payload)
+	if err != nil {
+		return err
+	}
+
+	if stream != http2Stream {
+		// The window of the connection is still used up, give it back.
+		return s.windowUpdate(0, size)
+	}
+
+	s.mu.Lock()
+	s.buf = append(s.buf, payload...)
+	// Padding counts against the window but is never read.
+	s.unacked += size - len(payload)
+	if flags&http2FlagEndStream != 0 && s.readErr == nil {
+		s.readErr = io.EOF
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *http2ClientConn) handleHeaders(flags byte, stream uint32, block []byte) error {
+	// Every header block is decoded to keep the dynamic table in sync.
+	fields, err := s.decoder.decode(block)
+	if err != nil {
+		return err
+	}
+
+	if stream != http2Stream {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Informational responses come before the final one.
+	final := true
+	for _, f := range fields {
+		if f.name == ":status" && strings.HasPrefix(f.value, "1") {
+			final = false
+		}
+	}
+
+	if final && !s.responseSeen {
+		s.responseSeen = true
+		s.response <- fields
+	}
+
+	if flags&http2FlagEndStream != 0 && s.readErr == nil {
+		s.readErr = io.EOF
+		s.cond.Broadcast()
+	}
+	return nil
+}
+
+func (s *http2ClientConn) handleSettings(flags byte, payload []byte) error {
+	if flags&http2FlagAck != 0 {
+		return nil
+	}
+
+	if len(payload)%6 != 0 {
+		return errors.New("http2: invalid SETTINGS frame")
+	}
+
+	s.mu.Lock()
+	for i := 0; i < len(payload); i += 6 {
+		id := binary.BigEndian.Uint16(payload[i:])
+		value := binary.BigEndian.Uint32(payload[i+2:])
+
+		switch id {
+		case http2SettingInitialWindowSize:
+			// The change applies to the windows of open streams.
+			//
+			// https://datatracker.ietf.org/doc/html/rfc9113#section-6.9.2
+			s.sendWindow += int64(value) - s.initialWindow
+			s.initialWindow = int64(value)
+		case http2SettingMaxFrameSize:
+			s.maxFrame = int(min(value, http2MaxFrameSize*64))
+		case http2SettingEnableConnectProtocol:
+			s.connectProtocol = value == 1
+		}
+	}
+
+	first := !s.settingsSeen
+	s.settingsSeen = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	if first {
+		close(s.settings)
+	}
+	return s.writeFrame(http2FrameSettings, http2FlagAck, 0, nil)
+}
+
+func (s *http2ClientConn) handleWindowUpdate(stream uint32, payload []byte) error {
+	if len(payload) != 4 {
+		return errors.New("http2: invalid WINDOW_UPDATE frame")
+	}
+	increment := int64(binary.BigEndian.Uint32(payload) & 0x7fffffff)
+
+	s.mu.Lock()
+	switch stream {
+	case 0:
+		s.connWindow += increment
+	case http2Stream:
+		s.sendWindow += increment
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	return nil
+}
+
+// windowUpdate gives n bytes back to the flow control window of the
+// connection, and of stream when it is not zero.
+func (s *http2ClientConn) windowUpdate(stream uint32, n int) error {
+	var increment [4]byte
+	binary.BigEndian.PutUint32(increment[:], uint32(n))
+
+	if err := s.writeFrame(http2FrameWindowUpdate, 0, 0, increment[:]); err != nil {
+		return err
+	}
+
+	if stream != 0 {
+		return s.writeFrame(http2FrameWindowUpdate, 0, stream, increment[:])
+	}
+	return nil
+}
+
+// fail ends both directions of the stream with err.
+func (s *http2ClientConn) fail(err error) {
+	s.mu.Lock()
+	if s.readErr == nil || s.readErr == io.EOF {
+		s.readErr = err
+	}
+	if s.writeErr == nil {
+		s.writeErr = err
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// failStream ends the stream with err, data already received can still be
+// read.
+func (s *http2ClientConn) failStream(err error) {
+	s.mu.Lock()
+	if s.readErr == nil {
+		s.readErr = err
+	}
+	if s.writeErr == nil {
+		s.writeErr = err
+	}
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+func (s *http2ClientConn) Read(b []byte) (int, error) {
+	s.mu.Lock()
+	for len(s.buf) == 0 && s.readErr == nil {
+		if !s.readDeadline.IsZero() && !time.Now().Before(s.readDeadline) {
+			s.mu.Unlock()
+			return 0, os.ErrDeadlineExceeded
+		}
+		s.cond.Wait()
+	}
+
+	if len(s.buf) == 0 {
+		err := s.readErr
+		s.mu.Unlock()
+		return 0, err
+	}
+
+	n := copy(b, s.buf)
+	s.buf = s.buf[n:]
+	s.unacked += n
+
+	// Window updates are batched, the server can keep sending meanwhile.
+	var increment int
+	if s.unacked >= http2DefaultWindow/4 {
+		increment, s.unacked = s.unacked, 0
+	}
+	s.mu.Unlock()
+
+	if increment > 0 {
+		if err := s.windowUpdate(http2Stream, increment); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (s *http2ClientConn) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		s.mu.Lock()
+		for s.writeErr == nil && (s.sendWindow <= 0 || s.connWindow <= 0) {
+			if !s.writeDeadline.IsZero() && !time.Now().Before(s.writeDeadline) {
+				s.mu.Unlock()
+				return written, os.ErrDeadlineExceeded
+			}
+			s.cond.Wait()
+		}
+
+		if s.writeErr != nil {
+			err := s.writeErr
+			s.mu.Unlock()
+			return written, err
+		}
+
+		n := int(min(int64(len(b)), int64(s.maxFrame), s.sendWindow, s.connWindow))
+		s.sendWindow -= int64(n)
+		s.connWindow -= int64(n)
+		s.mu.Unlock()
+
+		if err := s.writeFrame(http2FrameData, 0, http2Stream, b[:n]); err != nil {
+			return written, err
+		}
+		written += n
+		b = b[n:]
+	}
+	return written, nil
+}
+
+// Close ends the stream and closes the connection.
+func (s *http2ClientConn) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		s.mu.Lock()
+		open := s.writeErr == nil
+		s.mu.Unlock()
+
+		if open {
+			s.conn.SetWriteDeadline(time.Now().Add(time.Second))
+			s.writeFrame(http2FrameData, http2FlagEndStream, http2Stream, nil)
+		}
+
+		s.fail(net.ErrClosed)
+		err = s.conn.Close()
+	})
+	return err
+}
+
+func (s *http2ClientConn) LocalAddr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+func (s *http2ClientConn) RemoteAddr() net.Addr {
+	return s.conn.RemoteAddr()
+}
+
+func (s *http2ClientConn) SetDeadline(t time.Time) error {
+	s.SetReadDeadline(t)
+	return s.SetWriteDeadline(t)
+}
+
+func (s *http2ClientConn) SetReadDeadline(t time.Time) error {
+	s.setDeadline(0, &s.readDeadline, t)
+	return nil
+}
+
+// SetWriteDeadline bounds the wait for flow control and the writes on the
+// connection.
+func (s *http2ClientConn) SetWriteDeadline(t time.Time) error {
+	s.setDeadline(1, &s.writeDeadline, t)
+	return s.conn.SetWriteDeadline(t)
+}
+
+// setDeadline wakes up the readers or writers waiting on the stream when
+// the deadline passes.
+func (s *http2ClientConn) setDeadline(i int, deadline *time.Time, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	*deadline = t
+	if s.timers[i] != nil {
+		s.timers[i].Stop()
+		s.timers[i] = nil
+	}
+
+	if !t.IsZero() {
+		s.timers[i] = time.AfterFunc(time.Until(t), func() {
+			s.mu.Lock()
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		})
+	}
+	s.cond.Broadcast()
+}
@@ -0,0 +1,173 @@
+package websocket
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// upgradeHTTP2 accepts an extended CONNECT request and runs the WebSocket
+// over its stream. The stream ends when the handler returns, so the
+// handler must keep serving the connection and close it before returning.
+//
+// Go's HTTP/2 server only lets clients send extended CONNECT requests when
+// the process is started with GODEBUG=http2xconnect=1.
+//
+// https://datatracker.ietf.org/doc/html/rfc8441#section-4
+func (this *WebSocketServer) upgradeHTTP2(res http.ResponseWriter, req *http.Request) (*webSocketConn, error) {
+	// The request from the client looks as follows:
+	//      :method = CONNECT
+	//      :protocol = websocket
+	//      :scheme = https
+	//      :path = /chat
+	//      :authority = server.example.com
+	//      sec-websocket-protocol = chat, superchat
+	//      sec-websocket-version = 13
+	if req.Method != http.MethodConnect {
+		res.WriteHeader(http.StatusMethodNotAllowed)
+		return nil, ErrMethodNotAllowed
+	}
+
+	if !strings.EqualFold(req.Header.Get(":protocol"), "websocket") {
+		res.WriteHeader(http.StatusBadRequest)
+		return nil, ErrBadUpgrade
+	}
+
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		res.Header().Set("Sec-WebSocket-Version", "13")
+		res.WriteHeader(http.StatusUpgradeRequired)
+		return nil, fmt.Errorf("%w: unsupported version %q", ErrBadHandshake, req.Header.Get("Sec-WebSocket-Version"))
+	}
+
+	subprotocol, extensions, accepted, err := this.negotiate(res, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// The response from the server looks as follows:
+	//      :status = 200
+	//      sec-websocket-protocol = chat
+	if subprotocol != "" {
+		res.Header().Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	if len(accepted) > 0 {
+		res.Header().Set("Sec-WebSocket-Extensions", FormatExtensions(accepted))
+	}
+	res.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(res)
+	if err := rc.Flush(); err != nil {
+		return nil, wrapError(err)
+	}
+
+	conn := &http2ServerConn{
+		body:   req.Body,
+		writer: res,
+		rc:     rc,
+		local:  localAddr(req),
+		remote: remoteAddr(req),
+	}
+
+	ws := NewConn(conn, bufio.NewReader(conn), nil, false).(*webSocketConn)
+	ws.setTrace(ContextConnTrace(req.Context()))
+	ws.subprotocol = subprotocol
+	ws.setExtensions(extensions)
+	return ws, nil
+}
+
+// http2ServerConn is the stream of an extended CONNECT request seen as a
+// net.Conn: the request body is read, the response body is written.
+type http2ServerConn struct {
+	body   io.ReadCloser
+	writer io.Writer
+	rc     *http.ResponseController
+
+	local  net.Addr
+	remote net.Addr
+
+	// mu keeps writes from running after Close, when the handler may have
+	// returned and the ResponseWriter may no longer be used.
+	mu     sync.Mutex
+	closed bool
+}
+
+func (c *http2ServerConn) Read(b []byte) (int, error) {
+	return c.body.Read(b)
+}
+
+func (c *http2ServerConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return 0, net.ErrClosed
+	}
+
+	n, err := c.writer.Write(b)
+	if err != nil {
+		return n, err
+	}
+	return n, c.rc.Flush()
+}
+
+func (c *http2ServerConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.body.Close()
+}
+
+func (c *http2ServerConn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *http2ServerConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+func (c *http2ServerConn) SetDeadline(t time.Time) error {
+	if err := c.rc.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.rc.SetWriteDeadline(t)
+}
+
+func (c *http2ServerConn) SetReadDeadline(t time.Time) error {
+	return c.rc.SetReadDeadline(t)
+}
+
+func (c *http2ServerConn) SetWriteDeadline(t time.Time) error {
+	return c.rc.SetWriteDeadline(t)
+}
+
+// httpAddr is the address of a request when the connection itself is not
+// available.
+type httpAddr string
+
+func (a httpAddr) Network() string {
+	return "tcp"
+}
+
+func (a httpAddr) String() string {
+	return string(a)
+}
+
+func localAddr(req *http.Request) net.Addr {
+	if addr, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		return addr
+	}
+	return httpAddr("")
+}
+
+func remoteAddr(req *http.Request) net.Addr {
+	return httpAddr(req.RemoteAddr)
+}
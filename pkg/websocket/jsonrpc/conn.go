@@ -0,0 +1,280 @@
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+type connKey struct{}
+
+// ConnFromContext returns the connection a handler is serving, so it can
+// call or notify the other end.
+func ConnFromContext(ctx context.Context) *Conn {
+	conn, _ := ctx.Value(connKey{}).(*Conn)
+	return conn
+}
+
+// Conn is one end of a JSON-RPC connection. It serves the methods of its
+// registry to the other end and calls the methods of the other end.
+type Conn struct {
+	ws       websocket.WebSocket
+	registry *Registry
+
+	// ctx is the context of the handlers, canceled once the connection is
+	// closed.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	nextID  uint64
+	pending map[string]chan *message
+
+	done chan struct{}
+	err  error
+}
+
+// NewConn starts serving registry, which may be nil, on ws. The connection
+// reads from ws until it is closed.
+func NewConn(ws websocket.WebSocket, registry *Registry) *Conn {
+	c := &Conn{
+		ws:       ws,
+		registry: registry,
+		pending:  map[string]chan *message{},
+		done:     make(chan struct{}),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.WithValue(context.Background(), connKey{}, c))
+
+	go c.readLoop()
+	return c
+}
+
+// WebSocket returns the underlying connection.
+func (c *Conn) WebSocket() websocket.WebSocket {
+	return c.ws
+}
+
+// Done is closed once the connection is closed.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection was closed, once Done is closed.
+func (c *Conn) Err() error {
+	<-c.done
+	return c.err
+}
+
+// Call calls method with params and decodes its result into result, which
+// may be nil to discard it. The call is abandoned when ctx is done, use
+// context.WithTimeout to bound it. A JSON-RPC error is returned as *Error.
+func (c *Conn) Call(ctx context.Context, method string, params, result any) error {
+	c.mu.Lock()
+	c.nextID++
+	id := strconv.FormatUint(c.nextID, 10)
+	ch := make(chan *message, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.send(ctx, method, params, json.RawMessage(id)); err != nil {
+		return err
+	}
+
+	select {
+	case res := <-ch:
+		if res.Error != nil {
+			return res.Error
+		}
+		if result == nil {
+			return nil
+		}
+		return json.Unmarshal(res.Result, result)
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return c.err
+	}
+}
+
+// Notify sends a notification, which the other end does not answer.
+func (c *Conn) Notify(ctx context.Context, method string, params any) error {
+	return c.send(ctx, method, params, nil)
+}
+
+func (c *Conn) send(ctx context.Context, method string, params any, id json.RawMessage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	req := message{JSONRPC: version, Method: method, ID: id}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		req.Params = raw
+	}
+	return c.write(req)
+}
+
+func (c *Conn) write(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-c.done:
+		return c.err
+	default:
+	}
+
+	if err := c.ws.WriteMessage(websocket.OpcodeTextFrame, data); err != nil {
+		if errors.Is(err, websocket.ErrCloseSent) {
+			return ErrClosed
+		}
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection with CloseNormalClosure. Pending calls return
+// ErrClosed.
+func (c *Conn) Close() error {
+	websocket.StartClose(c.ws, websocket.CloseNormalClosure, nil)
+
+	select {
+	case <-c.done:
+	case <-time.After(websocket.CloseHandshakeTimeout):
+	}
+	return c.ws.Close()
+}
+
+func (c *Conn) readLoop() {
+	err := c.serve()
+
+	c.cancel()
+	c.ws.Close()
+
+	c.err = fmt.Errorf("%w: %w", ErrClosed, err)
+	close(c.done)
+}
+
+func (c *Conn) serve() error {
+	for {
+		msg := c.ws.ReadMessage()
+		if msg.Err != nil {
+			return msg.Err
+		}
+
+		switch msg.Opcode {
+		case websocket.OpcodePingFrame:
+			c.ws.WriteMessage(websocket.OpcodePongFrame, msg.Data)
+		case websocket.OpcodeTextFrame, websocket.OpcodeBinaryFrame:
+			c.dispatch(msg.Data)
+		}
+	}
+}
+
+// dispatch handles one WebSocket message, which holds a JSON-RPC message or
+// a batch of them.
+func (c *Conn) dispatch(data []byte) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(data, &batch); err != nil {
+			// Invalid JSON is the only way to fail decoding an array.
+			c.write(errorResponse(nil, NewError(CodeParseError, "Parse error", nil)))
+			return
+		}
+
+		if len(batch) == 0 {
+			c.write(errorResponse(nil, NewError(CodeInvalidRequest, "Invalid Request", nil)))
+			return
+		}
+
+		go c.serveBatch(batch)
+		return
+	}
+
+	if !json.Valid(data) {
+		c.write(errorResponse(nil, NewError(CodeParseError, "Parse error", nil)))
+		return
+	}
+
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.write(errorResponse(nil, NewError(CodeInvalidRequest, "Invalid Request", nil)))
+		return
+	}
+
+	switch {
+	case msg.isRequest():
+		go func() {
+			if res := c.registry.call(c.ctx, &msg); res != nil {
+				c.write(res)
+			}
+		}()
+	case msg.Result != nil || msg.Error != nil:
+		c.resolve(&msg)
+	default:
+		c.write(errorResponse(msg.ID, NewError(CodeInvalidRequest, "Invalid Request", nil)))
+	}
+}
+
+// serveBatch answers a batch with an array of the responses of its requests,
+// or not at all when it only holds notifications.
+func (c *Conn) serveBatch(batch []json.RawMessage) {
+	var responses []*response
+	for _, raw := range batch {
+		var msg message
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			responses = append(responses, errorResponse(nil, NewError(CodeInvalidRequest, "Invalid Request", nil)))
+			continue
+		}
+
+		switch {
+		case msg.isRequest():
+			if res := c.registry.call(c.ctx, &msg); res != nil {
+				responses = append(responses, res)
+			}
+		case msg.Result != nil || msg.Error != nil:
+			c.resolve(&msg)
+		default:
+			responses = append(responses, errorResponse(msg.ID, NewError(CodeInvalidRequest, "Invalid Request", nil)))
+		}
+	}
+
+	if len(responses) > 0 {
+		c.write(responses)
+	}
+}
+
+// resolve hands a response to the call waiting for it. Responses to unknown
+// or abandoned calls are dropped.
+func (c *Conn) resolve(res *message) {
+	c.mu.Lock()
+	ch, ok := c.pending[string(res.ID)]
+	c.mu.Unlock()
+
+	if ok {
+		select {
+		case ch <- res:
+		default:
+			// A duplicate response, the call already has its answer.
+		}
+	}
+}
@@ -0,0 +1,101 @@
+// Package jsonrpc implements JSON-RPC 2.0 over a WebSocket.
+//
+// A Conn is symmetric: both ends can serve the methods of a Registry and call
+// the methods of the other end, so a server can notify or call its clients on
+// the same connection they use to call it. Every JSON-RPC message is sent as
+// one text message.
+//
+//	reg := jsonrpc.NewRegistry()
+//	jsonrpc.Register(reg, "add", func(ctx context.Context, p [2]int) (int, error) {
+//		return p[0] + p[1], nil
+//	})
+//	http.Handle("/rpc", &jsonrpc.Server{Registry: reg})
+//
+//	conn, err := jsonrpc.Dial(ctx, "ws://localhost:8080/rpc", nil)
+//	var sum int
+//	err = conn.Call(ctx, "add", [2]int{1, 2}, &sum)
+//
+// https://www.jsonrpc.org/specification
+package jsonrpc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const version = "2.0"
+
+// Error codes defined by the specification.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// ErrClosed is returned by calls made on, or pending when, the connection
+// is closed.
+var ErrClosed = errors.New("jsonrpc: connection closed")
+
+// Error is a JSON-RPC error object. A handler returning an *Error sends it
+// as is, any other error is sent as CodeInternalError with its message. A
+// handler that panics is answered with CodeInternalError too.
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jsonrpc: %s (%d)", e.Message, e.Code)
+}
+
+// NewError returns an *Error with data, if not nil, encoded as its data
+// member.
+func NewError(code int, message string, data any) *Error {
+	e := &Error{Code: code, Message: message}
+	if data != nil {
+		e.Data, _ = json.Marshal(data)
+	}
+	return e
+}
+
+// message is any JSON-RPC object: a request, a notification or a response.
+// A request without id is a notification, a message without method is a
+// response.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+func (m *message) isRequest() bool {
+	return m.Method != ""
+}
+
+func (m *message) isNotification() bool {
+	return m.isRequest() && m.ID == nil
+}
+
+var nullID = json.RawMessage("null")
+
+// response is the JSON encoding of a response, where the id and either the
+// result or the error are always present.
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+func errorResponse(id json.RawMessage, err *Error) *response {
+	if id == nil {
+		id = nullID
+	}
+	return &response{JSONRPC: version, Error: err, ID: id}
+}
@@ -0,0 +1,113 @@
+package jsonrpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// HandlerFunc serves one method. params is the raw params member, nil when
+// it is absent. The result is encoded with encoding/json.
+type HandlerFunc func(ctx context.Context, params json.RawMessage) (any, error)
+
+// Registry maps method names to their handlers. It is safe for concurrent
+// use and can be shared by any number of connections.
+type Registry struct {
+	mu      sync.RWMutex
+	methods map[string]HandlerFunc
+}
+
+func NewRegistry() *Registry {
+	return &Registry{methods: map[string]HandlerFunc{}}
+}
+
+// Handle registers fn for method. It panics if method is already registered
+// or starts with the reserved "rpc." prefix.
+func (r *Registry) Handle(method string, fn HandlerFunc) {
+	if method == "" || strings.HasPrefix(method, "rpc.") {
+		panic("jsonrpc: invalid method name " + method)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.methods == nil {
+		r.methods = map[string]HandlerFunc{}
+	}
+
+	if _, ok := r.methods[method]; ok {
+		panic("jsonrpc: method " + method + " registered twice")
+	}
+	r.methods[method] = fn
+}
+
+// Register registers a typed handler for method. The params of a request
+// are decoded into P, or left as the zero P when absent, and a params member
+// that does not decode is answered with CodeInvalidParams.
+func Register[P, R any](r *Registry, method string, fn func(ctx context.Context, params P) (R, error)) {
+	r.Handle(method, func(ctx context.Context, raw json.RawMessage) (any, error) {
+		var params P
+		if raw != nil {
+			if err := json.Unmarshal(raw, &params); err != nil {
+				return nil, NewError(CodeInvalidParams, "Invalid params", err.Error())
+			}
+		}
+		return fn(ctx, params)
+	})
+}
+
+func (r *Registry) lookup(method string) HandlerFunc {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.methods[method]
+}
+
+// call runs the handler of req and returns its response, nil for a
+// notification.
+func (r *Registry) call(ctx context.Context, req *message) *response {
+	var res *response
+	switch fn := r.lookup(req.Method); {
+	case req.JSONRPC != version:
+		res = errorResponse(req.ID, NewError(CodeInvalidRequest, "Invalid Request", nil))
+	case fn == nil:
+		res = errorResponse(req.ID, NewError(CodeMethodNotFound, "Method not found", req.Method))
+	default:
+		res = invoke(ctx, fn, req)
+	}
+
+	if req.isNotification() {
+		return nil
+	}
+	return res
+}
+
+// invoke runs fn for req. A handler that panics fails its request with
+// CodeInternalError rather than the whole process.
+func invoke(ctx context.Context, fn HandlerFunc, req *message) (res *response) {
+	defer func() {
+		if recover() != nil {
+			res = errorResponse(req.ID, NewError(CodeInternalError, "Internal error", nil))
+		}
+	}()
+
+	result, err := fn(ctx, req.Params)
+	if err != nil {
+		var rpcErr *Error
+		if !errors.As(err, &rpcErr) {
+			rpcErr = NewError(CodeInternalError, err.Error(), nil)
+		}
+		return errorResponse(req.ID, rpcErr)
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return errorResponse(req.ID, NewError(CodeInternalError, err.Error(), nil))
+	}
+	return &response{JSONRPC: version, Result: data, ID: req.ID}
+}
@@ -0,0 +1,56 @@
+package jsonrpc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// Server is an http.Handler that serves Registry on every WebSocket
+// connection it accepts.
+type Server struct {
+	Registry *Registry
+
+	// WebSocketServer upgrades the requests, a zero WebSocketServer when
+	// nil.
+	WebSocketServer *websocket.WebSocketServer
+
+	// OnConnect, when set, is called with every new connection, e.g. to keep
+	// it for notifications. The connection is served until it is closed.
+	OnConnect func(conn *Conn)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server := s.WebSocketServer
+	if server == nil {
+		server = &websocket.WebSocketServer{}
+	}
+
+	ws, err := server.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+
+	conn := NewConn(ws, s.Registry)
+	if s.OnConnect != nil {
+		s.OnConnect(conn)
+	}
+	<-conn.Done()
+}
+
+// Dial connects to the JSON-RPC server at rawurl and serves registry, which
+// may be nil, to it.
+func Dial(ctx context.Context, rawurl string, registry *Registry) (*Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := (&websocket.WebSocketClient{}).DialWithContext(ctx, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(ws, registry), nil
+}
@@ -0,0 +1,108 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+// LevelFrame is the default level of the records logged for every frame,
+// below slog.LevelDebug so that frames are only logged when asked for.
+const LevelFrame = slog.LevelDebug - 4
+
+// connLogger is the logger of a connection.
+type connLogger struct {
+	logger     *slog.Logger
+	frameLevel slog.Leveler
+}
+
+func newConnLogger(logger *slog.Logger, frameLevel slog.Leveler) *connLogger {
+	if logger == nil {
+		return nil
+	}
+
+	if frameLevel == nil {
+		frameLevel = LevelFrame
+	}
+	return &connLogger{logger: logger, frameLevel: frameLevel}
+}
+
+// SetLogger sets the logger of ws, a connection returned by this package,
+// replacing the one it got from its server or client. Frames are logged at
+// frameLevel, LevelFrame when nil: SetLogger(ws, logger, slog.LevelInfo)
+// turns frame output on for ws alone. A nil logger turns logging off.
+// Other WebSocket implementations are left as is.
+func SetLogger(ws WebSocket, logger *slog.Logger, frameLevel slog.Leveler) {
+	if c, ok := ws.(*webSocketConn); ok {
+		c.logger.Store(newConnLogger(logger, frameLevel))
+	}
+}
+
+// frame implements frameTracer for the logger.
+func (l *connLogger) frame(written bool, opcode Opcode, length int64, fin bool, start time.Time) {
+	ctx := context.Background()
+	level := l.frameLevel.Level()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+
+	direction := "read"
+	if written {
+		direction = "write"
+	}
+
+	l.logger.Log(ctx, level, "websocket: frame",
+		"direction", direction,
+		"opcode", opcode.String(),
+		"length", length,
+		"fin", fin,
+		"duration", time.Since(start),
+	)
+}
+
+// close logs a close frame. The initiator of the closing handshake is the
+// side that sent the first close frame.
+func (l *connLogger) close(written bool, closeErr *CloseError, initiator string) {
+	msg := "websocket: close received"
+	if written {
+		msg = "websocket: close sent"
+	}
+
+	l.logger.Info(msg,
+		"code", int(closeErr.Code),
+		"reason", closeErr.Text,
+		"initiator", initiator,
+	)
+}
+
+// failure logs the protocol violations and timeouts among read and write
+// errors.
+func (l *connLogger) failure(op string, err error) {
+	var (
+		pe *ProtocolError
+		te *TimeoutError
+	)
+
+	switch {
+	case errors.As(err, &pe):
+		l.logger.Warn("websocket: protocol violation", "op", op, "reason", pe.Reason, "status", int(pe.Status))
+	case errors.As(err, &te):
+		l.logger.Warn("websocket: timeout", "op", te.Op)
+	}
+}
+
+// logHandshake logs the result of an opening handshake, attrs describing
+// the peer.
+func logHandshake(logger *slog.Logger, ws *webSocketConn, err error, attrs ...any) {
+	if logger == nil {
+		return
+	}
+
+	switch result := handshakeResult(err); result {
+	case HandshakeAccepted:
+		logger.Info("websocket: handshake accepted", append(attrs, "subprotocol", ws.subprotocol)...)
+	default:
+		logger.Warn("websocket: handshake "+result.String(), append(attrs, "reason", err.Error())...)
+	}
+}
@@ -0,0 +1,268 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMetrics counts the connections of the servers and clients that
+// have no Metrics of their own. It is published with expvar as
+// "websocket".
+var DefaultMetrics = &Metrics{}
+
+func init() {
+	expvar.Publish("websocket", DefaultMetrics)
+}
+
+// HandshakeResult is the outcome of an opening handshake, as counted by
+// Metrics.
+type HandshakeResult int
+
+const (
+	// HandshakeAccepted is a handshake that opened a connection.
+	HandshakeAccepted HandshakeResult = iota
+
+	// HandshakeRejected is a handshake that broke the protocol: a bad
+	// request for servers, a bad response for clients.
+	HandshakeRejected
+
+	// HandshakeFailed is a handshake that did not complete, because of a
+	// network error or a canceled context.
+	HandshakeFailed
+)
+
+func (r HandshakeResult) String() string {
+	switch r {
+	case HandshakeAccepted:
+		return "accepted"
+	case HandshakeRejected:
+		return "rejected"
+	case HandshakeFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Metrics counts the activity of WebSocket connections. It is an
+// expvar.Var, and an http.Handler serving the Prometheus text format.
+// The zero value is ready to use.
+//
+// Messages and bytes are counted by opcode, control frames included, bytes
+// being the length of the message payloads.
+type Metrics struct {
+	active     [2]atomic.Int64
+	handshakes [2][3]atomic.Int64
+
+	// Indexed by direction (in, out) and opcode.
+	messages [2][16]atomic.Int64
+	bytes    [2][16]atomic.Int64
+
+	readErrors  atomic.Int64
+	writeErrors atomic.Int64
+
+	mu sync.Mutex
+	// Indexed by direction (received, sent).
+	closeCodes [2]map[CloseStatus]int64
+}
+
+const (
+	directionIn = iota
+	directionOut
+)
+
+// ActiveConnections returns the number of open connections of role.
+func (m *Metrics) ActiveConnections(role Role) int64 {
+	return m.active[role].Load()
+}
+
+// Handshakes returns the number of opening handshakes of role with the
+// result.
+func (m *Metrics) Handshakes(role Role, result HandshakeResult) int64 {
+	return m.handshakes[role][result].Load()
+}
+
+func (m *Metrics) opened(role Role) {
+	if m != nil {
+		m.active[role].Add(1)
+	}
+}
+
+func (m *Metrics) closed(role Role) {
+	if m != nil {
+		m.active[role].Add(-1)
+	}
+}
+
+// handshake counts the opening handshake of role that ended with err.
+func (m *Metrics) handshake(role Role, err error) {
+	if m == nil {
+		return
+	}
+
+	m.handshakes[role][handshakeResult(err)].Add(1)
+}
+
+// handshakeResult classifies the error of an opening handshake.
+func handshakeResult(err error) HandshakeResult {
+	switch {
+	case err == nil:
+		return HandshakeAccepted
+	case errors.Is(err, ErrBadHandshake), errors.Is(err, ErrBadUpgrade), errors.Is(err, ErrMethodNotAllowed),
+		errors.Is(err, ErrBadExtensions), errors.Is(err, ErrExtendedConnect):
+		return HandshakeRejected
+	}
+	return HandshakeFailed
+}
+
+func (m *Metrics) message(direction int, opc Opcode, n int) {
+	if m != nil {
+		m.messages[direction][opc&0xF].Add(1)
+		m.bytes[direction][opc&0xF].Add(int64(n))
+	}
+}
+
+func (m *Metrics) closeCode(direction int, code CloseStatus) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closeCodes[direction] == nil {
+		m.closeCodes[direction] = map[CloseStatus]int64{}
+	}
+	m.closeCodes[direction][code]++
+}
+
+func (m *Metrics) readError() {
+	if m != nil {
+		m.readErrors.Add(1)
+	}
+}
+
+func (m *Metrics) writeError() {
+	if m != nil {
+		m.writeErrors.Add(1)
+	}
+}
+
+// metricsSample is one sample of a metric, with its labels.
+type metricsSample struct {
+	labels []string
+	value  int64
+}
+
+// metric is a named set of samples.
+type metric struct {
+	name    string
+	typ     string
+	help    string
+	samples []metricsSample
+}
+
+// collect returns the metrics of m, sorted by name then labels.
+func (m *Metrics) collect() []metric {
+	active := metric{name: "websocket_connections_active", typ: "gauge", help: "Open WebSocket connections."}
+	handshakes := metric{name: "websocket_handshakes_total", typ: "counter", help: "Opening handshakes by result."}
+	for _, role := range []Role{RoleClient, RoleServer} {
+		active.samples = append(active.samples, metricsSample{[]string{"role", role.String()}, m.active[role].Load()})
+		for _, result := range []HandshakeResult{HandshakeAccepted, HandshakeFailed, HandshakeRejected} {
+			handshakes.samples = append(handshakes.samples, metricsSample{
+				[]string{"role", role.String(), "result", result.String()},
+				m.handshakes[role][result].Load(),
+			})
+		}
+	}
+
+	messages := metric{name: "websocket_messages_total", typ: "counter", help: "Messages by direction and opcode."}
+	bytes := metric{name: "websocket_message_bytes_total", typ: "counter", help: "Message payload bytes by direction and opcode."}
+	for direction, name := range []string{"in", "out"} {
+		for opc := range m.messages[direction] {
+			n := m.messages[direction][opc].Load()
+			if n == 0 {
+				continue
+			}
+
+			labels := []string{"direction", name, "opcode", strings.ToLower(Opcode(opc).String())}
+			messages.samples = append(messages.samples, metricsSample{labels, n})
+			bytes.samples = append(bytes.samples, metricsSample{labels, m.bytes[direction][opc].Load()})
+		}
+	}
+
+	closes := metric{name: "websocket_close_codes_total", typ: "counter", help: "Close frames by direction and status code."}
+	m.mu.Lock()
+	for direction, name := range []string{"received", "sent"} {
+		for code, n := range m.closeCodes[direction] {
+			closes.samples = append(closes.samples, metricsSample{[]string{"code", fmt.Sprint(int(code)), "direction", name}, n})
+		}
+	}
+	m.mu.Unlock()
+
+	errs := metric{name: "websocket_errors_total", typ: "counter", help: "Failed reads and writes.", samples: []metricsSample{
+		{[]string{"op", "read"}, m.readErrors.Load()},
+		{[]string{"op", "write"}, m.writeErrors.Load()},
+	}}
+
+	metrics := []metric{bytes, closes, active, errs, handshakes, messages}
+	for _, mt := range metrics {
+		slices.SortFunc(mt.samples, func(a, b metricsSample) int {
+			return slices.Compare(a.labels, b.labels)
+		})
+	}
+	return metrics
+}
+
+// String implements expvar.Var, with the metrics as a JSON object keyed by
+// metric name, then by labels.
+func (m *Metrics) String() string {
+	out := map[string]map[string]int64{}
+	for _, mt := range m.collect() {
+		samples := map[string]int64{}
+		for _, s := range mt.samples {
+			samples[formatLabels(s.labels)] = s.value
+		}
+		out[mt.name] = samples
+	}
+
+	b, _ := json.Marshal(out)
+	return string(b)
+}
+
+// ServeHTTP writes the metrics in the Prometheus text exposition format.
+//
+// https://prometheus.io/docs/instrumenting/exposition_formats/#text-based-format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	var b strings.Builder
+	for _, mt := range m.collect() {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", mt.name, mt.help, mt.name, mt.typ)
+		for _, s := range mt.samples {
+			fmt.Fprintf(&b, "%s{%s} %d\n", mt.name, formatLabels(s.labels), s.value)
+		}
+	}
+	w.Write([]byte(b.String()))
+}
+
+// formatLabels formats label name and value pairs as name="value",...
+func formatLabels(labels []string) string {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labels[i], labels[i+1]))
+	}
+	return strings.Join(pairs, ",")
+}
+
+var (
+	_ expvar.Var   = (*Metrics)(nil)
+	_ http.Handler = (*Metrics)(nil)
+)
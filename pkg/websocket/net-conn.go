@@ -0,0 +1,147 @@
+package websocket
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// NetConn exposes ws as a byte stream. Every Write is sent as one message
+// with the opcode opc, Read returns the payload of the data messages
+// received, in order and regardless of their boundaries.
+//
+// Pings are answered while reading and pongs are dropped. A close frame from
+// the peer ends the stream with io.EOF. Close performs the close handshake
+// with CloseNormalClosure before closing the underlying connection.
+//
+// The deadlines of the returned net.Conn are the ones of the connection
+// beneath ws.
+func NetConn(ws WebSocket, opc Opcode) net.Conn {
+	return &netConn{
+		ws:     ws,
+		opcode: opc,
+	}
+}
+
+type netConn struct {
+	ws     WebSocket
+	opcode Opcode
+
+	readMu sync.Mutex
+
+	// pending is what is left of the message being read.
+	pending []byte
+
+	// readErr ends the stream, it is set once the peer closed it or the
+	// connection failed.
+	readErr error
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func (c *netConn) Read(b []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for len(c.pending) == 0 {
+		if c.readErr != nil {
+			return 0, c.readErr
+		}
+
+		if len(b) == 0 {
+			return 0, nil
+		}
+
+		if err := c.readMessage(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// readMessage reads the next message into pending. It must be called with
+// readMu held.
+func (c *netConn) readMessage() error {
+	msg := c.ws.ReadMessage()
+	if msg.Err != nil {
+		var te *TimeoutError
+		if errors.As(msg.Err, &te) {
+			// The stream can go on once the deadline is extended.
+			return msg.Err
+		}
+
+		if IsCloseError(msg.Err) {
+			c.readErr = io.EOF
+		} else {
+			c.readErr = msg.Err
+		}
+		return c.readErr
+	}
+
+	switch msg.Opcode {
+	case OpcodePingFrame:
+		if err := c.ws.WriteMessage(OpcodePongFrame, msg.Data); err != nil && !errors.Is(err, ErrCloseSent) {
+			return err
+		}
+	case OpcodePongFrame:
+	case OpcodeCloseFrame:
+		c.readErr = io.EOF
+	default:
+		c.pending = msg.Data
+	}
+	return nil
+}
+
+func (c *netConn) Write(b []byte) (int, error) {
+	if err := c.ws.WriteMessage(c.opcode, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close sends a close frame and waits for the peer to answer it, or for
+// CloseHandshakeTimeout, before closing the connection. A Read blocked at
+// the same time returns io.EOF once the answer arrives.
+func (c *netConn) Close() error {
+	c.closeOnce.Do(func() {
+		err := StartClose(c.ws, CloseNormalClosure, nil)
+		if err == nil || errors.Is(err, ErrCloseSent) {
+			c.readMu.Lock()
+			for c.readErr == nil {
+				if err := c.readMessage(); err != nil {
+					break
+				}
+			}
+			c.readMu.Unlock()
+		}
+
+		c.closeErr = c.ws.Close()
+	})
+	return c.closeErr
+}
+
+func (c *netConn) LocalAddr() net.Addr {
+	return c.ws.LocalAddr()
+}
+
+func (c *netConn) RemoteAddr() net.Addr {
+	return c.ws.RemoteAddr()
+}
+
+func (c *netConn) SetDeadline(t time.Time) error {
+	return c.ws.SetDeadline(t)
+}
+
+func (c *netConn) SetReadDeadline(t time.Time) error {
+	return c.ws.SetReadDeadline(t)
+}
+
+func (c *netConn) SetWriteDeadline(t time.Time) error {
+	return c.ws.SetWriteDeadline(t)
+}
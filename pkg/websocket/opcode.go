@@ -1,5 +1,7 @@
 package websocket
 
+import "strings"
+
 type Opcode byte
 
 // https://datatracker.ietf.org/doc/html/rfc6455#section-11.8
@@ -53,3 +55,22 @@ func (op Opcode) String() string {
 		return "INVALID"
 	}
 }
+
+// MarshalText encodes op by its name, as in recordings.
+func (op Opcode) MarshalText() ([]byte, error) {
+	if err := op.Valid(); err != nil {
+		return nil, err
+	}
+	return []byte(op.String()), nil
+}
+
+// UnmarshalText decodes the name of an opcode.
+func (op *Opcode) UnmarshalText(b []byte) error {
+	for _, o := range []Opcode{OpcodeContinueFrame, OpcodeTextFrame, OpcodeBinaryFrame, OpcodeCloseFrame, OpcodePingFrame, OpcodePongFrame} {
+		if strings.EqualFold(string(b), o.String()) {
+			*op = o
+			return nil
+		}
+	}
+	return ErrBadOpcode
+}
@@ -0,0 +1,317 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ErrNotConnected is returned by ReconnectingClient while it has no
+// connection, before Connect or while it is reconnecting.
+var ErrNotConnected = errors.New("websocket: not connected")
+
+// Backoff computes the delay before each reconnection attempt. The delay
+// grows from Initial by Multiplier on every failed attempt up to Max, and a
+// random fraction of up to Jitter of it is removed so clients disconnected
+// together do not come back at the same moment.
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	Jitter     float64
+}
+
+// DefaultBackoff is used by ReconnectingClient when Backoff is nil.
+var DefaultBackoff = Backoff{
+	Initial:    500 * time.Millisecond,
+	Max:        30 * time.Second,
+	Multiplier: 2,
+	Jitter:     0.5,
+}
+
+// Delay returns the delay before attempt, counted from 0.
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := float64(b.Initial) * math.Pow(b.Multiplier, float64(attempt))
+	if d > float64(b.Max) || math.IsInf(d, 0) || math.IsNaN(d) {
+		d = float64(b.Max)
+	}
+
+	if b.Jitter > 0 {
+		d -= d * min(b.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(d)
+}
+
+// ReconnectingClient is a client connection that dials URL again when it is
+// lost. Reads go on transparently across reconnections, so OnConnect is the
+// place to send what a new connection needs, e.g. subscriptions.
+//
+// Whether a lost connection is dialed again depends on how it ended:
+//
+//   - CloseNormalClosure and ClosePolicyViolation from the server, or Close,
+//     end the client for good
+//   - CloseServiceRestart reconnects after the initial backoff delay,
+//     without jitter
+//   - CloseTryAgainLater reconnects after the maximum backoff delay
+//   - any other close status or network error reconnects with backoff
+type ReconnectingClient struct {
+	// URL is the ws:// or wss:// URL to dial.
+	URL string
+
+	// Header is sent with every opening handshake.
+	Header http.Header
+
+	// Client dials the connections, a zero WebSocketClient when nil.
+	Client *WebSocketClient
+
+	// Backoff spaces the reconnection attempts, DefaultBackoff when nil.
+	Backoff *Backoff
+
+	// MaxAttempts is the number of consecutive failed attempts after which
+	// the client gives up. Zero means no limit.
+	MaxAttempts int
+
+	// OnConnect is called with every new connection before it is used. An
+	// error closes the connection and counts as a failed attempt.
+	OnConnect func(ws WebSocket) error
+
+	// OnDisconnect is called with the error that ended a connection.
+	OnDisconnect func(err error)
+
+	mu     sync.Mutex
+	ws     WebSocket
+	closed bool
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Connect dials URL, retrying with backoff until it succeeds, ctx is done or
+// MaxAttempts is reached.
+func (rc *ReconnectingClient) Connect(ctx context.Context) error {
+	rc.mu.Lock()
+	if rc.closed {
+		rc.mu.Unlock()
+		return net.ErrClosed
+	}
+	if rc.ctx == nil {
+		rc.ctx, rc.cancel = context.WithCancel(context.Background())
+	}
+	rc.mu.Unlock()
+
+	return rc.connect(ctx, 0)
+}
+
+// connect dials until a connection is established. delay is waited before
+// the first attempt; when it is not zero it stands for the first step of
+// the backoff, which then goes on from the next one.
+func (rc *ReconnectingClient) connect(ctx context.Context, delay time.Duration) error {
+	backoff := DefaultBackoff
+	if rc.Backoff != nil {
+		backoff = *rc.Backoff
+	}
+
+	step := 1
+	if delay > 0 {
+		step = 0
+	}
+
+	var lastErr error
+	for attempt := 0; rc.MaxAttempts == 0 || attempt < rc.MaxAttempts; attempt++ {
+		if attempt > 0 {
+			delay = backoff.Delay(attempt - step)
+		}
+
+		if err := rc.sleep(ctx, delay); err != nil {
+			return err
+		}
+
+		ws, err := rc.dial(ctx)
+		if err == nil {
+			rc.mu.Lock()
+			if rc.closed {
+				rc.mu.Unlock()
+				ws.Close()
+				return net.ErrClosed
+			}
+			rc.ws = ws
+			rc.mu.Unlock()
+			return nil
+		}
+		lastErr = err
+	}
+	return fmt.Errorf("websocket: gave up after %d attempts: %w", rc.MaxAttempts, lastErr)
+}
+
+func (rc *ReconnectingClient) dial(ctx context.Context) (WebSocket, error) {
+	u, err := url.Parse(rc.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	client := rc.Client
+	if client == nil {
+		client = &WebSocketClient{}
+	}
+
+	ws, err := client.DialWithContext(ctx, u, rc.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	if rc.OnConnect != nil {
+		if err := rc.OnConnect(ws); err != nil {
+			ws.Close()
+			return nil, err
+		}
+	}
+	return ws, nil
+}
+
+// sleep waits for d, or until ctx is done or the client is closed.
+func (rc *ReconnectingClient) sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-rc.ctx.Done():
+		return net.ErrClosed
+	}
+}
+
+// Conn returns the current connection, nil while there is none.
+func (rc *ReconnectingClient) Conn() WebSocket {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.ws
+}
+
+// ReadMessage reads the next message, reconnecting as needed. Close frames
+// are not returned, their status decides whether to reconnect. The error of
+// the returned message is final: the client either gave up or was closed.
+func (rc *ReconnectingClient) ReadMessage() Message {
+	for {
+		ws := rc.Conn()
+		if ws == nil {
+			if rc.isClosed() {
+				return Message{Err: net.ErrClosed}
+			}
+			return Message{Err: ErrNotConnected}
+		}
+
+		msg := ws.ReadMessage()
+		if msg.Err == nil && msg.Opcode.IsClose() {
+			// The next read reports the close status.
+			continue
+		}
+
+		if msg.Err == nil {
+			return msg
+		}
+
+		rc.mu.Lock()
+		closed := rc.closed
+		if rc.ws == ws {
+			rc.ws = nil
+		}
+		rc.mu.Unlock()
+		ws.Close()
+
+		if rc.OnDisconnect != nil {
+			rc.OnDisconnect(msg.Err)
+		}
+
+		if closed {
+			return msg
+		}
+
+		delay, retry := rc.reconnectDelay(msg.Err)
+		if !retry {
+			return msg
+		}
+
+		if err := rc.connect(rc.ctx, delay); err != nil {
+			return Message{Err: err}
+		}
+	}
+}
+
+// reconnectDelay decides whether the connection ended by err is dialed again
+// and how long to wait before the first attempt.
+func (rc *ReconnectingClient) reconnectDelay(err error) (time.Duration, bool) {
+	backoff := DefaultBackoff
+	if rc.Backoff != nil {
+		backoff = *rc.Backoff
+	}
+
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) {
+		return backoff.Delay(0), true
+	}
+
+	switch closeErr.Code {
+	case CloseNormalClosure, ClosePolicyViolation:
+		return 0, false
+	case CloseServiceRestart:
+		return backoff.Initial, true
+	case CloseTryAgainLater:
+		return backoff.Max, true
+	default:
+		return backoff.Delay(0), true
+	}
+}
+
+func (rc *ReconnectingClient) WriteMessage(opc Opcode, data []byte) error {
+	ws := rc.Conn()
+	if ws == nil {
+		return ErrNotConnected
+	}
+	return ws.WriteMessage(opc, data)
+}
+
+func (rc *ReconnectingClient) WriteCloseMessage(status CloseStatus, payload []byte) error {
+	ws := rc.Conn()
+	if ws == nil {
+		return ErrNotConnected
+	}
+	return ws.WriteCloseMessage(status, payload)
+}
+
+func (rc *ReconnectingClient) isClosed() bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.closed
+}
+
+// Close stops reconnecting and closes the current connection with
+// CloseNormalClosure.
+func (rc *ReconnectingClient) Close() error {
+	rc.mu.Lock()
+	ws := rc.ws
+	rc.closed = true
+	if rc.cancel != nil {
+		rc.cancel()
+	}
+	rc.mu.Unlock()
+
+	if ws == nil {
+		return nil
+	}
+
+	ws.WriteCloseMessage(CloseNormalClosure, nil)
+	return ws.Close()
+}
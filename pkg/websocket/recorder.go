@@ -0,0 +1,103 @@
+package websocket
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Directions of a Record.
+const (
+	RecordSent     = "sent"
+	RecordReceived = "received"
+)
+
+// Record is a message or control frame sent or received on a recorded
+// connection, one line of a recording.
+type Record struct {
+	// Direction is RecordSent or RecordReceived.
+	Direction string    `json:"direction"`
+	Time      time.Time `json:"time"`
+	Opcode    Opcode    `json:"opcode"`
+
+	// Text is the payload of text messages, Data the payload of the other
+	// messages and frames, base64 encoded. Text messages that are not valid
+	// UTF-8 are kept in Data.
+	Text string `json:"text,omitempty"`
+	Data []byte `json:"data,omitempty"`
+}
+
+// Payload returns the payload of the record.
+func (r *Record) Payload() []byte {
+	if r.Data == nil {
+		return []byte(r.Text)
+	}
+	return r.Data
+}
+
+// Recorder is a WebSocket writing every message and control frame sent and
+// received on it to a recording, as JSON Lines of Record.
+type Recorder struct {
+	WebSocket
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// NewRecorder returns a Recorder of ws writing to w. Only what goes through
+// the Recorder is recorded: the frames ws answers by itself, such as the
+// reply to a close frame, are not.
+func NewRecorder(ws WebSocket, w io.Writer) *Recorder {
+	return &Recorder{WebSocket: ws, enc: json.NewEncoder(w)}
+}
+
+// Err returns the first error writing the recording, after which nothing is
+// recorded.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err
+}
+
+func (r *Recorder) WriteMessage(opc Opcode, data []byte) error {
+	err := r.WebSocket.WriteMessage(opc, data)
+	if err == nil {
+		r.record(RecordSent, opc, data)
+	}
+	return err
+}
+
+func (r *Recorder) WriteCloseMessage(status CloseStatus, payload []byte) error {
+	err := r.WebSocket.WriteCloseMessage(status, payload)
+	if err == nil {
+		r.record(RecordSent, OpcodeCloseFrame, formatClosePayload(status, payload))
+	}
+	return err
+}
+
+func (r *Recorder) ReadMessage() Message {
+	msg := r.WebSocket.ReadMessage()
+	if msg.Err == nil {
+		r.record(RecordReceived, msg.Opcode, msg.Data)
+	}
+	return msg
+}
+
+func (r *Recorder) record(direction string, opc Opcode, payload []byte) {
+	rec := Record{Direction: direction, Time: time.Now(), Opcode: opc}
+	if opc == OpcodeTextFrame && utf8.Valid(payload) {
+		rec.Text = string(payload)
+	} else {
+		rec.Data = payload
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err == nil {
+		r.err = r.enc.Encode(&rec)
+	}
+}
@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// crossHostHeaders are not sent again when a redirect leads to another
+// host, or from wss:// to ws://, and neither is the Authenticator used.
+var crossHostHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Host"}
+
+// redirectLocation returns the location err redirects to, if err is the
+// response of a redirect.
+func redirectLocation(err error) (string, bool) {
+	var resErr *responseError
+	if !errors.As(err, &resErr) {
+		return "", false
+	}
+
+	switch resErr.res.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return "", false
+	}
+
+	location := resErr.res.Header.Get("Location")
+	return location, location != ""
+}
+
+// dialRedirects dials u, then the locations it is redirected to, until a
+// handshake ends with something other than a redirect, or the client gives
+// up with a *HandshakeError.
+func (client *WebSocketClient) dialRedirects(ctx context.Context, u *url.URL, extraHeader http.Header) (WebSocket, error) {
+	via := []*url.URL{u}
+	for {
+		ws, err := client.dial(ctx, u, extraHeader)
+
+		location, ok := redirectLocation(err)
+		if !ok {
+			return ws, err
+		}
+
+		next, err := redirectURL(u, location)
+		if err != nil {
+			return nil, &HandshakeError{URLs: via, Err: err}
+		}
+
+		switch {
+		case len(via) > client.MaxRedirects:
+			err = fmt.Errorf("%w: stopped after %d redirects", ErrBadHandshake, client.MaxRedirects)
+		case client.CheckRedirect != nil:
+			err = client.CheckRedirect(next, via)
+		}
+		if err != nil {
+			return nil, &HandshakeError{URLs: append(via, next), Err: err}
+		}
+
+		if next.Host != u.Host || (u.Scheme == "wss" && next.Scheme == "ws") {
+			extraHeader = extraHeader.Clone()
+			for _, name := range crossHostHeaders {
+				extraHeader.Del(name)
+			}
+
+			other := *client
+			other.Authenticator = nil
+			client = &other
+		}
+
+		via = append(via, next)
+		u = next
+	}
+}
+
+// redirectURL resolves location against u, mapping http:// to ws:// and
+// https:// to wss://.
+func redirectURL(u *url.URL, location string) (*url.URL, error) {
+	if strings.HasSuffix(u.Scheme, "+unix") {
+		return nil, fmt.Errorf("%w: redirects of %s urls are not followed", ErrBadHandshake, u.Scheme)
+	}
+
+	ref, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad redirect location %q", ErrBadHandshake, location)
+	}
+
+	next := u.ResolveReference(ref)
+	switch next.Scheme {
+	case "http":
+		next.Scheme = "ws"
+	case "https":
+		next.Scheme = "wss"
+	case "ws", "wss":
+	default:
+		return nil, fmt.Errorf("%w: bad redirect location %q", ErrBadHandshake, location)
+	}
+	return next, nil
+}
@@ -0,0 +1,240 @@
+package websocket
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDropMessage is returned by a MessageHook to discard a message instead of
+// relaying it.
+var ErrDropMessage = errors.New("websocket: drop message")
+
+// MessageHook inspects a data message before ReverseProxy relays it, and may
+// rewrite msg in place. Returning ErrDropMessage discards the message, any
+// other error closes both connections with ClosePolicyViolation.
+type MessageHook func(req *http.Request, msg *Message) error
+
+// defaultForwardHeaders are the request headers ReverseProxy passes to the
+// upstream server when ForwardHeaders is nil.
+var defaultForwardHeaders = []string{"Authorization", "Cookie", "Origin", "User-Agent"}
+
+// ReverseProxy is an http.Handler that accepts WebSocket connections and
+// relays their messages to an upstream WebSocket server.
+//
+// The upstream connection is opened first, offering the subprotocols of the
+// client, so the client is accepted with the subprotocol the upstream server
+// selected. A client that cannot be relayed is answered with 502 Bad Gateway
+// and no upgrade.
+//
+// Close frames are relayed with their status and reason. When either side
+// goes away without a close frame, the other connection is dropped as well.
+type ReverseProxy struct {
+	// Target is the ws:// or wss:// URL of the upstream server. The path and
+	// query of the request are appended to it.
+	Target *url.URL
+
+	// Client dials the upstream server. Its Subprotocols are replaced by the
+	// ones offered by the client.
+	Client *WebSocketClient
+
+	// ForwardHeaders lists the request headers sent to the upstream server.
+	// When nil, Authorization, Cookie, Origin and User-Agent are forwarded.
+	// X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto are always set.
+	ForwardHeaders []string
+
+	// OnClientMessage and OnUpstreamMessage, when set, are called with every
+	// data message received from the client and from the upstream server.
+	OnClientMessage   MessageHook
+	OnUpstreamMessage MessageHook
+
+	// Logger receives the errors of failed connections at Error level.
+	// Nothing is logged when nil.
+	Logger *slog.Logger
+}
+
+func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, status, err := checkHandshakeRequest(r); err != nil {
+		if status == http.StatusUpgradeRequired {
+			w.Header().Set("Sec-WebSocket-Version", "13")
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	client := WebSocketClient{}
+	if p.Client != nil {
+		client = *p.Client
+	}
+	client.Subprotocols = headerTokens(r.Header, "Sec-WebSocket-Protocol")
+
+	upstream, err := client.DialWithContext(r.Context(), p.upstreamURL(r), p.upstreamHeader(r))
+	if err != nil {
+		p.logError(r, err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+	defer upstream.Close()
+
+	server := &WebSocketServer{}
+	if subprotocol := upstream.Subprotocol(); subprotocol != "" {
+		server.Subprotocols = []string{subprotocol}
+	}
+
+	downstream, err := server.Upgrade(w, r)
+	if err != nil {
+		p.logError(r, err)
+		upstream.WriteCloseMessage(CloseGoingAway, nil)
+		return
+	}
+	defer downstream.Close()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		p.relay(r, downstream, upstream, p.OnClientMessage)
+	}()
+	go func() {
+		defer wg.Done()
+		p.relay(r, upstream, downstream, p.OnUpstreamMessage)
+	}()
+	wg.Wait()
+}
+
+// relay copies the messages of src to dst until src is closed, then closes
+// dst the same way.
+func (p *ReverseProxy) relay(r *http.Request, src, dst WebSocket, hook MessageHook) {
+	for {
+		msg := src.ReadMessage()
+		if msg.Err != nil {
+			var closeErr *CloseError
+			if errors.As(msg.Err, &closeErr) {
+				forwardClose(dst, closeErr)
+				return
+			}
+
+			if !errors.Is(msg.Err, io.EOF) && !errors.Is(msg.Err, net.ErrClosed) {
+				p.logError(r, msg.Err)
+			}
+			dst.Close()
+			return
+		}
+
+		if msg.Opcode.IsClose() {
+			// The next read reports the close status.
+			continue
+		}
+
+		if msg.Opcode.IsData() && hook != nil {
+			err := hook(r, &msg)
+			if errors.Is(err, ErrDropMessage) {
+				continue
+			}
+
+			if err != nil {
+				p.logError(r, err)
+				reason := []byte(err.Error())
+				if len(reason) > 123 {
+					reason = reason[:123]
+				}
+
+				for _, ws := range []WebSocket{src, dst} {
+					StartClose(ws, ClosePolicyViolation, reason)
+				}
+				continue
+			}
+		}
+
+		if err := dst.WriteMessage(msg.Opcode, msg.Data); err != nil && !errors.Is(err, ErrCloseSent) {
+			p.logError(r, err)
+			src.Close()
+			return
+		}
+	}
+}
+
+// forwardClose sends the close status received from one side to the other.
+func forwardClose(ws WebSocket, closeErr *CloseError) {
+	if closeErr.Code != CloseNoStatusReceived {
+		StartClose(ws, closeErr.Code, []byte(closeErr.Text))
+		return
+	}
+
+	// CloseNoStatusReceived is answered with an empty close frame, which
+	// WriteCloseMessage does not send.
+	ws.WriteMessage(OpcodeCloseFrame, nil)
+	ws.SetReadDeadline(time.Now().Add(CloseHandshakeTimeout))
+}
+
+func (p *ReverseProxy) upstreamURL(r *http.Request) *url.URL {
+	u := *p.Target
+	u.Path = joinPath(u.Path, r.URL.Path)
+	u.RawPath = ""
+
+	switch {
+	case u.RawQuery == "":
+		u.RawQuery = r.URL.RawQuery
+	case r.URL.RawQuery != "":
+		u.RawQuery += "&" + r.URL.RawQuery
+	}
+	return &u
+}
+
+func joinPath(a, b string) string {
+	switch {
+	case b == "":
+		return a
+	case strings.HasSuffix(a, "/") && strings.HasPrefix(b, "/"):
+		return a + b[1:]
+	case !strings.HasSuffix(a, "/") && !strings.HasPrefix(b, "/"):
+		return a + "/" + b
+	}
+	return a + b
+}
+
+func (p *ReverseProxy) upstreamHeader(r *http.Request) http.Header {
+	names := p.ForwardHeaders
+	if names == nil {
+		names = defaultForwardHeaders
+	}
+
+	header := http.Header{}
+	for _, name := range names {
+		for _, value := range r.Header.Values(name) {
+			header.Add(name, value)
+		}
+	}
+
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := r.Header.Values("X-Forwarded-For"); len(prior) > 0 {
+			ip = strings.Join(prior, ", ") + ", " + ip
+		}
+		header.Set("X-Forwarded-For", ip)
+	}
+
+	header.Set("X-Forwarded-Host", r.Host)
+	if r.TLS != nil {
+		header.Set("X-Forwarded-Proto", "wss")
+	} else {
+		header.Set("X-Forwarded-Proto", "ws")
+	}
+	return header
+}
+
+func (p *ReverseProxy) logError(r *http.Request, err error) {
+	if p.Logger != nil {
+		p.Logger.Error("websocket: proxy failed", "path", r.URL.Path, "error", err.Error())
+	}
+}
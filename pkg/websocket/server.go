@@ -3,16 +3,58 @@ package websocket
 import (
 	"crypto/sha1"
 	"encoding/base64"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"slices"
 	"strings"
 )
 
 type WebSocketServer struct {
 	Subprotocols []string
+
+	// Extensions are accepted when a client offers them, in the order the
+	// client lists its offers.
+	Extensions []Extension
+
+	// Metrics counts the handshakes and connections of the server,
+	// DefaultMetrics when nil.
+	Metrics *Metrics
+
+	// Logger receives the records of the handshakes and connections of the
+	// server. Nothing is logged when nil.
+	Logger *slog.Logger
+
+	// FrameLogLevel is the level of the records logged for every frame,
+	// LevelFrame when nil. SetLogger changes it for a single connection.
+	FrameLogLevel slog.Leveler
 }
 
+// Upgrade accepts the opening handshake of req and returns the WebSocket
+// connection. HTTP/1.1 requests are upgraded by hijacking the connection,
+// HTTP/2 extended CONNECT requests (RFC 8441) get the stream of req.
 func (this *WebSocketServer) Upgrade(res http.ResponseWriter, req *http.Request) (WebSocket, error) {
+	metrics := this.Metrics
+	if metrics == nil {
+		metrics = DefaultMetrics
+	}
+
+	ws, err := this.upgrade(res, req)
+	metrics.handshake(RoleServer, err)
+	logHandshake(this.Logger, ws, err, "remote_addr", req.RemoteAddr, "origin", req.Header.Get("Origin"))
+	if err != nil {
+		return nil, err
+	}
+
+	ws.setMetrics(metrics)
+	ws.setLogger(this.Logger, this.FrameLogLevel, "role", RoleServer.String(), "remote_addr", req.RemoteAddr)
+	return ws, nil
+}
+
+func (this *WebSocketServer) upgrade(res http.ResponseWriter, req *http.Request) (*webSocketConn, error) {
+	if req.ProtoMajor == 2 {
+		return this.upgradeHTTP2(res, req)
+	}
+
 	if req.Method != "GET" {
 		res.WriteHeader(http.StatusMethodNotAllowed)
 		return nil, ErrMethodNotAllowed
@@ -27,17 +69,25 @@ func (this *WebSocketServer) Upgrade(res http.ResponseWriter, req *http.Request)
 	//      Origin: http://example.com
 	//      Sec-WebSocket-Protocol: chat, superchat
 	//      Sec-WebSocket-Version: 13
-	if req.Header.Get("Connection") != "Upgrade" || req.Header.Get("Upgrade") != "websocket" {
-		res.WriteHeader(http.StatusUpgradeRequired)
-		return nil, ErrBadUpgrade
+	clientKey, status, err := checkHandshakeRequest(req)
+	if err != nil {
+		if status == http.StatusUpgradeRequired {
+			res.Header().Set("Sec-WebSocket-Version", "13")
+		}
+		res.WriteHeader(status)
+		return nil, err
 	}
 
-	if req.Header.Get("Sec-WebSocket-Version") != "13" || req.Header.Get("Sec-WebSocket-Key") == "" {
-		res.WriteHeader(http.StatusBadRequest)
-		return nil, ErrBadHandshake
+	subprotocol, extensions, accepted, err := this.negotiate(res, req)
+	if err != nil {
+		return nil, err
 	}
 
-	clientKey := req.Header.Get("Sec-WebSocket-Key")
+	conn, readwriter, err := http.NewResponseController(res).Hijack()
+	if err != nil {
+		http.Error(res, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return nil, wrapError(err)
+	}
 
 	// The handshake from the server looks as follows:
 	//      HTTP/1.1 101 Switching Protocols
@@ -45,27 +95,90 @@ func (this *WebSocketServer) Upgrade(res http.ResponseWriter, req *http.Request)
 	//      Connection: Upgrade
 	//      Sec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=
 	//      Sec-WebSocket-Protocol: chat
-	res.WriteHeader(http.StatusSwitchingProtocols)
-	res.Header().Set("Upgrade", "websocket")
-	res.Header().Set("Connection", "Upgrade")
-	res.Header().Set("Sec-WebSocket-Accept", serverKey(clientKey))
-
-	if subprotocols, ok := req.Header["Sec-Websocket-Protocol"]; ok {
-		for i := range this.Subprotocols {
-			subprotocol := strings.TrimSpace(this.Subprotocols[i])
-			if slices.Contains(subprotocols, subprotocol) {
-				res.Header().Add("Sec-WebSocket-Protocol", subprotocol)
-			}
-		}
+	//
+	// It is written on the hijacked connection so the headers reach the
+	// client exactly as listed, whatever the ResponseWriter buffered.
+	var b strings.Builder
+	b.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	b.WriteString("Upgrade: websocket\r\n")
+	b.WriteString("Connection: Upgrade\r\n")
+	fmt.Fprintf(&b, "Sec-WebSocket-Accept: %s\r\n", serverKey(clientKey))
+	if subprotocol != "" {
+		fmt.Fprintf(&b, "Sec-WebSocket-Protocol: %s\r\n", subprotocol)
 	}
+	if len(accepted) > 0 {
+		fmt.Fprintf(&b, "Sec-WebSocket-Extensions: %s\r\n", FormatExtensions(accepted))
+	}
+	b.WriteString("\r\n")
 
-	conn, readwriter, err := http.NewResponseController(res).Hijack()
-	if err != nil {
+	if _, err := readwriter.WriteString(b.String()); err != nil {
+		_ = conn.Close()
+		return nil, wrapError(err)
+	}
+
+	if err := readwriter.Flush(); err != nil {
 		_ = conn.Close()
 		return nil, wrapError(err)
 	}
 
-	return NewConn(conn, readwriter.Reader, readwriter.Writer, false), nil
+	ws := NewConn(conn, readwriter.Reader, readwriter.Writer, false).(*webSocketConn)
+	ws.setTrace(ContextConnTrace(req.Context()))
+	ws.subprotocol = subprotocol
+	ws.setExtensions(extensions)
+	return ws, nil
+}
+
+// checkHandshakeRequest validates the opening handshake of a client and
+// returns its key, or the HTTP status to reject it with.
+//
+// https://datatracker.ietf.org/doc/html/rfc6455#section-4.2.1
+func checkHandshakeRequest(req *http.Request) (string, int, error) {
+	if !req.ProtoAtLeast(1, 1) {
+		return "", http.StatusBadRequest, fmt.Errorf("%w: protocol %s", ErrBadHandshake, req.Proto)
+	}
+
+	if !headerContainsToken(req.Header, "Connection", "upgrade") || !headerContainsToken(req.Header, "Upgrade", "websocket") {
+		return "", http.StatusUpgradeRequired, ErrBadUpgrade
+	}
+
+	if req.Header.Get("Sec-WebSocket-Version") != "13" {
+		return "", http.StatusUpgradeRequired, fmt.Errorf("%w: unsupported version %q", ErrBadHandshake, req.Header.Get("Sec-WebSocket-Version"))
+	}
+
+	clientKey := strings.TrimSpace(req.Header.Get("Sec-WebSocket-Key"))
+	if key, err := base64.StdEncoding.DecodeString(clientKey); err != nil || len(key) != 16 {
+		return "", http.StatusBadRequest, fmt.Errorf("%w: invalid Sec-WebSocket-Key", ErrBadHandshake)
+	}
+
+	return clientKey, http.StatusSwitchingProtocols, nil
+}
+
+// negotiate selects the subprotocol and the extensions of the connection,
+// rejecting req when its extension offers cannot be parsed.
+func (this *WebSocketServer) negotiate(res http.ResponseWriter, req *http.Request) (string, extensionPipeline, []ExtensionSpec, error) {
+	offers, err := ParseExtensions(req.Header)
+	if err != nil {
+		res.WriteHeader(http.StatusBadRequest)
+		return "", nil, nil, fmt.Errorf("%w: %w", ErrBadHandshake, err)
+	}
+
+	extensions, accepted := acceptExtensions(this.Extensions, offers)
+	return this.selectSubprotocol(req), extensions, accepted, nil
+}
+
+// selectSubprotocol picks the first of the server subprotocols offered by
+// the client.
+func (this *WebSocketServer) selectSubprotocol(req *http.Request) string {
+	offered := headerTokens(req.Header, "Sec-WebSocket-Protocol")
+	for i := range this.Subprotocols {
+		subprotocol := strings.TrimSpace(this.Subprotocols[i])
+		for _, o := range offered {
+			if o == subprotocol {
+				return subprotocol
+			}
+		}
+	}
+	return ""
 }
 
 func serverKey(clientKey string) string {
@@ -74,3 +187,26 @@ func serverKey(clientKey string) string {
 	hash.Write([]byte("258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
 	return base64.StdEncoding.EncodeToString(hash.Sum(nil))
 }
+
+// headerTokens returns the comma separated tokens of every value of name.
+func headerTokens(header http.Header, name string) []string {
+	var tokens []string
+	for _, value := range header.Values(name) {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// headerContainsToken reports whether name lists token, ignoring case.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, t := range headerTokens(header, name) {
+		if strings.EqualFold(t, token) {
+			return true
+		}
+	}
+	return false
+}
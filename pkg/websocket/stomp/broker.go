@@ -0,0 +1,116 @@
+package stomp
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// Ack modes of a subscription.
+const (
+	AckAuto             = "auto"
+	AckClient           = "client"
+	AckClientIndividual = "client-individual"
+)
+
+// Broker is an in-memory message broker. Every message sent to a
+// destination is delivered to all of its subscriptions at that time, and is
+// dropped when there are none.
+type Broker struct {
+	// DeadLetter, when set, is the destination NACKed messages are sent to.
+	// They are dropped otherwise.
+	DeadLetter string
+
+	mu            sync.Mutex
+	subscriptions map[string]map[*subscription]struct{}
+
+	nextMessageID atomic.Uint64
+}
+
+// NewBroker returns an empty broker.
+func NewBroker() *Broker {
+	return &Broker{subscriptions: map[string]map[*subscription]struct{}{}}
+}
+
+// subscription is a SUBSCRIBE of a session.
+type subscription struct {
+	id          string
+	destination string
+	ack         string
+	session     *session
+}
+
+// Publish sends a message to destination. header is copied into the MESSAGE
+// frames, except for the headers the broker sets itself.
+func (b *Broker) Publish(destination string, header Header, body []byte) {
+	b.mu.Lock()
+	subs := make([]*subscription, 0, len(b.subscriptions[destination]))
+	for sub := range b.subscriptions[destination] {
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+
+	messageID := strconv.FormatUint(b.nextMessageID.Add(1), 10)
+	for _, sub := range subs {
+		msg := &Frame{Command: CommandMessage, Body: body}
+		for _, f := range header {
+			switch f.Key {
+			case "destination", "message-id", "subscription", "ack", "receipt", "transaction", "content-length":
+			default:
+				msg.Header.Add(f.Key, f.Value)
+			}
+		}
+
+		msg.Header.Set("destination", destination)
+		msg.Header.Set("message-id", messageID)
+		msg.Header.Set("subscription", sub.id)
+		sub.session.deliver(sub, msg)
+	}
+}
+
+// Subscribers returns the number of subscriptions to destination.
+func (b *Broker) Subscribers(destination string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subscriptions[destination])
+}
+
+func (b *Broker) subscribe(sub *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscriptions == nil {
+		b.subscriptions = map[string]map[*subscription]struct{}{}
+	}
+
+	subs := b.subscriptions[sub.destination]
+	if subs == nil {
+		subs = map[*subscription]struct{}{}
+		b.subscriptions[sub.destination] = subs
+	}
+	subs[sub] = struct{}{}
+}
+
+func (b *Broker) unsubscribe(sub *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs := b.subscriptions[sub.destination]
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.subscriptions, sub.destination)
+	}
+}
+
+// nack hands a message rejected by a client to the dead letter destination.
+func (b *Broker) nack(msg *Frame) {
+	if b.DeadLetter == "" {
+		return
+	}
+
+	header := Header{{Key: "original-destination", Value: msg.Header.Get("destination")}}
+	for _, f := range msg.Header {
+		header = append(header, f)
+	}
+	b.Publish(b.DeadLetter, header, msg.Body)
+}
@@ -0,0 +1,445 @@
+package stomp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// ErrClosed is returned by the methods of a Client after Close.
+var ErrClosed = errors.New("stomp: connection closed")
+
+// Error is an ERROR frame sent by the server.
+type Error struct {
+	Frame *Frame
+}
+
+func (e *Error) Error() string {
+	return "stomp: server error: " + e.Frame.Header.Get("message")
+}
+
+// Options configure the STOMP connection of a Client.
+type Options struct {
+	// Host is the virtual host of the CONNECT frame. Dial defaults it to the
+	// host of the URL.
+	Host string
+
+	Login    string
+	Passcode string
+
+	// HeartBeatSend is the smallest interval at which the client can send
+	// heart-beats, and HeartBeatReceive the interval at which it would like
+	// to receive them. Zero disables either direction.
+	HeartBeatSend    time.Duration
+	HeartBeatReceive time.Duration
+
+	// Header is added to the CONNECT frame.
+	Header Header
+
+	// WebSocketClient opens the connections of Dial. It is copied and made
+	// to offer Subprotocol.
+	WebSocketClient *websocket.WebSocketClient
+}
+
+// Client is a STOMP 1.2 connection to a server. Its methods are safe for
+// concurrent use.
+type Client struct {
+	ws      websocket.WebSocket
+	session string
+	server  string
+
+	mu       sync.Mutex
+	subs     map[string]*Subscription
+	receipts map[string]chan error
+	nextID   uint64
+	err      error
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Subscription is a SUBSCRIBE of a Client.
+type Subscription struct {
+	ID          string
+	Destination string
+	Ack         string
+
+	// C receives the MESSAGE frames of the subscription. It is closed when
+	// the connection ends, and no longer receives after Unsubscribe.
+	C <-chan *Frame
+
+	c      chan *Frame
+	done   chan struct{}
+	client *Client
+}
+
+// Dial opens a WebSocket connection to rawurl and connects to the STOMP
+// server behind it.
+func Dial(ctx context.Context, rawurl string, opts *Options) (*Client, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.Host == "" {
+		o.Host = u.Hostname()
+	}
+
+	client := websocket.WebSocketClient{}
+	if o.WebSocketClient != nil {
+		client = *o.WebSocketClient
+	}
+	client.Subprotocols = []string{Subprotocol}
+
+	ws, err := client.DialWithContext(ctx, u, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := Connect(ctx, ws, &o)
+	if err != nil {
+		ws.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Connect sends the CONNECT frame over ws and waits for the server to
+// accept it.
+func Connect(ctx context.Context, ws websocket.WebSocket, opts *Options) (*Client, error) {
+	var o Options
+	if opts != nil {
+		o = *opts
+	}
+
+	connect := NewFrame(CommandConnect,
+		"accept-version", "1.2",
+		"host", o.Host,
+		"heart-beat", formatHeartbeat(o.HeartBeatSend, o.HeartBeatReceive),
+	)
+	if o.Login != "" {
+		connect.Header.Set("login", o.Login)
+		connect.Header.Set("passcode", o.Passcode)
+	}
+	connect.Header = append(connect.Header, o.Header...)
+
+	if err := writeFrame(ws, connect); err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		ws.SetReadDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() { ws.SetReadDeadline(time.Now()) })
+	f, err := readFrame(ws, 0)
+	stop()
+	ws.SetReadDeadline(time.Time{})
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch f.Command {
+	case CommandConnected:
+	case CommandError:
+		return nil, &Error{Frame: f}
+	default:
+		return nil, fmt.Errorf("%w: expected CONNECTED found %s", ErrInvalidFrame, f.Command)
+	}
+
+	if version := f.Header.Get("version"); version != "1.2" {
+		return nil, fmt.Errorf("stomp: unsupported version %q", version)
+	}
+
+	out, in, err := negotiateHeartbeat(o.HeartBeatSend, o.HeartBeatReceive, f.Header.Get("heart-beat"))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		ws:       ws,
+		session:  f.Header.Get("session"),
+		server:   f.Header.Get("server"),
+		subs:     map[string]*Subscription{},
+		receipts: map[string]chan error{},
+		done:     make(chan struct{}),
+	}
+
+	go c.readLoop(in)
+	if out > 0 {
+		go sendHeartbeats(ws, out, c.done)
+	}
+	return c, nil
+}
+
+// Session returns the session header of the CONNECTED frame.
+func (c *Client) Session() string {
+	return c.session
+}
+
+// Server returns the server header of the CONNECTED frame.
+func (c *Client) Server() string {
+	return c.server
+}
+
+// WebSocket returns the underlying connection.
+func (c *Client) WebSocket() websocket.WebSocket {
+	return c.ws
+}
+
+// Done is closed when the connection ends.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection ended, an *Error when the server sent an
+// ERROR frame. It returns nil while the connection is open.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// WriteFrame sends f as is.
+func (c *Client) WriteFrame(f *Frame) error {
+	select {
+	case <-c.done:
+		return c.Err()
+	default:
+	}
+	return writeFrame(c.ws, f)
+}
+
+// Send sends body to destination.
+func (c *Client) Send(destination, contentType string, body []byte) error {
+	f := NewFrame(CommandSend, "destination", destination)
+	if contentType != "" {
+		f.Header.Set("content-type", contentType)
+	}
+	f.Body = body
+	return c.WriteFrame(f)
+}
+
+// Request sends f with a receipt header and waits for the server to
+// acknowledge it with a RECEIPT frame.
+func (c *Client) Request(ctx context.Context, f *Frame) error {
+	ch := make(chan error, 1)
+
+	c.mu.Lock()
+	id := c.newID("receipt-")
+	c.receipts[id] = ch
+	c.mu.Unlock()
+
+	f.Header.Set("receipt", id)
+	if err := c.WriteFrame(f); err != nil {
+		c.dropReceipt(id)
+		return err
+	}
+
+	select {
+	case err := <-ch:
+		return err
+	case <-c.done:
+		// The receipt may have arrived right before the connection ended,
+		// as it does after DISCONNECT.
+		select {
+		case err := <-ch:
+			return err
+		default:
+			return c.Err()
+		}
+	case <-ctx.Done():
+		c.dropReceipt(id)
+		return ctx.Err()
+	}
+}
+
+// Subscribe subscribes to destination with the given ack mode, AckAuto when
+// empty, and waits for the server to confirm it.
+func (c *Client) Subscribe(ctx context.Context, destination, ack string) (*Subscription, error) {
+	if ack == "" {
+		ack = AckAuto
+	}
+
+	ch := make(chan *Frame, 64)
+	sub := &Subscription{
+		Destination: destination,
+		Ack:         ack,
+		C:           ch,
+		c:           ch,
+		done:        make(chan struct{}),
+		client:      c,
+	}
+
+	c.mu.Lock()
+	if c.subs == nil {
+		c.mu.Unlock()
+		return nil, c.Err()
+	}
+	sub.ID = c.newID("sub-")
+	c.subs[sub.ID] = sub
+	c.mu.Unlock()
+
+	err := c.Request(ctx, NewFrame(CommandSubscribe, "id", sub.ID, "destination", destination, "ack", ack))
+	if err != nil {
+		c.removeSubscription(sub)
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Unsubscribe ends the subscription and waits for the server to confirm it.
+func (s *Subscription) Unsubscribe(ctx context.Context) error {
+	if !s.client.removeSubscription(s) {
+		return nil
+	}
+	return s.client.Request(ctx, NewFrame(CommandUnsubscribe, "id", s.ID))
+}
+
+// Ack acknowledges msg, received on a subscription with a client ack mode.
+func (c *Client) Ack(msg *Frame) error {
+	return c.settle(CommandAck, msg)
+}
+
+// Nack rejects msg, received on a subscription with a client ack mode.
+func (c *Client) Nack(msg *Frame) error {
+	return c.settle(CommandNack, msg)
+}
+
+func (c *Client) settle(command string, msg *Frame) error {
+	id, ok := msg.Header.Lookup("ack")
+	if !ok {
+		return fmt.Errorf("stomp: cannot %s a message without an ack header", command)
+	}
+	return c.WriteFrame(NewFrame(command, "id", id))
+}
+
+// Disconnect sends a DISCONNECT frame, waits for its receipt and for the
+// server to close the connection.
+func (c *Client) Disconnect(ctx context.Context) error {
+	err := c.Request(ctx, NewFrame(CommandDisconnect))
+	if err == nil {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	c.Close()
+	return err
+}
+
+// Close closes the connection without disconnecting.
+func (c *Client) Close() error {
+	c.shutdown(ErrClosed)
+	return c.ws.Close()
+}
+
+// newID returns a new receipt or subscription id. c.mu must be held.
+func (c *Client) newID(prefix string) string {
+	c.nextID++
+	return prefix + strconv.FormatUint(c.nextID, 10)
+}
+
+func (c *Client) dropReceipt(id string) {
+	c.mu.Lock()
+	delete(c.receipts, id)
+	c.mu.Unlock()
+}
+
+// removeSubscription reports whether sub was still subscribed.
+func (c *Client) removeSubscription(sub *Subscription) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.subs[sub.ID] != sub {
+		return false
+	}
+	delete(c.subs, sub.ID)
+	close(sub.done)
+	return true
+}
+
+// shutdown records why the connection ended. Only the first call counts.
+func (c *Client) shutdown(err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		close(c.done)
+	})
+}
+
+func (c *Client) readLoop(in time.Duration) {
+	defer func() {
+		c.mu.Lock()
+		for _, sub := range c.subs {
+			close(sub.c)
+		}
+		c.subs = nil
+		c.mu.Unlock()
+	}()
+
+	for {
+		f, err := readFrame(c.ws, in)
+		if err != nil {
+			c.shutdown(err)
+			if errors.Is(err, ErrHeartbeatTimeout) {
+				c.ws.Close()
+			}
+			return
+		}
+
+		switch f.Command {
+		case CommandMessage:
+			c.mu.Lock()
+			sub := c.subs[f.Header.Get("subscription")]
+			c.mu.Unlock()
+
+			if sub != nil {
+				select {
+				case sub.c <- f:
+				case <-sub.done:
+				case <-c.done:
+				}
+			}
+
+		case CommandReceipt:
+			c.resolve(f.Header.Get("receipt-id"), nil)
+
+		case CommandError:
+			err := &Error{Frame: f}
+			if id, ok := f.Header.Lookup("receipt-id"); ok {
+				c.resolve(id, err)
+			}
+			c.shutdown(err)
+		}
+	}
+}
+
+func (c *Client) resolve(id string, err error) {
+	c.mu.Lock()
+	ch, ok := c.receipts[id]
+	delete(c.receipts, id)
+	c.mu.Unlock()
+
+	if ok {
+		ch <- err
+	}
+}
@@ -0,0 +1,271 @@
+// Package stomp implements STOMP 1.2 over a WebSocket, with an in-memory
+// broker to serve it and a client to speak it.
+//
+// Every STOMP frame is sent as one text message, and the connections
+// negotiate the "v12.stomp" subprotocol. Heart-beats are sent as messages
+// holding a single end of line.
+//
+//	http.Handle("/stomp", &stomp.Server{Broker: stomp.NewBroker()})
+//
+//	c, err := stomp.Dial(ctx, "ws://localhost:8080/stomp", nil)
+//	sub, err := c.Subscribe(ctx, "/queue/a", stomp.AckAuto)
+//	err = c.Send("/queue/a", "text/plain", []byte("hello"))
+//	msg := <-sub.C
+//
+// https://stomp.github.io/stomp-specification-1.2.html
+package stomp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Client commands.
+const (
+	CommandConnect     = "CONNECT"
+	CommandStomp       = "STOMP"
+	CommandSend        = "SEND"
+	CommandSubscribe   = "SUBSCRIBE"
+	CommandUnsubscribe = "UNSUBSCRIBE"
+	CommandAck         = "ACK"
+	CommandNack        = "NACK"
+	CommandBegin       = "BEGIN"
+	CommandCommit      = "COMMIT"
+	CommandAbort       = "ABORT"
+	CommandDisconnect  = "DISCONNECT"
+)
+
+// Server commands.
+const (
+	CommandConnected = "CONNECTED"
+	CommandMessage   = "MESSAGE"
+	CommandReceipt   = "RECEIPT"
+	CommandError     = "ERROR"
+)
+
+// ErrInvalidFrame is returned for frames that do not follow STOMP 1.2.
+var ErrInvalidFrame = errors.New("stomp: invalid frame")
+
+// Field is one header line of a frame.
+type Field struct {
+	Key   string
+	Value string
+}
+
+// Header holds the header lines of a frame in order. A header may be
+// repeated, in which case only its first value is significant.
+type Header []Field
+
+// Get returns the first value of key, or an empty string.
+func (h Header) Get(key string) string {
+	value, _ := h.Lookup(key)
+	return value
+}
+
+// Lookup returns the first value of key and whether it is present.
+func (h Header) Lookup(key string) (string, bool) {
+	for _, f := range h {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set replaces the first value of key, or adds it.
+func (h *Header) Set(key, value string) {
+	for i, f := range *h {
+		if f.Key == key {
+			(*h)[i].Value = value
+			return
+		}
+	}
+	h.Add(key, value)
+}
+
+// Add appends a value of key.
+func (h *Header) Add(key, value string) {
+	*h = append(*h, Field{Key: key, Value: value})
+}
+
+// Del removes every value of key.
+func (h *Header) Del(key string) {
+	fields := (*h)[:0]
+	for _, f := range *h {
+		if f.Key != key {
+			fields = append(fields, f)
+		}
+	}
+	*h = fields
+}
+
+// Frame is a STOMP frame. Over a WebSocket, every message holds one frame.
+//
+// https://stomp.github.io/stomp-specification-1.2.html#STOMP_Frames
+type Frame struct {
+	Command string
+	Header  Header
+	Body    []byte
+}
+
+// NewFrame returns a frame with the header given as key, value pairs.
+func NewFrame(command string, keyValues ...string) *Frame {
+	f := &Frame{Command: command}
+	for i := 0; i+1 < len(keyValues); i += 2 {
+		f.Header.Add(keyValues[i], keyValues[i+1])
+	}
+	return f
+}
+
+// escapes reports whether the header of command is escaped. CONNECT and
+// CONNECTED are left as is for compatibility with STOMP 1.0.
+func escapes(command string) bool {
+	return command != CommandConnect && command != CommandConnected
+}
+
+var (
+	headerEscaper   = strings.NewReplacer("\\", "\\\\", "\r", "\\r", "\n", "\\n", ":", "\\c")
+	headerUnescaper = strings.NewReplacer("\\\\", "\\", "\\r", "\r", "\\n", "\n", "\\c", ":")
+)
+
+// Bytes encodes the frame. A content-length header is added when the frame
+// has a body and none is set.
+func (f *Frame) Bytes() []byte {
+	var b bytes.Buffer
+	b.WriteString(f.Command)
+	b.WriteByte('\n')
+
+	escape := escapes(f.Command)
+	for _, field := range f.Header {
+		if escape {
+			headerEscaper.WriteString(&b, field.Key)
+			b.WriteByte(':')
+			headerEscaper.WriteString(&b, field.Value)
+		} else {
+			b.WriteString(field.Key)
+			b.WriteByte(':')
+			b.WriteString(field.Value)
+		}
+		b.WriteByte('\n')
+	}
+
+	if _, ok := f.Header.Lookup("content-length"); !ok && len(f.Body) > 0 {
+		fmt.Fprintf(&b, "content-length:%d\n", len(f.Body))
+	}
+
+	b.WriteByte('\n')
+	b.Write(f.Body)
+	b.WriteByte(0)
+	return b.Bytes()
+}
+
+// isHeartbeat reports whether data holds nothing but end of lines, which is
+// how heart-beats are sent.
+func isHeartbeat(data []byte) bool {
+	return len(bytes.Trim(data, "\r\n")) == 0
+}
+
+// ParseFrame decodes the frame held by data. Leading end of lines, left by
+// heart-beats, are skipped.
+//
+// https://stomp.github.io/stomp-specification-1.2.html#Augmented_BNF
+func ParseFrame(data []byte) (*Frame, error) {
+	data = bytes.TrimLeft(data, "\r\n")
+
+	line, rest, ok := cutLine(data)
+	if !ok || line == "" {
+		return nil, fmt.Errorf("%w: missing command", ErrInvalidFrame)
+	}
+
+	f := &Frame{Command: line}
+	escape := escapes(f.Command)
+
+	for {
+		line, rest, ok = cutLine(rest)
+		if !ok {
+			return nil, fmt.Errorf("%w: unterminated header", ErrInvalidFrame)
+		}
+
+		if line == "" {
+			break
+		}
+
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			return nil, fmt.Errorf("%w: header line %q", ErrInvalidFrame, line)
+		}
+
+		if escape {
+			if !validEscapes(key) || !validEscapes(value) {
+				return nil, fmt.Errorf("%w: undefined escape in %q", ErrInvalidFrame, line)
+			}
+			key, value = headerUnescaper.Replace(key), headerUnescaper.Replace(value)
+		}
+		f.Header.Add(key, value)
+	}
+
+	var end int
+	if length, ok := f.Header.Lookup("content-length"); ok {
+		n, err := strconv.Atoi(length)
+		if err != nil || n < 0 || n >= len(rest) {
+			return nil, fmt.Errorf("%w: content-length %q", ErrInvalidFrame, length)
+		}
+
+		if rest[n] != 0 {
+			return nil, fmt.Errorf("%w: body longer than its content-length", ErrInvalidFrame)
+		}
+		end = n
+	} else {
+		end = bytes.IndexByte(rest, 0)
+		if end < 0 {
+			return nil, fmt.Errorf("%w: missing NULL octet", ErrInvalidFrame)
+		}
+	}
+
+	if !isHeartbeat(rest[end+1:]) {
+		return nil, fmt.Errorf("%w: data after the NULL octet", ErrInvalidFrame)
+	}
+
+	if end > 0 {
+		f.Body = rest[:end]
+	}
+	return f, nil
+}
+
+// cutLine splits data after the first end of line, which is either LF or
+// CRLF.
+func cutLine(data []byte) (string, []byte, bool) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return "", data, false
+	}
+
+	line := data[:i]
+	line = bytes.TrimSuffix(line, []byte{'\r'})
+	return string(line), data[i+1:], true
+}
+
+// validEscapes reports whether every backslash of s starts one of the
+// escape sequences of STOMP 1.2.
+func validEscapes(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			continue
+		}
+
+		if i+1 == len(s) {
+			return false
+		}
+
+		switch s[i+1] {
+		case '\\', 'r', 'n', 'c':
+			i++
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,112 @@
+package stomp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// ErrHeartbeatTimeout ends a connection on which nothing was received for
+// twice the negotiated heart-beat interval.
+var ErrHeartbeatTimeout = errors.New("stomp: heart-beat timeout")
+
+// heartbeatEOL is the content of a heart-beat message.
+var heartbeatEOL = []byte("\n")
+
+func formatHeartbeat(send, receive time.Duration) string {
+	return fmt.Sprintf("%d,%d", send.Milliseconds(), receive.Milliseconds())
+}
+
+func parseHeartbeat(value string) (send, receive time.Duration, err error) {
+	if value == "" {
+		return 0, 0, nil
+	}
+
+	x, y, ok := strings.Cut(value, ",")
+	if !ok {
+		return 0, 0, fmt.Errorf("%w: heart-beat %q", ErrInvalidFrame, value)
+	}
+
+	sx, errX := strconv.ParseUint(strings.TrimSpace(x), 10, 32)
+	sy, errY := strconv.ParseUint(strings.TrimSpace(y), 10, 32)
+	if errX != nil || errY != nil {
+		return 0, 0, fmt.Errorf("%w: heart-beat %q", ErrInvalidFrame, value)
+	}
+	return time.Duration(sx) * time.Millisecond, time.Duration(sy) * time.Millisecond, nil
+}
+
+// negotiateHeartbeat returns how often to send heart-beats and how long the
+// other end may stay silent, from what this end can do and the heart-beat
+// header of the other end. Zero disables either.
+//
+// https://stomp.github.io/stomp-specification-1.2.html#Heart-beating
+func negotiateHeartbeat(send, receive time.Duration, peer string) (out, in time.Duration, err error) {
+	peerSend, peerReceive, err := parseHeartbeat(peer)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if send > 0 && peerReceive > 0 {
+		out = max(send, peerReceive)
+	}
+
+	if receive > 0 && peerSend > 0 {
+		in = max(receive, peerSend)
+	}
+	return out, in, nil
+}
+
+// sendHeartbeats writes a heart-beat to ws every interval until done is
+// closed.
+func sendHeartbeats(ws websocket.WebSocket, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := ws.WriteMessage(websocket.OpcodeTextFrame, heartbeatEOL); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// readFrame reads the next frame from ws, skipping heart-beats. When in is
+// not zero, the other end must send something at least every 2*in.
+func readFrame(ws websocket.WebSocket, in time.Duration) (*Frame, error) {
+	for {
+		if in > 0 {
+			ws.SetReadDeadline(time.Now().Add(2 * in))
+		}
+
+		msg := ws.ReadMessage()
+		if msg.Err != nil {
+			var te *websocket.TimeoutError
+			if in > 0 && errors.As(msg.Err, &te) {
+				return nil, ErrHeartbeatTimeout
+			}
+			return nil, msg.Err
+		}
+
+		switch msg.Opcode {
+		case websocket.OpcodePingFrame:
+			ws.WriteMessage(websocket.OpcodePongFrame, msg.Data)
+		case websocket.OpcodeTextFrame, websocket.OpcodeBinaryFrame:
+			if isHeartbeat(msg.Data) {
+				continue
+			}
+			return ParseFrame(msg.Data)
+		}
+	}
+}
+
+func writeFrame(ws websocket.WebSocket, f *Frame) error {
+	return ws.WriteMessage(websocket.OpcodeTextFrame, f.Bytes())
+}
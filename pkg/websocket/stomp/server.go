@@ -0,0 +1,347 @@
+package stomp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// Subprotocol is the WebSocket subprotocol of STOMP 1.2.
+const Subprotocol = "v12.stomp"
+
+// Server is an http.Handler that serves STOMP 1.2 sessions on the WebSocket
+// connections it accepts, against Broker.
+type Server struct {
+	// Broker routes the messages of every session. It must be set.
+	Broker *Broker
+
+	// WebSocketServer upgrades the requests. When nil, one offering
+	// Subprotocol is used. Clients that offer no subprotocol are served as
+	// well.
+	WebSocketServer *websocket.WebSocketServer
+
+	// HeartBeatSend is the smallest interval at which the server can send
+	// heart-beats, and HeartBeatReceive the interval at which it would like
+	// to receive them. Zero disables either direction.
+	HeartBeatSend    time.Duration
+	HeartBeatReceive time.Duration
+
+	// Authenticate, when set, checks the login and passcode headers of the
+	// CONNECT frame. The error it returns is sent to the client.
+	Authenticate func(login, passcode string) error
+
+	nextSession atomic.Uint64
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server := s.WebSocketServer
+	if server == nil {
+		server = &websocket.WebSocketServer{Subprotocols: []string{Subprotocol}}
+	}
+
+	ws, err := server.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	sess := &session{
+		id:     "session-" + strconv.FormatUint(s.nextSession.Add(1), 10),
+		broker: s.Broker,
+		ws:     ws,
+		subs:   map[string]*subscription{},
+	}
+	defer sess.end()
+
+	f, err := readFrame(ws, 0)
+	if err != nil {
+		if errors.Is(err, ErrInvalidFrame) {
+			sess.fail(nil, err)
+		}
+		return
+	}
+
+	out, in, err := s.connect(sess, f)
+	if err != nil {
+		sess.fail(f, err)
+		return
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	if out > 0 {
+		go sendHeartbeats(ws, out, done)
+	}
+
+	for {
+		f, err := readFrame(ws, in)
+		if err != nil {
+			if errors.Is(err, ErrInvalidFrame) {
+				sess.fail(nil, err)
+			}
+			return
+		}
+
+		disconnect, err := sess.handle(f)
+		if err != nil {
+			sess.fail(f, err)
+			return
+		}
+
+		if disconnect {
+			sess.close(websocket.CloseNormalClosure)
+			return
+		}
+	}
+}
+
+// connect handles the first frame of a session and answers it with a
+// CONNECTED frame. It returns the negotiated heart-beat intervals.
+func (s *Server) connect(sess *session, f *Frame) (out, in time.Duration, err error) {
+	if f.Command != CommandConnect && f.Command != CommandStomp {
+		return 0, 0, fmt.Errorf("%w: expected CONNECT found %s", ErrInvalidFrame, f.Command)
+	}
+
+	versions := strings.Split(f.Header.Get("accept-version"), ",")
+	if !slices.Contains(versions, "1.2") {
+		return 0, 0, errors.New("supported protocol versions are 1.2")
+	}
+
+	if s.Authenticate != nil {
+		if err := s.Authenticate(f.Header.Get("login"), f.Header.Get("passcode")); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	out, in, err = negotiateHeartbeat(s.HeartBeatSend, s.HeartBeatReceive, f.Header.Get("heart-beat"))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	connected := NewFrame(CommandConnected,
+		"version", "1.2",
+		"heart-beat", formatHeartbeat(s.HeartBeatSend, s.HeartBeatReceive),
+		"session", sess.id,
+	)
+	return out, in, writeFrame(sess.ws, connected)
+}
+
+// session is the state of one STOMP connection.
+type session struct {
+	id     string
+	broker *Broker
+	ws     websocket.WebSocket
+
+	// subs is only used by the goroutine serving the session.
+	subs map[string]*subscription
+
+	mu      sync.Mutex
+	unacked []pending
+	nextAck uint64
+}
+
+// pending is a message delivered to a client ack mode subscription, waiting
+// for an ACK or NACK.
+type pending struct {
+	id  string
+	sub *subscription
+	msg *Frame
+}
+
+// deliver sends a MESSAGE frame of sub. It blocks the publisher until the
+// frame is written.
+func (s *session) deliver(sub *subscription, msg *Frame) {
+	if sub.ack != AckAuto {
+		s.mu.Lock()
+		s.nextAck++
+		id := strconv.FormatUint(s.nextAck, 10)
+		msg.Header.Set("ack", id)
+		s.unacked = append(s.unacked, pending{id: id, sub: sub, msg: msg})
+		s.mu.Unlock()
+	}
+
+	writeFrame(s.ws, msg)
+}
+
+// handle processes a frame sent after CONNECT. It reports whether the
+// client disconnected.
+func (s *session) handle(f *Frame) (disconnect bool, err error) {
+	switch f.Command {
+	case CommandSend:
+		destination, err := requireHeader(f, "destination")
+		if err != nil {
+			return false, err
+		}
+
+		if _, ok := f.Header.Lookup("transaction"); ok {
+			return false, errors.New("transactions are not supported")
+		}
+		s.broker.Publish(destination, f.Header, f.Body)
+
+	case CommandSubscribe:
+		destination, err := requireHeader(f, "destination")
+		if err != nil {
+			return false, err
+		}
+
+		id, err := requireHeader(f, "id")
+		if err != nil {
+			return false, err
+		}
+
+		if _, ok := s.subs[id]; ok {
+			return false, fmt.Errorf("subscription %q already exists", id)
+		}
+
+		ack := f.Header.Get("ack")
+		switch ack {
+		case "":
+			ack = AckAuto
+		case AckAuto, AckClient, AckClientIndividual:
+		default:
+			return false, fmt.Errorf("%w: ack mode %q", ErrInvalidFrame, ack)
+		}
+
+		sub := &subscription{id: id, destination: destination, ack: ack, session: s}
+		s.subs[id] = sub
+		s.broker.subscribe(sub)
+
+	case CommandUnsubscribe:
+		id, err := requireHeader(f, "id")
+		if err != nil {
+			return false, err
+		}
+
+		sub, ok := s.subs[id]
+		if !ok {
+			return false, fmt.Errorf("no subscription %q", id)
+		}
+		s.unsubscribe(sub)
+
+	case CommandAck, CommandNack:
+		id, err := requireHeader(f, "id")
+		if err != nil {
+			return false, err
+		}
+
+		if err := s.ack(id, f.Command == CommandNack); err != nil {
+			return false, err
+		}
+
+	case CommandBegin, CommandCommit, CommandAbort:
+		return false, errors.New("transactions are not supported")
+
+	case CommandDisconnect:
+		disconnect = true
+
+	case CommandConnect, CommandStomp:
+		return false, errors.New("already connected")
+
+	default:
+		return false, fmt.Errorf("%w: unknown command %q", ErrInvalidFrame, f.Command)
+	}
+
+	if receipt, ok := f.Header.Lookup("receipt"); ok {
+		if err := writeFrame(s.ws, NewFrame(CommandReceipt, "receipt-id", receipt)); err != nil {
+			return false, err
+		}
+	}
+	return disconnect, nil
+}
+
+// ack settles the message acknowledged by id. On a client subscription, it
+// also settles every message of that subscription delivered before.
+func (s *session) ack(id string, nack bool) error {
+	s.mu.Lock()
+	i := slices.IndexFunc(s.unacked, func(p pending) bool { return p.id == id })
+	if i < 0 {
+		s.mu.Unlock()
+		return fmt.Errorf("no message to acknowledge with id %q", id)
+	}
+
+	target := s.unacked[i]
+	var settled []pending
+	kept := s.unacked[:0]
+	for j, p := range s.unacked {
+		if j == i || (target.sub.ack == AckClient && p.sub == target.sub && j < i) {
+			settled = append(settled, p)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	s.unacked = kept
+	s.mu.Unlock()
+
+	if nack {
+		for _, p := range settled {
+			s.broker.nack(p.msg)
+		}
+	}
+	return nil
+}
+
+func (s *session) unsubscribe(sub *subscription) {
+	s.broker.unsubscribe(sub)
+	delete(s.subs, sub.id)
+
+	s.mu.Lock()
+	s.unacked = slices.DeleteFunc(s.unacked, func(p pending) bool { return p.sub == sub })
+	s.mu.Unlock()
+}
+
+// end removes the subscriptions of the session. Messages that were not
+// acknowledged are dropped.
+func (s *session) end() {
+	for _, sub := range s.subs {
+		s.unsubscribe(sub)
+	}
+}
+
+// fail sends an ERROR frame about err, in reply to f when it is not nil, and
+// closes the connection.
+func (s *session) fail(f *Frame, err error) {
+	msg := NewFrame(CommandError, "message", err.Error())
+	if f != nil {
+		if receipt, ok := f.Header.Lookup("receipt"); ok {
+			msg.Header.Set("receipt-id", receipt)
+		}
+
+		if f.Command == CommandConnect || f.Command == CommandStomp {
+			msg.Header.Set("version", "1.2")
+		}
+	}
+
+	writeFrame(s.ws, msg)
+	s.close(websocket.CloseProtocolError)
+}
+
+// close starts the closing handshake and waits for the close frame of the
+// client.
+func (s *session) close(status websocket.CloseStatus) {
+	if err := websocket.StartClose(s.ws, status, nil); err != nil {
+		return
+	}
+
+	for {
+		msg := s.ws.ReadMessage()
+		if msg.Err != nil || msg.Opcode == websocket.OpcodeCloseFrame {
+			return
+		}
+	}
+}
+
+func requireHeader(f *Frame, key string) (string, error) {
+	value := f.Header.Get(key)
+	if value == "" {
+		return "", fmt.Errorf("%w: %s frame without a %s header", ErrInvalidFrame, f.Command, key)
+	}
+	return value, nil
+}
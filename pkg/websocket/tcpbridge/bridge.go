@@ -0,0 +1,305 @@
+// Package tcpbridge pipes WebSocket connections to TCP connections, in the
+// way websockify does.
+//
+// Server accepts WebSocket connections and dials a TCP target for each one,
+// ReverseServer accepts TCP connections and dials a WebSocket endpoint for
+// each one. Both speak the websockify subprotocols: "binary" sends the
+// stream as binary messages and "base64" as base64 encoded text messages.
+// Without a negotiated subprotocol the stream is sent as binary messages.
+package tcpbridge
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+const (
+	SubprotocolBinary = "binary"
+	SubprotocolBase64 = "base64"
+)
+
+// DefaultSubprotocols lists the subprotocols Server offers when none are
+// configured, in order of preference.
+var DefaultSubprotocols = []string{SubprotocolBinary, SubprotocolBase64}
+
+// ErrShutdown is returned once Shutdown has been called.
+var ErrShutdown = errors.New("tcpbridge: shutting down")
+
+const bufferSize = 32 << 10
+
+// bridge is one WebSocket connection piped to one TCP connection.
+type bridge struct {
+	id     uint64
+	remote string
+
+	ws  websocket.WebSocket
+	tcp net.Conn
+}
+
+// goAway starts the close handshake, the bridge ends once the peer answers.
+func (b *bridge) goAway() {
+	if b.ws == nil {
+		return
+	}
+	websocket.StartClose(b.ws, websocket.CloseGoingAway, nil)
+}
+
+func (b *bridge) close() {
+	if b.ws != nil {
+		b.ws.Close()
+	}
+	if b.tcp != nil {
+		b.tcp.Close()
+	}
+}
+
+// tracker keeps the bridges of a server so it can limit and shut them down.
+type tracker struct {
+	mu       sync.Mutex
+	bridges  map[*bridge]struct{}
+	nextID   uint64
+	closing  bool
+	wg       sync.WaitGroup
+	shutdown chan struct{}
+}
+
+// reserve registers a new bridge. It fails when max bridges are already
+// running or the server is shutting down.
+func (t *tracker) reserve(remote string, max int) (*bridge, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closing {
+		return nil, ErrShutdown
+	}
+
+	if max > 0 && len(t.bridges) >= max {
+		return nil, fmt.Errorf("tcpbridge: limit of %d connections reached", max)
+	}
+
+	if t.bridges == nil {
+		t.bridges = make(map[*bridge]struct{})
+	}
+
+	t.nextID++
+	b := &bridge{id: t.nextID, remote: remote}
+	t.bridges[b] = struct{}{}
+	t.wg.Add(1)
+	return b, nil
+}
+
+// start attaches the connections to b. It fails when Shutdown was called
+// while they were being set up.
+func (t *tracker) start(b *bridge, ws websocket.WebSocket, tcp net.Conn) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b.ws, b.tcp = ws, tcp
+	if t.closing {
+		return ErrShutdown
+	}
+	return nil
+}
+
+func (t *tracker) release(b *bridge) {
+	t.mu.Lock()
+	delete(t.bridges, b)
+	t.mu.Unlock()
+
+	t.wg.Done()
+}
+
+func (t *tracker) isClosing() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.closing
+}
+
+// done is closed when Shutdown is called.
+func (t *tracker) done() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.shutdown == nil {
+		t.shutdown = make(chan struct{})
+	}
+	return t.shutdown
+}
+
+// Shutdown sends CloseGoingAway on every bridge and waits for them to end.
+// When ctx is done first the remaining connections are closed abruptly and
+// the context error is returned.
+func (t *tracker) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	if !t.closing {
+		t.closing = true
+		if t.shutdown == nil {
+			t.shutdown = make(chan struct{})
+		}
+		close(t.shutdown)
+	}
+
+	for b := range t.bridges {
+		b.goAway()
+	}
+	t.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+	}
+
+	t.mu.Lock()
+	for b := range t.bridges {
+		b.close()
+	}
+	t.mu.Unlock()
+
+	<-finished
+	return ctx.Err()
+}
+
+// codec maps the bytes of the TCP stream to WebSocket messages for the
+// negotiated subprotocol.
+type codec struct {
+	opcode websocket.Opcode
+	base64 bool
+}
+
+func newCodec(subprotocol string) codec {
+	if subprotocol == SubprotocolBase64 {
+		return codec{opcode: websocket.OpcodeTextFrame, base64: true}
+	}
+	return codec{opcode: websocket.OpcodeBinaryFrame}
+}
+
+func (c codec) encode(b []byte) []byte {
+	if !c.base64 {
+		return b
+	}
+	return base64.StdEncoding.AppendEncode(nil, b)
+}
+
+func (c codec) decode(b []byte) ([]byte, error) {
+	if !c.base64 {
+		return b, nil
+	}
+	return base64.StdEncoding.AppendDecode(nil, b)
+}
+
+// stats describes a bridge once it has ended.
+type stats struct {
+	toTCP int64
+	toWS  int64
+
+	// reason is why the bridge ended.
+	reason string
+}
+
+// pipe copies between ws and tcp until either side ends, then performs the
+// close handshake and closes both connections.
+func pipe(ws websocket.WebSocket, tcp net.Conn) stats {
+	var st stats
+	c := newCodec(ws.Subprotocol())
+
+	done := make(chan struct{})
+	var wsReason string
+	go func() {
+		defer tcp.Close()
+		defer close(done)
+
+		wsReason = copyToTCP(tcp, ws, c, &st.toTCP)
+	}()
+
+	tcpReason, status := copyToWebSocket(ws, tcp, c, &st.toWS)
+
+	select {
+	case <-done:
+		st.reason = wsReason
+	default:
+		st.reason = tcpReason
+		websocket.StartClose(ws, status, nil)
+		<-done
+	}
+
+	ws.Close()
+	return st
+}
+
+// copyToTCP writes the messages read from ws to tcp and returns why it
+// stopped.
+func copyToTCP(tcp net.Conn, ws websocket.WebSocket, c codec, n *int64) string {
+	for {
+		msg := ws.ReadMessage()
+		if msg.Err != nil {
+			var closeErr *websocket.CloseError
+			if errors.As(msg.Err, &closeErr) {
+				return fmt.Sprintf("websocket closed with %d %s", closeErr.Code, closeErr.Code)
+			}
+			return msg.Err.Error()
+		}
+
+		switch msg.Opcode {
+		case websocket.OpcodePingFrame:
+			ws.WriteMessage(websocket.OpcodePongFrame, msg.Data)
+		case websocket.OpcodeCloseFrame:
+			continue
+		case websocket.OpcodeTextFrame, websocket.OpcodeBinaryFrame:
+			data, err := c.decode(msg.Data)
+			if err != nil {
+				ws.WriteCloseMessage(websocket.CloseInvalidFramePayloadData, nil)
+				return "invalid base64 message"
+			}
+
+			written, err := tcp.Write(data)
+			*n += int64(written)
+			if err != nil {
+				return err.Error()
+			}
+		}
+	}
+}
+
+// copyToWebSocket sends what is read from tcp to ws. It returns why it
+// stopped and the close status to report to the peer.
+func copyToWebSocket(ws websocket.WebSocket, tcp net.Conn, c codec, n *int64) (string, websocket.CloseStatus) {
+	buf := make([]byte, bufferSize)
+	for {
+		read, err := tcp.Read(buf)
+		if read > 0 {
+			if werr := ws.WriteMessage(c.opcode, c.encode(buf[:read])); werr != nil {
+				return werr.Error(), websocket.CloseGoingAway
+			}
+			*n += int64(read)
+		}
+
+		if err == io.EOF {
+			return "tcp closed", websocket.CloseNormalClosure
+		}
+		if err != nil {
+			return err.Error(), websocket.CloseGoingAway
+		}
+	}
+}
+
+func logf(logger *log.Logger, format string, args ...any) {
+	if logger == nil {
+		logger = log.Default()
+	}
+	logger.Printf(format, args...)
+}
@@ -0,0 +1,122 @@
+package tcpbridge
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// ReverseServer accepts TCP connections and pipes every one of them to a new
+// WebSocket connection to URL.
+type ReverseServer struct {
+	// URL is the ws:// or wss:// endpoint every connection is piped to.
+	URL string
+
+	// Subprotocol is offered to the endpoint, SubprotocolBinary when empty.
+	Subprotocol string
+
+	// Header is sent with every opening handshake.
+	Header http.Header
+
+	// MaxConns limits the number of bridges running at once, connections
+	// above it are closed as soon as they are accepted. Zero means no limit.
+	MaxConns int
+
+	// DialTimeout bounds the connection to URL, 10 seconds when zero.
+	DialTimeout time.Duration
+
+	// Logger receives one line when a bridge starts and one when it ends,
+	// the standard logger when nil.
+	Logger *log.Logger
+
+	tracker
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+func (s *ReverseServer) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln until Shutdown is called, then returns
+// ErrShutdown. ln is closed when Serve returns.
+func (s *ReverseServer) Serve(ln net.Listener) error {
+	stop := make(chan struct{})
+	defer close(stop)
+
+	go func() {
+		select {
+		case <-s.done():
+			ln.Close()
+		case <-stop:
+		}
+	}()
+	defer ln.Close()
+
+	for {
+		tcp, err := ln.Accept()
+		if err != nil {
+			if s.isClosing() {
+				return ErrShutdown
+			}
+			return err
+		}
+		go s.handle(tcp)
+	}
+}
+
+func (s *ReverseServer) handle(tcp net.Conn) {
+	b, err := s.reserve(tcp.RemoteAddr().String(), s.MaxConns)
+	if err != nil {
+		logf(s.Logger, "rejected %s: %v", tcp.RemoteAddr(), err)
+		tcp.Close()
+		return
+	}
+	defer s.release(b)
+
+	ws, err := s.dial()
+	if err != nil {
+		logf(s.Logger, "conn %d: rejected %s: %v", b.id, b.remote, err)
+		tcp.Close()
+		return
+	}
+
+	if err := s.start(b, ws, tcp); err != nil {
+		ws.WriteCloseMessage(websocket.CloseGoingAway, nil)
+		b.close()
+		return
+	}
+
+	serve(s.Logger, b, s.URL)
+}
+
+func (s *ReverseServer) dial() (websocket.WebSocket, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	subprotocol := s.Subprotocol
+	if subprotocol == "" {
+		subprotocol = SubprotocolBinary
+	}
+
+	timeout := s.DialTimeout
+	if timeout == 0 {
+		timeout = defaultDialTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	client := &websocket.WebSocketClient{Subprotocols: []string{subprotocol}}
+	return client.DialWithContext(ctx, u, s.Header)
+}
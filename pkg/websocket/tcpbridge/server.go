@@ -0,0 +1,96 @@
+package tcpbridge
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+const defaultDialTimeout = 10 * time.Second
+
+// Server is an http.Handler that upgrades every request and pipes the
+// WebSocket connection to a new TCP connection to Target.
+type Server struct {
+	// Target is the host:port every connection is piped to.
+	Target string
+
+	// Subprotocols are offered to clients in order of preference,
+	// DefaultSubprotocols when empty.
+	Subprotocols []string
+
+	// MaxConns limits the number of bridges running at once, requests above
+	// it are rejected with 503. Zero means no limit.
+	MaxConns int
+
+	// DialTimeout bounds the connection to Target, 10 seconds when zero.
+	DialTimeout time.Duration
+
+	// Logger receives one line when a bridge starts and one when it ends,
+	// the standard logger when nil.
+	Logger *log.Logger
+
+	tracker
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, err := s.reserve(r.RemoteAddr, s.MaxConns)
+	if err != nil {
+		logf(s.Logger, "rejected %s: %v", r.RemoteAddr, err)
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+	defer s.release(b)
+
+	timeout := s.DialTimeout
+	if timeout == 0 {
+		timeout = defaultDialTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	tcp, err := (&net.Dialer{}).DialContext(ctx, "tcp", s.Target)
+	cancel()
+	if err != nil {
+		logf(s.Logger, "conn %d: rejected %s: %v", b.id, b.remote, err)
+		http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		return
+	}
+
+	subprotocols := s.Subprotocols
+	if len(subprotocols) == 0 {
+		subprotocols = DefaultSubprotocols
+	}
+
+	ws, err := (&websocket.WebSocketServer{Subprotocols: subprotocols}).Upgrade(w, r)
+	if err != nil {
+		tcp.Close()
+		logf(s.Logger, "conn %d: rejected %s: %v", b.id, b.remote, err)
+		return
+	}
+
+	if err := s.start(b, ws, tcp); err != nil {
+		ws.WriteCloseMessage(websocket.CloseGoingAway, nil)
+		b.close()
+		return
+	}
+
+	serve(s.Logger, b, s.Target)
+}
+
+// serve runs a started bridge and logs its life.
+func serve(logger *log.Logger, b *bridge, target string) {
+	subprotocol := b.ws.Subprotocol()
+	if subprotocol == "" {
+		subprotocol = "none"
+	}
+	logf(logger, "conn %d: %s connected to %s, subprotocol %s", b.id, b.remote, target, subprotocol)
+
+	start := time.Now()
+	st := pipe(b.ws, b.tcp)
+
+	logf(logger, "conn %d: closed after %s, %d bytes to tcp, %d bytes to websocket: %s",
+		b.id, time.Since(start).Round(time.Millisecond), st.toTCP, st.toWS, st.reason)
+}
@@ -0,0 +1,121 @@
+package websocket
+
+import (
+	"context"
+	"time"
+)
+
+// ConnTrace is a set of hooks run on the frames of a WebSocket connection,
+// to debug the traffic of a connection. Any hook may be nil.
+//
+// Hooks run on the goroutine reading or writing the frame, while it holds
+// the read or write lock of the connection, so they must return quickly and
+// must not use the connection.
+type ConnTrace struct {
+	// OnFrameRead is called for every frame read, control frames and
+	// fragments included, once its payload has been read.
+	OnFrameRead func(FrameInfo)
+
+	// OnFrameWrite is called for every frame written.
+	OnFrameWrite func(FrameInfo)
+
+	// OnPing and OnPong are called for every ping or pong frame, read or
+	// written, after OnFrameRead or OnFrameWrite.
+	OnPing func(FrameInfo)
+	OnPong func(FrameInfo)
+
+	// OnClose is called when a close frame is read or written.
+	OnClose func(CloseInfo)
+}
+
+// FrameInfo describes a frame read or written.
+type FrameInfo struct {
+	Opcode Opcode
+
+	// Length is the length of the payload on the wire.
+	Length int64
+	Fin    bool
+
+	// Written is set for frames written, and unset for frames read.
+	Written bool
+
+	// Start is when the header of the frame was read, or when the frame
+	// started to be written. Duration is how long reading the payload, or
+	// writing the frame, took.
+	Start    time.Time
+	Duration time.Duration
+}
+
+// CloseInfo describes a close frame read or written.
+type CloseInfo struct {
+	Code   CloseStatus
+	Reason string
+
+	// Written is set when the close frame was sent by this side of the
+	// connection, which then initiated the closing handshake unless it is
+	// answering a close frame read earlier.
+	Written bool
+	Time    time.Time
+}
+
+// frameTracer is told about every frame read or written.
+type frameTracer interface {
+	frame(written bool, opcode Opcode, length int64, fin bool, start time.Time)
+}
+
+type connTraceKey struct{}
+
+// WithConnTrace returns a context carrying trace. Connections dialed with
+// the context, or upgraded from a request with the context, run the hooks
+// of trace.
+func WithConnTrace(ctx context.Context, trace *ConnTrace) context.Context {
+	return context.WithValue(ctx, connTraceKey{}, trace)
+}
+
+// ContextConnTrace returns the ConnTrace of ctx, or nil when it has none.
+func ContextConnTrace(ctx context.Context) *ConnTrace {
+	trace, _ := ctx.Value(connTraceKey{}).(*ConnTrace)
+	return trace
+}
+
+func (t *ConnTrace) frame(written bool, opcode Opcode, length int64, fin bool, start time.Time) {
+	if t == nil {
+		return
+	}
+
+	info := FrameInfo{
+		Opcode:   opcode,
+		Length:   length,
+		Fin:      fin,
+		Written:  written,
+		Start:    start,
+		Duration: time.Since(start),
+	}
+
+	if written && t.OnFrameWrite != nil {
+		t.OnFrameWrite(info)
+	}
+	if !written && t.OnFrameRead != nil {
+		t.OnFrameRead(info)
+	}
+
+	switch {
+	case opcode == OpcodePingFrame && t.OnPing != nil:
+		t.OnPing(info)
+	case opcode == OpcodePongFrame && t.OnPong != nil:
+		t.OnPong(info)
+	}
+}
+
+func (t *ConnTrace) close(written bool, closeErr *CloseError) {
+	if t == nil || t.OnClose == nil {
+		return
+	}
+
+	t.OnClose(CloseInfo{
+		Code:    closeErr.Code,
+		Reason:  closeErr.Text,
+		Written: written,
+		Time:    time.Now(),
+	})
+}
@@ -0,0 +1,74 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// unixTarget splits a ws+unix:// or wss+unix:// URL into the path of the
+// socket and the URL of the request. The socket path and the request path
+// are separated by a colon, as in
+//
+//	ws+unix:///var/run/agent.sock:/events?since=10
+//
+// and the request path defaults to "/". The host of the URL, "localhost"
+// when empty, is only sent as the Host header.
+func unixTarget(u *url.URL) (string, *url.URL, error) {
+	socket, path, _ := strings.Cut(u.Path, ":")
+	if socket == "" {
+		return "", nil, fmt.Errorf("websocket: missing socket path in %s url", u.Scheme)
+	}
+
+	if path == "" {
+		path = "/"
+	}
+
+	target := *u
+	target.Scheme = "http"
+	if u.Scheme == "wss+unix" {
+		target.Scheme = "https"
+	}
+	if target.Host == "" {
+		target.Host = "localhost"
+	}
+	target.Path, target.RawPath = path, ""
+	return socket, &target, nil
+}
+
+// ListenUnix listens on the Unix domain socket at path. A socket file left
+// behind by a previous process is removed first, unless a server still
+// accepts connections on it. The file is removed when the listener is
+// closed.
+func ListenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode().Type() == fs.ModeSocket {
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("websocket: socket %s is in use", path)
+		}
+
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// ServeUnix serves HTTP requests, and the WebSocket connections handler
+// upgrades, on the Unix domain socket at path. Clients reach it with
+// ws+unix:// URLs.
+func ServeUnix(path string, handler http.Handler) error {
+	ln, err := ListenUnix(path)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	return http.Serve(ln, handler)
+}
@@ -0,0 +1,144 @@
+package websocket_test
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+	"github.com/prafitradimas/websocket/pkg/websocket/conformance"
+)
+
+// newAuthServer serves WebSocket echo to the requests authorized accepts,
+// and answers the others with 401 and challenge. It counts the handshakes
+// it receives.
+func newAuthServer(t *testing.T, challenge string, authorized func(r *http.Request) bool) (string, *atomic.Int32) {
+	t.Helper()
+
+	var requests atomic.Int32
+	echo := conformance.EchoHandler(&websocket.WebSocketServer{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if !authorized(r) {
+			w.Header().Set("WWW-Authenticate", challenge)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		echo.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+
+	return "ws" + strings.TrimPrefix(s.URL, "http"), &requests
+}
+
+func TestBasicAuth(t *testing.T) {
+	url, requests := newAuthServer(t, `Basic realm="ws"`, func(r *http.Request) bool {
+		user, pass, ok := r.BasicAuth()
+		return ok && user == "alice" && pass == "secret"
+	})
+
+	ws, err := (&websocket.WebSocketClient{}).DialWithContext(context.Background(), newURL(strings.Replace(url, "://", "://alice:secret@", 1)), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	ws.Close()
+
+	// Wrong credentials are not retried.
+	client := &websocket.WebSocketClient{Authenticator: &websocket.BasicAuth{Username: "alice", Password: "wrong"}}
+	_, err = client.DialWithContext(context.Background(), newURL(url), nil)
+	if !errors.Is(err, websocket.ErrBadHandshake) || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expect a 401 ErrBadHandshake found %v", err)
+	}
+
+	if n := requests.Load(); n != 2 {
+		t.Fatalf("expect 2 handshakes found %d", n)
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	url, requests := newAuthServer(t, `Bearer realm="ws", error="invalid_token"`, func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer fresh"
+	})
+
+	var refreshes []bool
+	client := &websocket.WebSocketClient{Authenticator: &websocket.BearerAuth{
+		Token: func(ctx context.Context, refresh bool) (string, error) {
+			refreshes = append(refreshes, refresh)
+			if refresh {
+				return "fresh", nil
+			}
+			return "expired", nil
+		},
+	}}
+
+	ws, err := client.DialWithContext(context.Background(), newURL(url), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	ws.Close()
+
+	if n := requests.Load(); n != 2 || len(refreshes) != 2 || refreshes[0] || !refreshes[1] {
+		t.Fatalf("expect a retry with a refreshed token found %d handshakes, %v", n, refreshes)
+	}
+}
+
+// digestParams parses the parameters of a Digest Authorization header.
+func digestParams(header string) map[string]string {
+	params := map[string]string{}
+	for _, param := range strings.Split(strings.TrimPrefix(header, "Digest "), ", ") {
+		name, value, _ := strings.Cut(param, "=")
+		params[name] = strings.Trim(value, `"`)
+	}
+	return params
+}
+
+func TestDigestAuth(t *testing.T) {
+	for algorithm, newHash := range map[string]func() hash.Hash{"MD5": md5.New, "SHA-256": sha256.New} {
+		t.Run(algorithm, func(t *testing.T) {
+			h := func(s string) string {
+				sum := newHash()
+				sum.Write([]byte(s))
+				return hex.EncodeToString(sum.Sum(nil))
+			}
+
+			challenge := `Digest realm="ws@example.com", qop="auth, auth-int", algorithm=` + algorithm + `, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`
+			url, requests := newAuthServer(t, challenge, func(r *http.Request) bool {
+				p := digestParams(r.Header.Get("Authorization"))
+				ha1 := h("Mufasa:ws@example.com:Circle of Life")
+				ha2 := h(r.Method + ":" + r.RequestURI)
+				expect := h(ha1 + ":" + p["nonce"] + ":" + p["nc"] + ":" + p["cnonce"] + ":auth:" + ha2)
+
+				return p["username"] == "Mufasa" && p["uri"] == r.RequestURI && p["algorithm"] == algorithm &&
+					p["opaque"] == "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS" && p["response"] == expect
+			})
+
+			auth := &websocket.DigestAuth{Username: "Mufasa", Password: "Circle of Life"}
+			client := &websocket.WebSocketClient{Authenticator: auth}
+
+			ws, err := client.DialWithContext(context.Background(), newURL(url+"/chat?room=1"), nil)
+			if err != nil {
+				t.Fatalf("DialWithContext: %v", err)
+			}
+			ws.Close()
+
+			// The challenge is reused without a new 401.
+			ws, err = client.DialWithContext(context.Background(), newURL(url+"/chat?room=2"), nil)
+			if err != nil {
+				t.Fatalf("DialWithContext: %v", err)
+			}
+			ws.Close()
+
+			if n := requests.Load(); n != 3 {
+				t.Fatalf("expect 3 handshakes found %d", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,375 @@
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+	"github.com/prafitradimas/websocket/pkg/websocket/conformance"
+)
+
+func TestDialTLS(t *testing.T) {
+	server := httptest.NewTLSServer(conformance.EchoHandler(&websocket.WebSocketServer{}))
+	defer server.Close()
+
+	client := &websocket.WebSocketClient{
+		TLSClientConfig: server.Client().Transport.(*http.Transport).TLSClientConfig,
+	}
+
+	url := "wss" + strings.TrimPrefix(server.URL, "https")
+	ws, err := client.DialWithContext(context.Background(), newURL(url), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	if err := ws.WriteMessage(websocket.OpcodeTextFrame, []byte("secure")); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+
+	if msg := ws.ReadMessage(); msg.Err != nil || string(msg.Data) != "secure" {
+		t.Fatalf("expect echo %q found %q, %v", "secure", msg.Data, msg.Err)
+	}
+}
+
+func TestDialUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ws.sock")
+
+	// A socket file left behind by a previous process is replaced.
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatalf("ListenUnix: %v", err)
+	}
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := websocket.ListenUnix(path)
+	if err != nil {
+		t.Fatalf("ListenUnix: %v", err)
+	}
+
+	if _, err := websocket.ListenUnix(path); err == nil {
+		t.Fatalf("expect an error listening on a socket in use")
+	}
+
+	requests := make(chan *http.Request, 1)
+	echo := conformance.EchoHandler(&websocket.WebSocketServer{})
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		echo.ServeHTTP(w, r)
+	})}
+	go server.Serve(ln)
+	defer server.Close()
+
+	ws, err := (&websocket.WebSocketClient{}).DialWithContext(context.Background(), newURL("ws+unix://"+path+":/events?since=10"), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	r := <-requests
+	if r.Host != "localhost" || r.RequestURI != "/events?since=10" {
+		t.Fatalf("expect localhost /events?since=10 found %s %s", r.Host, r.RequestURI)
+	}
+
+	if err := ws.WriteMessage(websocket.OpcodeTextFrame, []byte("local")); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+
+	if msg := ws.ReadMessage(); msg.Err != nil || string(msg.Data) != "local" {
+		t.Fatalf("expect echo %q found %q, %v", "local", msg.Data, msg.Err)
+	}
+}
+
+func TestNetDialContext(t *testing.T) {
+	server := httptest.NewServer(conformance.EchoHandler(&websocket.WebSocketServer{}))
+	defer server.Close()
+
+	var dialed string
+	client := &websocket.WebSocketClient{
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			dialed = network + " " + addr
+			return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+		},
+	}
+
+	ws, err := client.DialWithContext(context.Background(), newURL("ws://agent.internal/"), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	if dialed != "tcp agent.internal:80" {
+		t.Fatalf("expect to dial tcp agent.internal:80 found %s", dialed)
+	}
+}
+
+func TestDialHeaders(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+
+		conn, rw, _ := http.NewResponseController(w).Hijack()
+		defer conn.Close()
+
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+			"Sec-WebSocket-Accept: %s\r\nSet-Cookie: session=abc; Path=/\r\n\r\n", acceptKey(r.Header.Get("Sec-WebSocket-Key")))
+		rw.Flush()
+	}))
+	defer server.Close()
+
+	jar, _ := cookiejar.New(nil)
+	jar.SetCookies(newURL(server.URL), []*http.Cookie{{Name: "theme", Value: "dark"}})
+
+	header := http.Header{}
+	header.Set("Origin", "http://example.com")
+	header.Set("Authorization", "Bearer token")
+	header.Set("Host", "api.example.com")
+	header.Set("Cookie", "extra=1")
+
+	client := &websocket.WebSocketClient{Jar: jar}
+	ws, err := client.DialWithContext(context.Background(), newURL("ws"+strings.TrimPrefix(server.URL, "http")+"/chat?room=1"), header)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	r := <-requests
+	if r.Host != "api.example.com" || r.RequestURI != "/chat?room=1" {
+		t.Fatalf("expect api.example.com /chat?room=1 found %s %s", r.Host, r.RequestURI)
+	}
+
+	if r.Header.Get("Origin") != "http://example.com" || r.Header.Get("Authorization") != "Bearer token" {
+		t.Fatalf("expect the extra headers found %v", r.Header)
+	}
+
+	if cookie := r.Header.Get("Cookie"); cookie != "extra=1; theme=dark" {
+		t.Fatalf("expect cookies %q found %q", "extra=1; theme=dark", cookie)
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" || r.Header.Get("Upgrade") != "websocket" {
+		t.Fatalf("expect the protocol headers found %v", r.Header)
+	}
+
+	var names []string
+	for _, cookie := range jar.Cookies(newURL(server.URL)) {
+		names = append(names, cookie.Name)
+	}
+	if fmt.Sprint(names) != "[theme session]" {
+		t.Fatalf("expect the jar to store the session cookie found %v", names)
+	}
+}
+
+func TestDialHeaderNotAllowed(t *testing.T) {
+	server := httptest.NewServer(conformance.EchoHandler(&websocket.WebSocketServer{}))
+	defer server.Close()
+
+	for _, name := range []string{"Upgrade", "Connection", "sec-websocket-key", "Sec-WebSocket-Version", "Sec-WebSocket-Protocol"} {
+		header := http.Header{name: []string{"x"}}
+
+		_, err := (&websocket.WebSocketClient{}).DialWithContext(context.Background(), newURL("ws"+strings.TrimPrefix(server.URL, "http")), header)
+		if !errors.Is(err, websocket.ErrHeaderNotAllowed) {
+			t.Fatalf("%s: expect ErrHeaderNotAllowed found %v", name, err)
+		}
+	}
+}
+
+// newRedirectServer serves WebSocket echo on /ws, recording the requests it
+// upgrades, and redirects /moved to target with status.
+func newRedirectServer(t *testing.T, status int, target string, requests chan<- *http.Request) *httptest.Server {
+	t.Helper()
+
+	echo := conformance.EchoHandler(&websocket.WebSocketServer{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		echo.ServeHTTP(w, r)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target, status)
+	})
+
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestDialRedirect(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	regional := newRedirectServer(t, http.StatusFound, "/ws", requests)
+	gateway := newRedirectServer(t, http.StatusTemporaryRedirect, regional.URL+"/moved", requests)
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer token")
+	header.Set("Origin", "http://example.com")
+
+	// The gateway redirects to another host, which redirects to itself.
+	client := &websocket.WebSocketClient{MaxRedirects: 2}
+	u := newURL("ws" + strings.TrimPrefix(gateway.URL, "http") + "/moved")
+	ws, err := client.DialWithContext(context.Background(), u, header)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	r := <-requests
+	if r.Host != strings.TrimPrefix(regional.URL, "http://") || r.URL.Path != "/ws" {
+		t.Fatalf("expect a request for %s/ws found %s%s", regional.URL, r.Host, r.URL.Path)
+	}
+
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Origin") != "http://example.com" {
+		t.Fatalf("expect Authorization to be dropped and Origin kept found %v", r.Header)
+	}
+
+	if u.Scheme != "ws" || u.Path != "/moved" {
+		t.Fatalf("expect the URL of the dial to be left untouched found %s", u)
+	}
+
+	// Same host redirects keep the credentials.
+	ws, err = client.DialWithContext(context.Background(), newURL("ws"+strings.TrimPrefix(regional.URL, "http")+"/moved"), header)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	if r := <-requests; r.Header.Get("Authorization") != "Bearer token" {
+		t.Fatalf("expect Authorization to be kept found %v", r.Header)
+	}
+}
+
+func TestDialRedirectGiveUp(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	s := newRedirectServer(t, http.StatusPermanentRedirect, "/moved", requests)
+	rawurl := "ws" + strings.TrimPrefix(s.URL, "http") + "/moved"
+
+	// Redirects are not followed by default.
+	_, err := (&websocket.WebSocketClient{}).DialWithContext(context.Background(), newURL(rawurl), nil)
+	var handshakeErr *websocket.HandshakeError
+	if !errors.Is(err, websocket.ErrBadHandshake) || errors.As(err, &handshakeErr) {
+		t.Fatalf("expect ErrBadHandshake without redirects found %v", err)
+	}
+
+	client := &websocket.WebSocketClient{MaxRedirects: 2}
+	_, err = client.DialWithContext(context.Background(), newURL(rawurl), nil)
+	if !errors.As(err, &handshakeErr) || !errors.Is(err, websocket.ErrBadHandshake) {
+		t.Fatalf("expect a HandshakeError found %v", err)
+	}
+
+	if len(handshakeErr.URLs) != 4 || handshakeErr.URLs[3].String() != rawurl {
+		t.Fatalf("expect a chain of 4 URLs found %v", handshakeErr.URLs)
+	}
+
+	errStop := errors.New("stop")
+	client.CheckRedirect = func(next *url.URL, via []*url.URL) error {
+		return errStop
+	}
+	_, err = client.DialWithContext(context.Background(), newURL(rawurl), nil)
+	if !errors.As(err, &handshakeErr) || !errors.Is(err, errStop) || len(handshakeErr.URLs) != 2 {
+		t.Fatalf("expect the CheckRedirect error after one redirect found %v", err)
+	}
+}
+
+func TestDial(t *testing.T) {
+	server := httptest.NewServer(conformance.EchoHandler(&websocket.WebSocketServer{}))
+	defer server.Close()
+
+	header := http.Header{"Origin": []string{"http://example.com"}}
+	opts := &websocket.DialOptions{Header: header, HandshakeTimeout: 200 * time.Millisecond}
+
+	ws, err := websocket.Dial(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"), opts)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer ws.Close()
+
+	if len(header) != 1 || opts.Client != nil {
+		t.Fatalf("expect the options to be left untouched found %v, %v", header, opts.Client)
+	}
+
+	// The timeout no longer applies once the handshake is done.
+	time.Sleep(300 * time.Millisecond)
+	if err := ws.WriteMessage(websocket.OpcodeTextFrame, []byte("late")); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+
+	if msg := ws.ReadMessage(); msg.Err != nil || string(msg.Data) != "late" {
+		t.Fatalf("expect echo %q found %q, %v", "late", msg.Data, msg.Err)
+	}
+}
+
+// newSilentServer accepts TCP connections and never answers. Every
+// connection is sent to conns.
+func newSilentServer(t *testing.T) (string, chan net.Conn) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	conns := make(chan net.Conn, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns <- conn
+		}
+	}()
+	return "ws://" + ln.Addr().String(), conns
+}
+
+func TestDialHandshakeTimeout(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		cancel bool
+		expect error
+	}{
+		{name: "timeout", expect: context.DeadlineExceeded},
+		{name: "cancel", cancel: true, expect: context.Canceled},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			url, conns := newSilentServer(t)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			opts := &websocket.DialOptions{HandshakeTimeout: 100 * time.Millisecond}
+			if test.cancel {
+				opts.HandshakeTimeout = 0
+				time.AfterFunc(100*time.Millisecond, cancel)
+			}
+
+			start := time.Now()
+			_, err := websocket.Dial(ctx, url, opts)
+			if !errors.Is(err, test.expect) {
+				t.Fatalf("expect %v found %v", test.expect, err)
+			}
+
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Fatalf("expect the dial to stop after 100ms found %v", elapsed)
+			}
+
+			// The connection is closed: the server reads the request, then EOF.
+			conn := <-conns
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err := io.Copy(io.Discard, conn); err != nil {
+				t.Fatalf("expect the client to close the connection found %v", err)
+			}
+		})
+	}
+}
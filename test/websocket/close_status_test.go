@@ -0,0 +1,113 @@
+package websocket_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+func TestCloseStatusIsValidOnWire(t *testing.T) {
+	tests := []struct {
+		status websocket.CloseStatus
+		valid  bool
+	}{
+		{0, false},
+		{999, false},
+		{websocket.CloseNormalClosure, true},
+		{websocket.CloseUnsupportedData, true},
+		{websocket.CloseReservedButNotSpecifiedByRFC6455, false},
+		{websocket.CloseNoStatusReceived, false},
+		{websocket.CloseAbnormalClosure, false},
+		{websocket.CloseInvalidFramePayloadData, true},
+		{websocket.CloseTryAgainLater, true},
+		{websocket.CloseTLSHandshake, false},
+		{1016, false},
+		{2999, false},
+		{3000, true},
+		{4999, true},
+		{5000, false},
+	}
+
+	for _, tt := range tests {
+		if valid := tt.status.IsValidOnWire(); valid != tt.valid {
+			t.Errorf("%d.IsValidOnWire(): expect %v found %v", tt.status, tt.valid, valid)
+		}
+	}
+}
+
+func TestCloseStatusRanges(t *testing.T) {
+	if !websocket.CloseStatus(3500).IsRegistered() || websocket.CloseStatus(3500).IsPrivate() {
+		t.Error("expect 3500 to be a registered close status")
+	}
+
+	if !websocket.CloseStatus(4500).IsPrivate() || websocket.CloseStatus(4500).IsRegistered() {
+		t.Error("expect 4500 to be a private close status")
+	}
+
+	if websocket.CloseNormalClosure.IsRegistered() || websocket.CloseNormalClosure.IsPrivate() {
+		t.Error("expect 1000 to be neither registered nor private")
+	}
+}
+
+func TestRegisterCloseStatus(t *testing.T) {
+	if s := websocket.CloseGoingAway.String(); s != "Going Away" {
+		t.Errorf("expect Going Away found %s", s)
+	}
+
+	if s := websocket.CloseStatus(4322).String(); s != "CloseStatus(4322)" {
+		t.Errorf("expect CloseStatus(4322) found %s", s)
+	}
+
+	// The registry is global, tolerate a previous run having registered it.
+	if err := websocket.RegisterCloseStatus(4321, "Session Expired"); err != nil && !errors.Is(err, websocket.ErrCloseStatusRegistered) {
+		t.Fatalf("RegisterCloseStatus: %v", err)
+	}
+
+	if s := websocket.CloseStatus(4321).String(); s != "Session Expired" {
+		t.Errorf("expect Session Expired found %s", s)
+	}
+
+	if err := websocket.RegisterCloseStatus(4321, "Other"); !errors.Is(err, websocket.ErrCloseStatusRegistered) {
+		t.Errorf("expect ErrCloseStatusRegistered found %v", err)
+	}
+
+	if err := websocket.RegisterCloseStatus(3001, "Registered"); !errors.Is(err, websocket.ErrCloseStatusNotPrivate) {
+		t.Errorf("expect ErrCloseStatusNotPrivate found %v", err)
+	}
+}
+
+func TestWriteCloseMessageRejectsReservedStatus(t *testing.T) {
+	ws, _ := newPipeConn(t)
+
+	for _, status := range []websocket.CloseStatus{
+		websocket.CloseNoStatusReceived,
+		websocket.CloseAbnormalClosure,
+		websocket.CloseTLSHandshake,
+	} {
+		if err := ws.WriteCloseMessage(status, nil); !errors.Is(err, websocket.ErrInvalidCloseStatus) {
+			t.Errorf("WriteCloseMessage(%d): expect ErrInvalidCloseStatus found %v", status, err)
+		}
+	}
+}
+
+func TestReadInvalidCloseStatus(t *testing.T) {
+	ws, client := newPipeConn(t)
+
+	payload := binary.BigEndian.AppendUint16(nil, uint16(websocket.CloseAbnormalClosure))
+	writeRawFrame(t, client, websocket.OpcodeCloseFrame, payload)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- ws.ReadMessage().Err
+	}()
+
+	if status := readCloseStatus(t, client); status != websocket.CloseProtocolError {
+		t.Fatalf("expect close status %d found %d", websocket.CloseProtocolError, status)
+	}
+
+	if err := <-errCh; !errors.Is(err, websocket.ErrInvalidCloseStatus) {
+		t.Fatalf("expect ErrInvalidCloseStatus found %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+	"github.com/prafitradimas/websocket/pkg/websocket/conformance"
+)
+
+// knownFailures lists the cases this module does not pass yet. They are
+// skipped so the suite guards everything that already conforms; add
+// entries only with a comment explaining the gap.
+var knownFailures = map[conformance.Target][]string{}
+
+func selectCases(target conformance.Target) []conformance.Case {
+	return conformance.Select(conformance.Cases(), nil, knownFailures[target])
+}
+
+func checkReport(t *testing.T, report *conformance.Report) {
+	t.Helper()
+
+	var b strings.Builder
+	report.WriteText(&b)
+	t.Log(b.String())
+
+	for _, result := range report.Results {
+		if result.Status != conformance.StatusPass {
+			t.Errorf("case %s: %s: %s", result.ID, result.Description, result.Detail)
+		}
+	}
+}
+
+func TestConformanceServer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping conformance suite in short mode")
+	}
+
+	server := httptest.NewServer(conformance.EchoHandler(&websocket.WebSocketServer{}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	report := conformance.RunServer(context.Background(), url, selectCases(conformance.TargetServer), conformance.Options{})
+	checkReport(t, report)
+}
+
+func TestConformanceClient(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping conformance suite in short mode")
+	}
+
+	report, err := conformance.RunClient(context.Background(), selectCases(conformance.TargetClient), conformance.Options{}, conformance.EchoClient)
+	if err != nil {
+		t.Fatalf("RunClient: %v", err)
+	}
+	checkReport(t, report)
+}
+
+func TestWriteReportsJSON(t *testing.T) {
+	reports := []*conformance.Report{
+		{Target: conformance.TargetServer, Agent: "server", Results: []conformance.Result{
+			{ID: "1.1", Status: conformance.StatusPass},
+		}},
+		{Target: conformance.TargetClient, Agent: "client", Results: []conformance.Result{
+			{ID: "1.1", Status: conformance.StatusFail, Detail: "no echo"},
+		}},
+	}
+
+	var buf bytes.Buffer
+	if err := conformance.WriteReportsJSON(&buf, reports); err != nil {
+		t.Fatalf("WriteReportsJSON: %v", err)
+	}
+
+	var decoded []struct {
+		Target  string               `json:"target"`
+		Agent   string               `json:"agent"`
+		Results []conformance.Result `json:"results"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("expect a JSON array found %v:\n%s", err, &buf)
+	}
+
+	if len(decoded) != 2 || decoded[0].Target != conformance.TargetServer.String() ||
+		decoded[1].Agent != "client" || decoded[1].Results[0].Detail != "no echo" {
+		t.Fatalf("expect both reports found %+v", decoded)
+	}
+
+	buf.Reset()
+	conformance.WriteReportsJSON(&buf, nil)
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Fatalf("expect an empty array found %s", &buf)
+	}
+}
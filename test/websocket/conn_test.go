@@ -0,0 +1,113 @@
+package websocket_test
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+func TestRole(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	if role := websocket.NewConn(server, nil, nil, false).Role(); role != websocket.RoleServer {
+		t.Errorf("expect role %s found %s", websocket.RoleServer, role)
+	}
+
+	if role := websocket.NewConn(client, nil, nil, true).Role(); role != websocket.RoleClient {
+		t.Errorf("expect role %s found %s", websocket.RoleClient, role)
+	}
+}
+
+func TestClientMasksFrames(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	ws := websocket.NewConn(client, bufio.NewReader(client), bufio.NewWriter(client), true)
+
+	payload := []byte("Hello, World!")
+	go ws.WriteMessage(websocket.OpcodeTextFrame, payload)
+
+	header := make([]byte, 2)
+	if _, err := server.Read(header); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	if header[1]&0x80 == 0 {
+		t.Fatal("expect client frame to be masked")
+	}
+
+	if !bytes.Equal(payload, []byte("Hello, World!")) {
+		t.Fatalf("WriteMessage modified the payload to %q", payload)
+	}
+}
+
+func TestServerRejectsUnmaskedFrame(t *testing.T) {
+	ws, client := newPipeConn(t)
+
+	go func() {
+		writer := websocket.NewFrameWriter(websocket.OpcodeTextFrame, client, make([]byte, 512), false)
+		writer.Write([]byte("unmasked"))
+	}()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- ws.ReadMessage().Err
+	}()
+
+	if status := readCloseStatus(t, client); status != websocket.CloseProtocolError {
+		t.Fatalf("expect close status %d found %d", websocket.CloseProtocolError, status)
+	}
+
+	if err := <-errCh; !errors.Is(err, websocket.ErrUnmaskedFrame) {
+		t.Fatalf("expect ErrUnmaskedFrame found %v", err)
+	}
+}
+
+func TestClientRejectsMaskedFrame(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	ws := websocket.NewConn(client, bufio.NewReader(client), bufio.NewWriter(client), true)
+	writeRawFrame(t, server, websocket.OpcodeTextFrame, []byte("masked"))
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- ws.ReadMessage().Err
+	}()
+
+	if status := readCloseStatus(t, server); status != websocket.CloseProtocolError {
+		t.Fatalf("expect close status %d found %d", websocket.CloseProtocolError, status)
+	}
+
+	if err := <-errCh; !errors.Is(err, websocket.ErrMaskedFrame) {
+		t.Fatalf("expect ErrMaskedFrame found %v", err)
+	}
+}
+
+func TestStartClose(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	ws := websocket.NewConn(client, bufio.NewReader(client), bufio.NewWriter(client), true)
+
+	// The peer reads the close frame and never answers it.
+	go io.Copy(io.Discard, server)
+
+	if err := websocket.StartClose(ws, websocket.CloseGoingAway, []byte("bye")); err != nil {
+		t.Fatalf("StartClose: %v", err)
+	}
+
+	if err := websocket.StartClose(ws, websocket.CloseGoingAway, nil); !errors.Is(err, websocket.ErrCloseSent) {
+		t.Fatalf("expect ErrCloseSent found %v", err)
+	}
+}
@@ -193,7 +193,7 @@ func TestPingPong(t *testing.T) {
 	}
 
 	t.Log("Sending close frame")
-	err = conn.WriteCloseMessage(websocket.CloseAbnormalClosure, []byte("close"))
+	err = conn.WriteCloseMessage(websocket.CloseNormalClosure, []byte("close"))
 	if err != nil {
 		t.Fatalf("Failed to write close message: %v", err)
 	}
@@ -0,0 +1,143 @@
+package websocket_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// newPipeConn returns a server side WebSocket and the raw client end of the
+// pipe it reads from.
+func newPipeConn(t *testing.T) (websocket.WebSocket, net.Conn) {
+	t.Helper()
+
+	server, client := net.Pipe()
+	t.Cleanup(func() {
+		server.Close()
+		client.Close()
+	})
+
+	ws := websocket.NewConn(server, bufio.NewReader(server), bufio.NewWriter(server), false)
+	return ws, client
+}
+
+func writeRawFrame(t *testing.T, conn net.Conn, opc websocket.Opcode, payload []byte) {
+	t.Helper()
+
+	go func() {
+		writer := websocket.NewFrameWriter(opc, conn, make([]byte, 512), true)
+		if _, err := writer.Write(payload); err != nil {
+			t.Logf("writeRawFrame: %v", err)
+		}
+	}()
+}
+
+func readCloseStatus(t *testing.T, conn net.Conn) websocket.CloseStatus {
+	t.Helper()
+
+	reader := websocket.NewFrameReader(conn)
+	if reader.Err() != nil {
+		t.Fatalf("NewFrameReader: %v", reader.Err())
+	}
+
+	if !reader.Opcode().IsClose() {
+		t.Fatalf("expect opcode %s found %s", websocket.OpcodeCloseFrame, reader.Opcode())
+	}
+
+	payload := make([]byte, reader.Len())
+	reader.Read(payload)
+	if len(payload) < 2 {
+		t.Fatalf("expect close status, found payload %v", payload)
+	}
+
+	return websocket.CloseStatus(binary.BigEndian.Uint16(payload))
+}
+
+func TestProtocolErrorSendsCloseStatus(t *testing.T) {
+	ws, client := newPipeConn(t)
+
+	writeRawFrame(t, client, websocket.Opcode(3), []byte("bad"))
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- ws.ReadMessage().Err
+	}()
+
+	if status := readCloseStatus(t, client); status != websocket.CloseProtocolError {
+		t.Fatalf("expect close status %d found %d", websocket.CloseProtocolError, status)
+	}
+
+	err := <-errCh
+	if !errors.Is(err, websocket.ErrBadOpcode) {
+		t.Fatalf("expect ErrBadOpcode found %v", err)
+	}
+
+	var pe *websocket.ProtocolError
+	if !errors.As(err, &pe) || pe.Status != websocket.CloseProtocolError {
+		t.Fatalf("expect *ProtocolError with status %d found %v", websocket.CloseProtocolError, err)
+	}
+
+	if !ws.IsClosed() {
+		t.Fatal("expect connection to be closed after a protocol error")
+	}
+}
+
+func TestIsCloseError(t *testing.T) {
+	ws, client := newPipeConn(t)
+
+	payload := binary.BigEndian.AppendUint16(nil, uint16(websocket.CloseGoingAway))
+	writeRawFrame(t, client, websocket.OpcodeCloseFrame, append(payload, "bye"...))
+
+	msgCh := make(chan websocket.Message, 1)
+	go func() {
+		msgCh <- ws.ReadMessage()
+	}()
+
+	if status := readCloseStatus(t, client); status != websocket.CloseGoingAway {
+		t.Fatalf("expect echoed close status %d found %d", websocket.CloseGoingAway, status)
+	}
+
+	msg := <-msgCh
+	if msg.Err != nil || !msg.Opcode.IsClose() {
+		t.Fatalf("expect close frame, found %s: %v", msg.Opcode, msg.Err)
+	}
+
+	err := ws.ReadMessage().Err
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("expect close error %d found %v", websocket.CloseGoingAway, err)
+	}
+
+	if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+		t.Fatalf("expect %v to be an expected close error", err)
+	}
+
+	if !websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure) {
+		t.Fatalf("expect %v to be an unexpected close error", err)
+	}
+
+	if err := ws.WriteMessage(websocket.OpcodeTextFrame, []byte("late")); !errors.Is(err, websocket.ErrCloseSent) {
+		t.Fatalf("expect ErrCloseSent found %v", err)
+	}
+}
+
+func TestReadTimeoutError(t *testing.T) {
+	ws, _ := newPipeConn(t)
+	ws.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+
+	err := ws.ReadMessage().Err
+
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("expect timeout net.Error found %v", err)
+	}
+
+	var te *websocket.TimeoutError
+	if !errors.As(err, &te) {
+		t.Fatalf("expect *TimeoutError found %T", err)
+	}
+}
@@ -0,0 +1,325 @@
+package websocket_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// reverseExtension reverses the payload of every message and marks it with
+// RSV2.
+type reverseExtension struct{}
+
+func (reverseExtension) Name() string                      { return "x-reverse" }
+func (reverseExtension) Offer() []websocket.ExtensionParam { return nil }
+func (reverseExtension) RSV() byte                         { return websocket.RSV2 }
+
+func (e reverseExtension) Accept(params []websocket.ExtensionParam) (websocket.ExtensionConn, []websocket.ExtensionParam) {
+	return e, nil
+}
+
+func (e reverseExtension) Accepted(params []websocket.ExtensionParam) (websocket.ExtensionConn, error) {
+	return e, nil
+}
+
+func (reverseExtension) WriteMessage(m *websocket.ExtensionFrame) error {
+	m.Payload = slices.Clone(m.Payload)
+	slices.Reverse(m.Payload)
+	m.RSV |= websocket.RSV2
+	return nil
+}
+
+func (reverseExtension) ReadMessage(m *websocket.ExtensionFrame) error {
+	if m.RSV&websocket.RSV2 == 0 {
+		return errors.New("message not reversed")
+	}
+	slices.Reverse(m.Payload)
+	m.RSV &^= websocket.RSV2
+	return nil
+}
+
+// xorExtension xors every data frame with a key negotiated as a parameter
+// and marks it with RSV3.
+type xorExtension struct {
+	key byte
+}
+
+func (e *xorExtension) Name() string { return "x-xor" }
+func (e *xorExtension) RSV() byte    { return websocket.RSV3 }
+
+func (e *xorExtension) Offer() []websocket.ExtensionParam {
+	return []websocket.ExtensionParam{{Name: "key", Value: strconv.Itoa(int(e.key))}}
+}
+
+func (e *xorExtension) Accept(params []websocket.ExtensionParam) (websocket.ExtensionConn, []websocket.ExtensionParam) {
+	conn, err := e.Accepted(params)
+	if err != nil {
+		return nil, nil
+	}
+	return conn, params
+}
+
+func (e *xorExtension) Accepted(params []websocket.ExtensionParam) (websocket.ExtensionConn, error) {
+	spec := websocket.ExtensionSpec{Params: params}
+	value, _ := spec.Param("key")
+	key, err := strconv.ParseUint(value, 10, 8)
+	if err != nil {
+		return nil, fmt.Errorf("bad key %q", value)
+	}
+	return &xorExtension{key: byte(key)}, nil
+}
+
+func (e *xorExtension) WriteFrame(f *websocket.ExtensionFrame) error {
+	if f.Opcode.IsControl() {
+		return nil
+	}
+
+	payload := make([]byte, len(f.Payload))
+	for i, b := range f.Payload {
+		payload[i] = b ^ e.key
+	}
+	f.Payload = payload
+	f.RSV |= websocket.RSV3
+	return nil
+}
+
+func (e *xorExtension) ReadFrame(f *websocket.ExtensionFrame) error {
+	if f.RSV&websocket.RSV3 == 0 {
+		return nil
+	}
+
+	for i := range f.Payload {
+		f.Payload[i] ^= e.key
+	}
+	f.RSV &^= websocket.RSV3
+	return nil
+}
+
+func newExtensionServer(t *testing.T, extensions ...websocket.Extension) string {
+	t.Helper()
+
+	server := &websocket.WebSocketServer{Extensions: extensions}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := server.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		for {
+			msg := ws.ReadMessage()
+			if msg.Err != nil || msg.Opcode.IsClose() {
+				return
+			}
+			ws.WriteMessage(msg.Opcode, msg.Data)
+		}
+	}))
+	t.Cleanup(s.Close)
+
+	return s.URL
+}
+
+func extensionsHeader(value string) http.Header {
+	header := http.Header{}
+	header.Set("Sec-WebSocket-Extensions", value)
+	return header
+}
+
+func TestParseExtensions(t *testing.T) {
+	header := http.Header{}
+	header.Add("Sec-WebSocket-Extensions", `permessage-deflate; client_max_window_bits, x-foo; a="b, c; \"d\"" ;e = f`)
+	header.Add("Sec-WebSocket-Extensions", "x-bar,")
+
+	specs, err := websocket.ParseExtensions(header)
+	if err != nil {
+		t.Fatalf("ParseExtensions: %v", err)
+	}
+
+	expect := []websocket.ExtensionSpec{
+		{Name: "permessage-deflate", Params: []websocket.ExtensionParam{{Name: "client_max_window_bits"}}},
+		{Name: "x-foo", Params: []websocket.ExtensionParam{{Name: "a", Value: `b, c; "d"`}, {Name: "e", Value: "f"}}},
+		{Name: "x-bar"},
+	}
+	if fmt.Sprint(specs) != fmt.Sprint(expect) {
+		t.Fatalf("expect %v found %v", expect, specs)
+	}
+
+	formatted := websocket.FormatExtensions(specs)
+	if formatted != `permessage-deflate; client_max_window_bits, x-foo; a="b, c; \"d\""; e=f, x-bar` {
+		t.Fatalf("unexpected format %s", formatted)
+	}
+
+	again, err := websocket.ParseExtensions(extensionsHeader(formatted))
+	if err != nil || fmt.Sprint(again) != fmt.Sprint(expect) {
+		t.Fatalf("expect the formatted header to parse back found %v, %v", again, err)
+	}
+
+	for _, value := range []string{"; a", "x; =b", `x; a="unterminated`, "x y", "x; a="} {
+		_, err := websocket.ParseExtensions(extensionsHeader(value))
+		if !errors.Is(err, websocket.ErrBadExtensions) {
+			t.Fatalf("%q: expect ErrBadExtensions found %v", value, err)
+		}
+	}
+}
+
+func TestExtensionPipeline(t *testing.T) {
+	url := newExtensionServer(t, reverseExtension{}, &xorExtension{})
+
+	client := &websocket.WebSocketClient{
+		Extensions: []websocket.Extension{&xorExtension{key: 42}, reverseExtension{}},
+	}
+	ws, err := client.DialWithContext(context.Background(), newURL("ws"+strings.TrimPrefix(url, "http")), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	// Large enough to be sent as several frames, each one xored on its own.
+	payload := []byte(strings.Repeat("abcdefghij", 200))
+	if err := ws.WriteMessage(websocket.OpcodeTextFrame, payload); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+
+	msg := ws.ReadMessage()
+	if msg.Err != nil || !bytes.Equal(msg.Data, payload) {
+		t.Fatalf("expect the message to round trip found %d bytes, %v", len(msg.Data), msg.Err)
+	}
+}
+
+func TestExtensionDeclined(t *testing.T) {
+	url := newExtensionServer(t)
+
+	client := &websocket.WebSocketClient{Extensions: []websocket.Extension{reverseExtension{}}}
+	ws, err := client.DialWithContext(context.Background(), newURL("ws"+strings.TrimPrefix(url, "http")), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	ws.WriteMessage(websocket.OpcodeTextFrame, []byte("plain"))
+	if msg := ws.ReadMessage(); msg.Err != nil || string(msg.Data) != "plain" {
+		t.Fatalf("expect %q found %q, %v", "plain", msg.Data, msg.Err)
+	}
+}
+
+func TestClientRejectsUnofferedExtension(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, _ := http.NewResponseController(w).Hijack()
+		defer conn.Close()
+
+		key := r.Header.Get("Sec-WebSocket-Key")
+		fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+			"Sec-WebSocket-Accept: %s\r\nSec-WebSocket-Extensions: x-reverse\r\n\r\n", acceptKey(key))
+		rw.Flush()
+	}))
+	defer s.Close()
+
+	_, err := (&websocket.WebSocketClient{}).DialWithContext(context.Background(), newURL("ws"+strings.TrimPrefix(s.URL, "http")), nil)
+	if !errors.Is(err, websocket.ErrBadHandshake) {
+		t.Fatalf("expect ErrBadHandshake found %v", err)
+	}
+}
+
+// nilConnExtension negotiates x-reverse but returns no ExtensionConn once
+// the server accepted it.
+type nilConnExtension struct {
+	reverseExtension
+}
+
+func (nilConnExtension) Accepted(params []websocket.ExtensionParam) (websocket.ExtensionConn, error) {
+	return nil, nil
+}
+
+func TestClientRejectsNilExtensionConn(t *testing.T) {
+	url := newExtensionServer(t, reverseExtension{})
+
+	client := &websocket.WebSocketClient{Extensions: []websocket.Extension{nilConnExtension{}}}
+	_, err := client.DialWithContext(context.Background(), newURL("ws"+strings.TrimPrefix(url, "http")), nil)
+	if !errors.Is(err, websocket.ErrBadHandshake) {
+		t.Fatalf("expect ErrBadHandshake found %v", err)
+	}
+}
+
+// rawHandshake opens a TCP connection to url and performs the opening
+// handshake offering extensions.
+func rawHandshake(t *testing.T, url, extensions string) (net.Conn, *bufio.Reader, *http.Response) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	fmt.Fprintf(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Extensions: %s\r\n\r\n", extensions)
+
+	reader := bufio.NewReader(conn)
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("ReadResponse: %v", err)
+	}
+	return conn, reader, res
+}
+
+// writeRSVFrame writes a final masked text frame with the given reserved
+// bits. The masking key is zero, so the payload goes out as is.
+func writeRSVFrame(t *testing.T, conn net.Conn, rsv byte, payload []byte) {
+	t.Helper()
+
+	frame := append([]byte{0x80 | rsv | byte(websocket.OpcodeTextFrame), 0x80 | byte(len(payload)), 0, 0, 0, 0}, payload...)
+	if _, err := conn.Write(frame); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+}
+
+func TestReservedBits(t *testing.T) {
+	url := newExtensionServer(t, &xorExtension{})
+
+	conn, reader, res := rawHandshake(t, url, "x-xor; key=1")
+	if found := res.Header.Get("Sec-WebSocket-Extensions"); found != "x-xor; key=1" {
+		t.Fatalf("expect x-xor to be accepted found %q", found)
+	}
+
+	// RSV3 is claimed by x-xor: the frame is decoded, and the echo encoded.
+	writeRSVFrame(t, conn, websocket.RSV3, []byte("`c`"))
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+
+	if header[0]&websocket.RSV3 == 0 || string(header[2:]) != "`c`" {
+		t.Fatalf("expect an echo xored with RSV3 found %v", header)
+	}
+
+	// RSV2 is claimed by no extension.
+	writeRSVFrame(t, conn, websocket.RSV2, []byte("bad"))
+
+	frame := make([]byte, 4)
+	if _, err := io.ReadFull(reader, frame); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+
+	if !websocket.Opcode(frame[0] & 0xF).IsClose() {
+		t.Fatalf("expect a close frame found %v", frame)
+	}
+
+	if status := websocket.CloseStatus(binary.BigEndian.Uint16(frame[2:])); status != websocket.CloseProtocolError {
+		t.Fatalf("expect close status %d found %d", websocket.CloseProtocolError, status)
+	}
+}
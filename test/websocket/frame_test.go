@@ -2,6 +2,9 @@ package websocket
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
 	"testing"
 
 	"github.com/prafitradimas/websocket/pkg/websocket"
@@ -33,7 +36,36 @@ func TestFrame(t *testing.T) {
 		t.Fatalf("unexpected error: %v", reader.Err())
 	}
 
-	if bytes.Equal(data, reader.Data()) {
+	if !bytes.Equal(data, reader.Data()) {
 		t.Fatalf("expected %s, got %s", data, reader.Data())
 	}
 }
+
+func TestFrameReaderMessageTooBig(t *testing.T) {
+	// A first fragment of one byte, then a continuation frame of length.
+	fragments := func(length uint64) []byte {
+		data := []byte{0x01, 0x01, 'a', 0x80, 0x7F}
+		return binary.BigEndian.AppendUint64(data, length)
+	}
+
+	for _, c := range []struct {
+		name   string
+		length uint64
+	}{
+		{"over the limit", 64 << 20},
+		{"near MaxInt64", math.MaxInt64},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			reader := websocket.NewFrameReader(bytes.NewReader(fragments(c.length)))
+			if !errors.Is(reader.Err(), websocket.ErrMessageTooBig) {
+				t.Fatalf("expect ErrMessageTooBig found %v", reader.Err())
+			}
+		})
+	}
+
+	// A continuation that fits within the limit is still read.
+	data := []byte{0x01, 0x01, 'a', 0x80, 0x01, 'b'}
+	if reader := websocket.NewFrameReader(bytes.NewReader(data)); reader.Err() != nil || string(reader.Data()) != "ab" {
+		t.Fatalf("expect %q found %q, %v", "ab", reader.Data(), reader.Err())
+	}
+}
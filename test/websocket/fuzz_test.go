@@ -0,0 +1,197 @@
+package websocket_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// fakeConn is a net.Conn that records what is written to it and serves the
+// bytes returned by respond once the first read happens.
+type fakeConn struct {
+	written bytes.Buffer
+	respond func(written []byte) []byte
+	reader  io.Reader
+}
+
+func (c *fakeConn) Read(b []byte) (int, error) {
+	if c.reader == nil {
+		var response []byte
+		if c.respond != nil {
+			response = c.respond(c.written.Bytes())
+		}
+		c.reader = bytes.NewReader(response)
+	}
+	return c.reader.Read(b)
+}
+
+func (c *fakeConn) Write(b []byte) (int, error)        { return c.written.Write(b) }
+func (c *fakeConn) Close() error                       { return nil }
+func (c *fakeConn) LocalAddr() net.Addr                { return &net.TCPAddr{} }
+func (c *fakeConn) RemoteAddr() net.Addr               { return &net.TCPAddr{} }
+func (c *fakeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *fakeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *fakeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// hijackRecorder is an http.ResponseWriter that can be hijacked, which
+// httptest.ResponseRecorder cannot.
+type hijackRecorder struct {
+	header http.Header
+	code   int
+	conn   fakeConn
+}
+
+func newHijackRecorder() *hijackRecorder {
+	return &hijackRecorder{header: http.Header{}}
+}
+
+func (r *hijackRecorder) Header() http.Header         { return r.header }
+func (r *hijackRecorder) Write(b []byte) (int, error) { return len(b), nil }
+func (r *hijackRecorder) WriteHeader(code int)        { r.code = code }
+
+func (r *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return &r.conn, bufio.NewReadWriter(bufio.NewReader(&r.conn), bufio.NewWriter(&r.conn)), nil
+}
+
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func encodeFrame(t testing.TB, opc websocket.Opcode, payload []byte, masked bool) []byte {
+	var buf bytes.Buffer
+	writer := websocket.NewFrameWriter(opc, &buf, make([]byte, 512), masked)
+	if _, err := writer.Write(bytes.Clone(payload)); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func FuzzFrameReader(f *testing.F) {
+	f.Add(encodeFrame(f, websocket.OpcodeTextFrame, []byte("Hello WebSocket"), true))
+	f.Add(encodeFrame(f, websocket.OpcodeBinaryFrame, bytes.Repeat([]byte{0xFE}, 1000), false))
+	f.Add(encodeFrame(f, websocket.OpcodePingFrame, nil, true))
+	f.Add(encodeFrame(f, websocket.OpcodeCloseFrame, []byte{0x03, 0xE8, 'o', 'k'}, false))
+	f.Add([]byte{0x81, 0x7E, 0x00, 0x05, 'h', 'e', 'l', 'l', 'o'})
+	f.Add([]byte{0x82, 0x7F, 0x80, 0, 0, 0, 0, 0, 0, 0})
+	f.Add([]byte{0x01, 0x02, 'h', 'e', 0x89, 0x00, 0x80, 0x02, 'l', 'o'})
+	f.Add([]byte{0xC1, 0x00})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reader := websocket.NewFrameReader(bytes.NewReader(data))
+		if reader.Err() != nil {
+			return
+		}
+
+		opc, payload := reader.Opcode(), reader.Data()
+		if opc.IsControl() && len(payload) > 125 {
+			t.Fatalf("accepted %s frame with %d byte payload", opc, len(payload))
+		}
+
+		if opc == websocket.OpcodeTextFrame && !utf8.Valid(payload) {
+			t.Fatalf("accepted invalid UTF-8 text %q", payload)
+		}
+
+		again := websocket.NewFrameReader(bytes.NewReader(encodeFrame(t, opc, payload, true)))
+		if again.Err() != nil {
+			t.Fatalf("round trip of %s: %v", opc, again.Err())
+		}
+
+		if again.Opcode() != opc || !bytes.Equal(again.Data(), payload) {
+			t.Fatalf("round trip of %s changed the message to %s %q", opc, again.Opcode(), again.Data())
+		}
+	})
+}
+
+func FuzzHandshakeRequest(f *testing.F) {
+	f.Add("GET /chat HTTP/1.1\r\nHost: server.example.com\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Protocol: chat, superchat\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	f.Add("GET / HTTP/1.1\r\nHost: a\r\nUpgrade: WebSocket\r\nConnection: keep-alive, upgrade\r\nSec-WebSocket-Key: AAAAAAAAAAAAAAAAAAAAAA==\r\nSec-WebSocket-Version: 13\r\n\r\n")
+	f.Add("GET / HTTP/1.1\r\nHost: a\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: short\r\nSec-WebSocket-Version: 8\r\n\r\n")
+	f.Add("GET / HTTP/1.0\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	f.Add("POST / HTTP/1.1\r\nHost: a\r\n\r\n")
+
+	server := &websocket.WebSocketServer{Subprotocols: []string{"chat"}}
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(raw)))
+		if err != nil {
+			return
+		}
+
+		w := newHijackRecorder()
+		ws, err := server.Upgrade(w, req)
+		if err != nil {
+			if w.code < 400 {
+				t.Fatalf("rejected handshake with status %d: %v", w.code, err)
+			}
+			return
+		}
+		defer ws.Close()
+
+		res, err := http.ReadResponse(bufio.NewReader(&w.conn.written), req)
+		if err != nil {
+			t.Fatalf("unreadable handshake response: %v", err)
+		}
+
+		if res.StatusCode != http.StatusSwitchingProtocols {
+			t.Fatalf("accepted handshake with status %s", res.Status)
+		}
+
+		key := strings.TrimSpace(req.Header.Get("Sec-WebSocket-Key"))
+		if accept := res.Header.Get("Sec-WebSocket-Accept"); accept != acceptKey(key) {
+			t.Fatalf("expect Sec-WebSocket-Accept %q found %q", acceptKey(key), accept)
+		}
+
+		if p := res.Header.Get("Sec-WebSocket-Protocol"); p != "" && p != "chat" {
+			t.Fatalf("selected subprotocol %q that the server does not support", p)
+		}
+	})
+}
+
+var keyPattern = regexp.MustCompile(`Sec-Websocket-Key: (\S+)`)
+
+func FuzzHandshakeResponse(f *testing.F) {
+	// {accept} is replaced with the accept value matching the request key,
+	// so the fuzzer can reach the checks that follow it.
+	f.Add("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: {accept}\r\n\r\n")
+	f.Add("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: {accept}\r\nSec-WebSocket-Protocol: chat\r\n\r\n\x81\x02hi")
+	f.Add("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: {accept}\r\nSec-WebSocket-Protocol: other\r\n\r\n")
+	f.Add("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: s3pPLMBiTxaQ9kYGzzhZRbK+xOo=\r\n\r\n")
+	f.Add("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")
+
+	client := &websocket.WebSocketClient{Subprotocols: []string{"chat"}}
+
+	f.Fuzz(func(t *testing.T, raw string) {
+		conn := &fakeConn{
+			respond: func(written []byte) []byte {
+				var accept string
+				if m := keyPattern.FindSubmatch(written); m != nil {
+					accept = acceptKey(string(m[1]))
+				}
+				return []byte(strings.ReplaceAll(raw, "{accept}", accept))
+			},
+		}
+
+		ws, err := client.Handshake(context.Background(), conn, newURL("ws://example.com/chat"), nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		if !strings.Contains(raw, "{accept}") {
+			t.Fatalf("accepted handshake without the matching Sec-WebSocket-Accept: %q", raw)
+		}
+	})
+}
@@ -0,0 +1,68 @@
+//go:build go1.24
+
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// newH2CServer returns a cleartext server speaking HTTP/1.1 and HTTP/2 with
+// prior knowledge, with http2EchoHandler.
+func newH2CServer(t *testing.T, protos chan<- string) *httptest.Server {
+	t.Helper()
+
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+
+	s := httptest.NewUnstartedServer(http2EchoHandler(protos))
+	s.Config.Protocols = &protocols
+	s.Start()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestH2C(t *testing.T) {
+	if !withExtendedConnect(t) {
+		return
+	}
+
+	protos := make(chan string, 2)
+	s := newH2CServer(t, protos)
+	url := "ws" + strings.TrimPrefix(s.URL, "http")
+
+	client := &websocket.WebSocketClient{Subprotocols: []string{"chat"}, HTTP2: true}
+	echoHTTP2(t, client, url)
+	if proto := <-protos; proto != "h2c" {
+		t.Fatalf("expect h2c found %s", proto)
+	}
+
+	// HTTP/1.1 clients are still upgraded by the same server.
+	client.HTTP2 = false
+	echoHTTP2(t, client, url)
+	if proto := <-protos; proto != "HTTP/1.1" {
+		t.Fatalf("expect HTTP/1.1 found %s", proto)
+	}
+}
+
+func TestH2CWithoutExtendedConnect(t *testing.T) {
+	if strings.Contains(os.Getenv("GODEBUG"), "http2xconnect=1") {
+		t.Skip("extended CONNECT is enabled")
+	}
+
+	s := newH2CServer(t, make(chan string, 1))
+
+	client := &websocket.WebSocketClient{HTTP2: true}
+	_, err := client.DialWithContext(context.Background(), newURL("ws"+strings.TrimPrefix(s.URL, "http")), nil)
+	if !errors.Is(err, websocket.ErrExtendedConnect) {
+		t.Fatalf("expect ErrExtendedConnect found %v", err)
+	}
+}
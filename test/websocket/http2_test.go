@@ -0,0 +1,199 @@
+package websocket_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// withExtendedConnect runs the test again in a process that lets Go's HTTP/2
+// server accept extended CONNECT requests, which is only read from the
+// environment at startup. It reports whether the caller is that process.
+func withExtendedConnect(t *testing.T) bool {
+	t.Helper()
+
+	if strings.Contains(os.Getenv("GODEBUG"), "http2xconnect=1") {
+		return true
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^"+t.Name()+"$", "-test.count=1")
+	cmd.Env = append(os.Environ(), "GODEBUG=http2xconnect=1")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v:\n%s", err, out)
+	}
+	return false
+}
+
+// http2EchoHandler echoes messages on the "chat" subprotocol and records the
+// protocol of the requests: h2, h2c or HTTP/1.1.
+func http2EchoHandler(protos chan<- string) http.Handler {
+	server := &websocket.WebSocketServer{Subprotocols: []string{"chat"}}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.ProtoMajor != 2:
+			protos <- r.Proto
+		case r.TLS == nil:
+			protos <- "h2c"
+		default:
+			protos <- "h2"
+		}
+
+		ws, err := server.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		for {
+			msg := ws.ReadMessage()
+			if msg.Err != nil || msg.Opcode.IsClose() {
+				return
+			}
+			ws.WriteMessage(msg.Opcode, msg.Data)
+		}
+	})
+}
+
+// newHTTP2Server returns a TLS server speaking HTTP/1.1 and HTTP/2 with
+// http2EchoHandler, and a client that trusts it.
+func newHTTP2Server(t *testing.T, protos chan<- string) (*httptest.Server, *websocket.WebSocketClient) {
+	t.Helper()
+
+	s := httptest.NewUnstartedServer(http2EchoHandler(protos))
+	s.EnableHTTP2 = true
+	s.StartTLS()
+	t.Cleanup(s.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(s.Certificate())
+	client := &websocket.WebSocketClient{
+		Subprotocols:    []string{"chat"},
+		HTTP2:           true,
+		TLSClientConfig: &tls.Config{RootCAs: roots},
+	}
+	return s, client
+}
+
+func echoHTTP2(t *testing.T, client *websocket.WebSocketClient, rawurl string) {
+	t.Helper()
+
+	ws, err := client.DialWithContext(context.Background(), newURL(rawurl), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	if p := ws.Subprotocol(); p != "chat" {
+		t.Fatalf("expect subprotocol %q found %q", "chat", p)
+	}
+
+	for _, m := range []struct {
+		opcode  websocket.Opcode
+		payload string
+	}{
+		{websocket.OpcodeTextFrame, "hello"},
+		{websocket.OpcodeBinaryFrame, "\x00\x01\xfe\xff"},
+		// Larger than the initial flow control window of HTTP/2.
+		{websocket.OpcodeTextFrame, strings.Repeat("x", 200_000)},
+	} {
+		if err := ws.WriteMessage(m.opcode, []byte(m.payload)); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+
+		msg := ws.ReadMessage()
+		if msg.Err != nil || msg.Opcode != m.opcode || string(msg.Data) != m.payload {
+			t.Fatalf("expect echo of %d bytes %v found %d bytes %v, %v", len(m.payload), m.opcode, len(msg.Data), msg.Opcode, msg.Err)
+		}
+	}
+
+	if err := ws.WriteCloseMessage(websocket.CloseNormalClosure, nil); err != nil {
+		t.Fatalf("WriteCloseMessage: %v", err)
+	}
+
+	if msg := ws.ReadMessage(); msg.Opcode != websocket.OpcodeCloseFrame {
+		t.Fatalf("expect the close reply found %v, %v", msg.Opcode, msg.Err)
+	}
+}
+
+func TestHTTP2(t *testing.T) {
+	if !withExtendedConnect(t) {
+		return
+	}
+
+	protos := make(chan string, 2)
+	s, client := newHTTP2Server(t, protos)
+	url := "wss" + strings.TrimPrefix(s.URL, "https")
+
+	echoHTTP2(t, client, url)
+	if proto := <-protos; proto != "h2" {
+		t.Fatalf("expect h2 found %s", proto)
+	}
+
+	// HTTP/1.1 clients are still upgraded by the same handler.
+	client.HTTP2 = false
+	echoHTTP2(t, client, url)
+	if proto := <-protos; proto != "HTTP/1.1" {
+		t.Fatalf("expect HTTP/1.1 found %s", proto)
+	}
+}
+
+func TestHTTP2WithoutExtendedConnect(t *testing.T) {
+	if strings.Contains(os.Getenv("GODEBUG"), "http2xconnect=1") {
+		t.Skip("extended CONNECT is enabled")
+	}
+
+	s, client := newHTTP2Server(t, make(chan string, 1))
+
+	_, err := client.DialWithContext(context.Background(), newURL("wss"+strings.TrimPrefix(s.URL, "https")), nil)
+	if !errors.Is(err, websocket.ErrExtendedConnect) {
+		t.Fatalf("expect ErrExtendedConnect found %v", err)
+	}
+}
+
+// TestHTTP2SettingsWithoutExtendedConnect runs against a bare HTTP/2 peer
+// whose SETTINGS do not include SETTINGS_ENABLE_CONNECT_PROTOCOL.
+func TestHTTP2SettingsWithoutExtendedConnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer ln.Close()
+
+	preface := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, len("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"))
+		io.ReadFull(conn, buf)
+		preface <- buf
+
+		// An empty SETTINGS frame, then wait for the client to hang up.
+		conn.Write([]byte{0, 0, 0, 0x4, 0, 0, 0, 0, 0})
+		io.Copy(io.Discard, conn)
+	}()
+
+	client := &websocket.WebSocketClient{HTTP2: true}
+	_, err = client.DialWithContext(context.Background(), newURL("ws://"+ln.Addr().String()+"/chat"), nil)
+	if !errors.Is(err, websocket.ErrExtendedConnect) {
+		t.Fatalf("expect ErrExtendedConnect found %v", err)
+	}
+
+	if p := <-preface; string(p) != "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n" {
+		t.Fatalf("expect the h2c client preface found %q", p)
+	}
+}
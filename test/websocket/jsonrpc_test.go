@@ -0,0 +1,255 @@
+package websocket_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+	"github.com/prafitradimas/websocket/pkg/websocket/jsonrpc"
+)
+
+func newRPCServer(t *testing.T, server *jsonrpc.Server) string {
+	t.Helper()
+
+	reg := jsonrpc.NewRegistry()
+	jsonrpc.Register(reg, "add", func(ctx context.Context, p [2]int) (int, error) {
+		return p[0] + p[1], nil
+	})
+	jsonrpc.Register(reg, "fail", func(ctx context.Context, p struct{}) (any, error) {
+		return nil, jsonrpc.NewError(4000, "failed on purpose", "detail")
+	})
+	jsonrpc.Register(reg, "panic", func(ctx context.Context, p struct{}) (any, error) {
+		panic("handler bug")
+	})
+	jsonrpc.Register(reg, "wait", func(ctx context.Context, p struct{}) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	jsonrpc.Register(reg, "greet", func(ctx context.Context, p struct{}) (string, error) {
+		// Ask the caller for its name over the same connection.
+		var name string
+		if err := jsonrpc.ConnFromContext(ctx).Call(ctx, "name", nil, &name); err != nil {
+			return "", err
+		}
+		return "hello, " + name, nil
+	})
+
+	server.Registry = reg
+	s := httptest.NewServer(server)
+	t.Cleanup(s.Close)
+
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+func dialRPC(t *testing.T, url string, reg *jsonrpc.Registry) *jsonrpc.Conn {
+	t.Helper()
+
+	conn, err := jsonrpc.Dial(context.Background(), url, reg)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestJSONRPCCall(t *testing.T) {
+	conn := dialRPC(t, newRPCServer(t, &jsonrpc.Server{}), nil)
+	ctx := context.Background()
+
+	var sum int
+	if err := conn.Call(ctx, "add", [2]int{1, 2}, &sum); err != nil || sum != 3 {
+		t.Fatalf("expect 3 found %d, %v", sum, err)
+	}
+
+	for _, tc := range []struct {
+		method string
+		params any
+		code   int
+	}{
+		{"missing", nil, jsonrpc.CodeMethodNotFound},
+		{"add", "not an array", jsonrpc.CodeInvalidParams},
+		{"fail", nil, 4000},
+	} {
+		var rpcErr *jsonrpc.Error
+		if err := conn.Call(ctx, tc.method, tc.params, nil); !errors.As(err, &rpcErr) || rpcErr.Code != tc.code {
+			t.Fatalf("%s: expect error code %d found %v", tc.method, tc.code, err)
+		}
+	}
+}
+
+func TestJSONRPCTimeout(t *testing.T) {
+	conn := dialRPC(t, newRPCServer(t, &jsonrpc.Server{}), nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := conn.Call(ctx, "wait", nil, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect context.DeadlineExceeded found %v", err)
+	}
+
+	// The connection is still usable after an abandoned call.
+	var sum int
+	if err := conn.Call(context.Background(), "add", [2]int{2, 2}, &sum); err != nil || sum != 4 {
+		t.Fatalf("expect 4 found %d, %v", sum, err)
+	}
+}
+
+func TestJSONRPCClose(t *testing.T) {
+	conn := dialRPC(t, newRPCServer(t, &jsonrpc.Server{}), nil)
+
+	result := make(chan error, 1)
+	go func() { result <- conn.Call(context.Background(), "wait", nil, nil) }()
+
+	time.Sleep(20 * time.Millisecond)
+	conn.Close()
+
+	if err := <-result; !errors.Is(err, jsonrpc.ErrClosed) {
+		t.Fatalf("expect ErrClosed found %v", err)
+	}
+}
+
+func TestJSONRPCBothDirections(t *testing.T) {
+	notified := make(chan string, 1)
+	client := jsonrpc.NewRegistry()
+	jsonrpc.Register(client, "name", func(ctx context.Context, p struct{}) (string, error) {
+		return "client", nil
+	})
+	jsonrpc.Register(client, "welcome", func(ctx context.Context, text string) (any, error) {
+		notified <- text
+		return nil, nil
+	})
+
+	url := newRPCServer(t, &jsonrpc.Server{
+		OnConnect: func(conn *jsonrpc.Conn) {
+			conn.Notify(context.Background(), "welcome", "hi")
+		},
+	})
+	conn := dialRPC(t, url, client)
+
+	if text := <-notified; text != "hi" {
+		t.Fatalf("expect notification %q found %q", "hi", text)
+	}
+
+	var greeting string
+	if err := conn.Call(context.Background(), "greet", nil, &greeting); err != nil || greeting != "hello, client" {
+		t.Fatalf("expect %q found %q, %v", "hello, client", greeting, err)
+	}
+}
+
+// rawRPC sends request as is and returns the decoded answer.
+func rawRPC(t *testing.T, ws websocket.WebSocket, request string) any {
+	t.Helper()
+
+	if err := ws.WriteMessage(websocket.OpcodeTextFrame, []byte(request)); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+
+	msg := ws.ReadMessage()
+	if msg.Err != nil {
+		t.Fatalf("ReadMessage: %v", msg.Err)
+	}
+
+	var answer any
+	if err := json.Unmarshal(msg.Data, &answer); err != nil {
+		t.Fatalf("invalid answer %s: %v", msg.Data, err)
+	}
+	return answer
+}
+
+func errorCode(t *testing.T, answer any) float64 {
+	t.Helper()
+
+	obj, _ := answer.(map[string]any)
+	rpcErr, _ := obj["error"].(map[string]any)
+	code, ok := rpcErr["code"].(float64)
+	if !ok {
+		t.Fatalf("expect an error response found %v", answer)
+	}
+	return code
+}
+
+func TestJSONRPCWire(t *testing.T) {
+	url := newRPCServer(t, &jsonrpc.Server{})
+	ws, err := (&websocket.WebSocketClient{}).DialWithContext(context.Background(), newURL(url), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	if code := errorCode(t, rawRPC(t, ws, `{"jsonrpc": "2.0", "method": "add", "params": [1,`)); code != jsonrpc.CodeParseError {
+		t.Fatalf("expect parse error found %v", code)
+	}
+
+	if code := errorCode(t, rawRPC(t, ws, `[]`)); code != jsonrpc.CodeInvalidRequest {
+		t.Fatalf("expect invalid request found %v", code)
+	}
+
+	if code := errorCode(t, rawRPC(t, ws, `{"jsonrpc": "1.0", "method": "add", "id": 1}`)); code != jsonrpc.CodeInvalidRequest {
+		t.Fatalf("expect invalid request found %v", code)
+	}
+
+	batch := rawRPC(t, ws, `[
+		{"jsonrpc": "2.0", "method": "add", "params": [1, 2], "id": "a"},
+		{"jsonrpc": "2.0", "method": "add", "params": [3, 4]},
+		{"foo": "boo"},
+		1,
+		{"jsonrpc": "2.0", "method": "missing", "id": "b"}
+	]`)
+
+	responses, ok := batch.([]any)
+	if !ok || len(responses) != 4 {
+		t.Fatalf("expect 4 responses, the notification is not answered, found %v", batch)
+	}
+
+	if first := responses[0].(map[string]any); first["id"] != "a" || first["result"] != float64(3) {
+		t.Fatalf("expect result 3 for id a found %v", first)
+	}
+
+	for i, code := range []float64{jsonrpc.CodeInvalidRequest, jsonrpc.CodeInvalidRequest, jsonrpc.CodeMethodNotFound} {
+		if found := errorCode(t, responses[i+1]); found != code {
+			t.Fatalf("response %d: expect error %v found %v", i+1, code, found)
+		}
+	}
+}
+
+func TestJSONRPCHandlerPanic(t *testing.T) {
+	url := newRPCServer(t, &jsonrpc.Server{})
+	ws, err := (&websocket.WebSocketClient{}).DialWithContext(context.Background(), newURL(url), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	if code := errorCode(t, rawRPC(t, ws, `{"jsonrpc": "2.0", "method": "panic", "id": 1}`)); code != jsonrpc.CodeInternalError {
+		t.Fatalf("expect internal error found %v", code)
+	}
+
+	// The notification is not answered, the request after it is.
+	ws.WriteMessage(websocket.OpcodeTextFrame, []byte(`{"jsonrpc": "2.0", "method": "panic"}`))
+	answer := rawRPC(t, ws, `{"jsonrpc": "2.0", "method": "add", "params": [1, 2], "id": 2}`)
+	if obj, _ := answer.(map[string]any); obj["id"] != float64(2) || obj["result"] != float64(3) {
+		t.Fatalf("expect result 3 for id 2 found %v", answer)
+	}
+
+	batch := rawRPC(t, ws, `[
+		{"jsonrpc": "2.0", "method": "panic", "id": "a"},
+		{"jsonrpc": "2.0", "method": "panic"},
+		{"jsonrpc": "2.0", "method": "add", "params": [3, 4], "id": "b"}
+	]`)
+
+	responses, ok := batch.([]any)
+	if !ok || len(responses) != 2 {
+		t.Fatalf("expect 2 responses found %v", batch)
+	}
+	if code := errorCode(t, responses[0]); code != jsonrpc.CodeInternalError {
+		t.Fatalf("expect internal error found %v", code)
+	}
+	if second := responses[1].(map[string]any); second["id"] != "b" || second["result"] != float64(7) {
+		t.Fatalf("expect result 7 for id b found %v", second)
+	}
+}
@@ -0,0 +1,200 @@
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+	"github.com/prafitradimas/websocket/pkg/websocket/conformance"
+)
+
+// logRecords collects the records of a JSON logger, written from the
+// goroutines of both ends of a connection.
+type logRecords struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *logRecords) Write(b []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(b)
+}
+
+// find returns the records with the message msg.
+func (l *logRecords) find(t *testing.T, msg string) []map[string]any {
+	t.Helper()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var found []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(l.buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+		if record["msg"] == msg {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+func TestLogger(t *testing.T) {
+	var serverLog, clientLog logRecords
+	server := httptest.NewServer(conformance.EchoHandler(&websocket.WebSocketServer{
+		Subprotocols: []string{"chat"},
+		Logger:       slog.New(slog.NewJSONHandler(&serverLog, nil)),
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := &websocket.WebSocketClient{
+		Subprotocols: []string{"chat"},
+		Logger:       slog.New(slog.NewJSONHandler(&clientLog, nil)),
+	}
+
+	ws, err := client.DialWithContext(context.Background(), newURL(url), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+
+	ws.WriteMessage(websocket.OpcodeTextFrame, []byte("quiet"))
+	ws.ReadMessage()
+
+	// Frames are logged below Debug, until the level of this connection is
+	// raised.
+	websocket.SetLogger(ws, slog.New(slog.NewJSONHandler(&clientLog, nil)), slog.LevelInfo)
+	ws.WriteMessage(websocket.OpcodeTextFrame, []byte("loud"))
+	ws.ReadMessage()
+
+	ws.WriteCloseMessage(websocket.CloseNormalClosure, []byte("bye"))
+	ws.ReadMessage()
+	ws.Close()
+
+	http.Get(server.URL)
+
+	deadline := time.Now().Add(time.Second)
+	for len(serverLog.find(t, "websocket: close sent")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	accepted := serverLog.find(t, "websocket: handshake accepted")
+	if len(accepted) != 1 || accepted[0]["subprotocol"] != "chat" || accepted[0]["remote_addr"] == "" {
+		t.Fatalf("expect one accepted handshake on chat found %v", accepted)
+	}
+
+	rejected := serverLog.find(t, "websocket: handshake rejected")
+	if len(rejected) != 1 || rejected[0]["reason"] == "" || rejected[0]["level"] != "WARN" {
+		t.Fatalf("expect one rejected handshake with a reason found %v", rejected)
+	}
+
+	if n := len(clientLog.find(t, "websocket: handshake accepted")); n != 1 {
+		t.Fatalf("expect one accepted handshake on the client found %d", n)
+	}
+
+	for _, c := range []struct {
+		log *logRecords
+		msg string
+	}{
+		{&clientLog, "websocket: close sent"},
+		{&clientLog, "websocket: close received"},
+		{&serverLog, "websocket: close received"},
+		{&serverLog, "websocket: close sent"},
+	} {
+		records := c.log.find(t, c.msg)
+		if len(records) != 1 || records[0]["code"] != float64(1000) || records[0]["initiator"] != "client" {
+			t.Fatalf("expect %s by the client with code 1000 found %v", c.msg, records)
+		}
+	}
+
+	frames := clientLog.find(t, "websocket: frame")
+	if len(frames) < 3 {
+		t.Fatalf("expect the frames after SetLogger found %v", frames)
+	}
+	if frames[0]["direction"] != "write" || frames[0]["opcode"] != websocket.OpcodeTextFrame.String() || frames[0]["length"] != float64(4) {
+		t.Fatalf("expect the 4 bytes text frame written first found %v", frames[0])
+	}
+	if n := len(serverLog.find(t, "websocket: frame")); n != 0 {
+		t.Fatalf("expect no frame on the server found %d", n)
+	}
+}
+
+func TestLoggerProtocolViolation(t *testing.T) {
+	var serverLog logRecords
+	server := httptest.NewServer(conformance.EchoHandler(&websocket.WebSocketServer{
+		Logger: slog.New(slog.NewJSONHandler(&serverLog, nil)),
+	}))
+	defer server.Close()
+
+	conn, _, _ := rawHandshake(t, server.URL, "")
+
+	// Clients must mask their frames.
+	conn.Write([]byte{0x81, 0x02, 'h', 'i'})
+	if status := readCloseStatus(t, conn); status != websocket.CloseProtocolError {
+		t.Fatalf("expect %d found %d", websocket.CloseProtocolError, status)
+	}
+
+	violations := serverLog.find(t, "websocket: protocol violation")
+	if len(violations) != 1 || violations[0]["status"] != float64(websocket.CloseProtocolError) {
+		t.Fatalf("expect one protocol violation found %v", violations)
+	}
+}
+
+// closeBothSides writes a close frame while reading, so that the close frame
+// of the peer may be received while this one is being sent.
+func closeBothSides(ws websocket.WebSocket) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ws.WriteCloseMessage(websocket.CloseGoingAway, nil)
+	}()
+
+	for ws.ReadMessage().Err == nil {
+	}
+	wg.Wait()
+	ws.Close()
+}
+
+func TestLoggerSimultaneousClose(t *testing.T) {
+	var serverLog, clientLog logRecords
+
+	wsServer := &websocket.WebSocketServer{Logger: slog.New(slog.NewJSONHandler(&serverLog, nil))}
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { done <- struct{}{} }()
+
+		ws, err := wsServer.Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		closeBothSides(ws)
+	}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := &websocket.WebSocketClient{Logger: slog.New(slog.NewJSONHandler(&clientLog, nil))}
+
+	for range 20 {
+		ws, err := client.DialWithContext(context.Background(), newURL(url), nil)
+		if err != nil {
+			t.Fatalf("DialWithContext: %v", err)
+		}
+		closeBothSides(ws)
+		<-done
+	}
+
+	if n := len(clientLog.find(t, "websocket: close sent")); n != 20 {
+		t.Fatalf("expect 20 close frames sent by the client found %d", n)
+	}
+}
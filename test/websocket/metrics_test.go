@@ -0,0 +1,94 @@
+package websocket_test
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+	"github.com/prafitradimas/websocket/pkg/websocket/conformance"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := &websocket.Metrics{}
+	server := httptest.NewServer(conformance.EchoHandler(&websocket.WebSocketServer{Metrics: metrics}))
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	client := &websocket.WebSocketClient{Metrics: metrics}
+
+	ws, err := client.DialWithContext(context.Background(), newURL(url), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+
+	if n := metrics.ActiveConnections(websocket.RoleClient); n != 1 {
+		t.Fatalf("expect 1 active client found %d", n)
+	}
+
+	ws.WriteMessage(websocket.OpcodeTextFrame, []byte("hello"))
+	ws.ReadMessage()
+	ws.WriteCloseMessage(websocket.CloseGoingAway, nil)
+	ws.ReadMessage()
+	ws.Close()
+
+	// The server rejects a plain GET, the client rejects a 404, and nothing
+	// listens on a closed port.
+	http.Get(server.URL)
+	notFound := httptest.NewServer(http.NotFoundHandler())
+	defer notFound.Close()
+	client.DialWithContext(context.Background(), newURL("ws"+strings.TrimPrefix(notFound.URL, "http")), nil)
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	ln.Close()
+	client.DialWithContext(context.Background(), newURL("ws://"+ln.Addr().String()), nil)
+
+	// The server closes its side once it has answered the close frame.
+	deadline := time.Now().Add(time.Second)
+	for metrics.ActiveConnections(websocket.RoleServer) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	res := httptest.NewRecorder()
+	metrics.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := res.Body.String()
+
+	for _, line := range []string{
+		"# TYPE websocket_connections_active gauge",
+		`websocket_connections_active{role="client"} 0`,
+		`websocket_connections_active{role="server"} 0`,
+		`websocket_handshakes_total{role="client",result="accepted"} 1`,
+		`websocket_handshakes_total{role="client",result="failed"} 1`,
+		`websocket_handshakes_total{role="client",result="rejected"} 1`,
+		`websocket_handshakes_total{role="server",result="accepted"} 1`,
+		`websocket_handshakes_total{role="server",result="rejected"} 1`,
+		`websocket_messages_total{direction="in",opcode="text"} 2`,
+		`websocket_messages_total{direction="out",opcode="text"} 2`,
+		`websocket_message_bytes_total{direction="out",opcode="text"} 10`,
+		`websocket_close_codes_total{code="1001",direction="received"} 2`,
+		`websocket_close_codes_total{code="1001",direction="sent"} 2`,
+		`websocket_errors_total{op="read"} 0`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expect %s in\n%s", line, body)
+		}
+	}
+
+	var vars map[string]map[string]int64
+	if err := json.Unmarshal([]byte(metrics.String()), &vars); err != nil {
+		t.Fatalf("expect the expvar to be JSON found %v", err)
+	}
+
+	if n := vars["websocket_handshakes_total"][`role="server",result="rejected"`]; n != 1 {
+		t.Fatalf("expect 1 rejected handshake in the expvar found %d", n)
+	}
+
+	if expvar.Get("websocket") != websocket.DefaultMetrics {
+		t.Fatalf("expect DefaultMetrics to be published")
+	}
+}
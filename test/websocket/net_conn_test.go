@@ -0,0 +1,114 @@
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// newNetConnPair dials a server that hands its side of the connection to
+// serve as a net.Conn, and returns the client side as one too.
+func newNetConnPair(t *testing.T, serve func(conn net.Conn)) net.Conn {
+	t.Helper()
+
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer close(done)
+
+		ws, err := (&websocket.WebSocketServer{}).Upgrade(w, r)
+		if err != nil {
+			t.Errorf("Upgrade: %v", err)
+			return
+		}
+		serve(websocket.NetConn(ws, websocket.OpcodeBinaryFrame))
+	}))
+	t.Cleanup(func() {
+		<-done
+		server.Close()
+	})
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+	ws, err := (&websocket.WebSocketClient{}).DialWithContext(context.Background(), newURL(url), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	return websocket.NetConn(ws, websocket.OpcodeBinaryFrame)
+}
+
+func TestNetConnStream(t *testing.T) {
+	conn := newNetConnPair(t, func(conn net.Conn) {
+		defer conn.Close()
+		io.Copy(conn, conn)
+	})
+
+	for _, part := range []string{"hello", " ", "stream"} {
+		if _, err := conn.Write([]byte(part)); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	// The three messages are read as one stream, across their boundaries.
+	buf := make([]byte, len("hello stream"))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("ReadFull: %v", err)
+	}
+
+	if string(buf) != "hello stream" {
+		t.Fatalf("expect %q found %q", "hello stream", buf)
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+}
+
+func TestNetConnCloseHandshake(t *testing.T) {
+	result := make(chan error, 1)
+	conn := newNetConnPair(t, func(conn net.Conn) {
+		defer conn.Close()
+
+		_, err := io.ReadAll(conn)
+		result <- err
+	})
+
+	if _, err := conn.Write([]byte("bye")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// io.ReadAll only returns nil when the stream ended with io.EOF, that is
+	// when the close frame was received.
+	if err := <-result; err != nil {
+		t.Fatalf("expect the stream to end cleanly found %v", err)
+	}
+}
+
+func TestNetConnDeadline(t *testing.T) {
+	release := make(chan struct{})
+	conn := newNetConnPair(t, func(conn net.Conn) {
+		defer conn.Close()
+		<-release
+	})
+	defer conn.Close()
+	defer close(release)
+
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+
+	_, err := conn.Read(make([]byte, 1))
+
+	var ne net.Error
+	if !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("expect timeout net.Error found %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package websocket_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+var fastBackoff = &websocket.Backoff{
+	Initial:    time.Millisecond,
+	Max:        10 * time.Millisecond,
+	Multiplier: 2,
+}
+
+// newFlakyServer closes the first connection it accepts with status and
+// echoes on the following ones. It returns the URL and the number of
+// connections accepted so far.
+func newFlakyServer(t *testing.T, status websocket.CloseStatus) (string, *atomic.Int32) {
+	t.Helper()
+
+	var conns atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := (&websocket.WebSocketServer{}).Upgrade(w, r)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		if conns.Add(1) == 1 {
+			if status == websocket.CloseAbnormalClosure {
+				return
+			}
+			ws.WriteCloseMessage(status, nil)
+			ws.ReadMessage()
+			return
+		}
+
+		for {
+			msg := ws.ReadMessage()
+			if msg.Err != nil {
+				return
+			}
+			if msg.Opcode.IsData() {
+				ws.WriteMessage(msg.Opcode, msg.Data)
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http"), &conns
+}
+
+func TestReconnectingClientReconnects(t *testing.T) {
+	for _, status := range []websocket.CloseStatus{
+		websocket.CloseAbnormalClosure,
+		websocket.CloseGoingAway,
+		websocket.CloseInternalServerErr,
+		websocket.CloseServiceRestart,
+	} {
+		t.Run(status.String(), func(t *testing.T) {
+			url, conns := newFlakyServer(t, status)
+
+			var connects, disconnects atomic.Int32
+			rc := &websocket.ReconnectingClient{
+				URL:     url,
+				Backoff: fastBackoff,
+				OnConnect: func(ws websocket.WebSocket) error {
+					// Only the second connection echoes this back.
+					connects.Add(1)
+					return ws.WriteMessage(websocket.OpcodeTextFrame, []byte("subscribe"))
+				},
+				OnDisconnect: func(err error) { disconnects.Add(1) },
+			}
+			defer rc.Close()
+
+			if err := rc.Connect(context.Background()); err != nil {
+				t.Fatalf("Connect: %v", err)
+			}
+
+			msg := rc.ReadMessage()
+			if msg.Err != nil || string(msg.Data) != "subscribe" {
+				t.Fatalf("expect %q found %q, %v", "subscribe", msg.Data, msg.Err)
+			}
+
+			if conns.Load() != 2 || connects.Load() != 2 || disconnects.Load() != 1 {
+				t.Fatalf("expect 2 connections and 1 disconnect found %d connections, %d OnConnect, %d OnDisconnect",
+					conns.Load(), connects.Load(), disconnects.Load())
+			}
+		})
+	}
+}
+
+func TestReconnectingClientStops(t *testing.T) {
+	for _, status := range []websocket.CloseStatus{websocket.CloseNormalClosure, websocket.ClosePolicyViolation} {
+		t.Run(status.String(), func(t *testing.T) {
+			url, conns := newFlakyServer(t, status)
+
+			rc := &websocket.ReconnectingClient{URL: url, Backoff: fastBackoff}
+			defer rc.Close()
+
+			if err := rc.Connect(context.Background()); err != nil {
+				t.Fatalf("Connect: %v", err)
+			}
+
+			if err := rc.ReadMessage().Err; !websocket.IsCloseError(err, status) {
+				t.Fatalf("expect close %d found %v", status, err)
+			}
+
+			if conns.Load() != 1 {
+				t.Fatalf("expect no reconnection found %d connections", conns.Load())
+			}
+		})
+	}
+}
+
+func TestReconnectingClientTryAgainLater(t *testing.T) {
+	url, _ := newFlakyServer(t, websocket.CloseTryAgainLater)
+
+	backoff := *fastBackoff
+	backoff.Max = 200 * time.Millisecond
+
+	rc := &websocket.ReconnectingClient{
+		URL:     url,
+		Backoff: &backoff,
+		OnConnect: func(ws websocket.WebSocket) error {
+			return ws.WriteMessage(websocket.OpcodeTextFrame, []byte("again"))
+		},
+	}
+	defer rc.Close()
+
+	if err := rc.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	start := time.Now()
+	if msg := rc.ReadMessage(); msg.Err != nil {
+		t.Fatalf("ReadMessage: %v", msg.Err)
+	}
+
+	if elapsed := time.Since(start); elapsed < backoff.Max {
+		t.Fatalf("expect to wait the maximum delay %s before reconnecting, waited %s", backoff.Max, elapsed)
+	}
+}
+
+func TestReconnectingClientServiceRestart(t *testing.T) {
+	url, _ := newFlakyServer(t, websocket.CloseServiceRestart)
+
+	// With this much jitter, a jittered delay would almost never reach
+	// Initial.
+	backoff := websocket.Backoff{
+		Initial:    100 * time.Millisecond,
+		Max:        time.Second,
+		Multiplier: 2,
+		Jitter:     0.9,
+	}
+
+	rc := &websocket.ReconnectingClient{
+		URL:     url,
+		Backoff: &backoff,
+		OnConnect: func(ws websocket.WebSocket) error {
+			return ws.WriteMessage(websocket.OpcodeTextFrame, []byte("restarted"))
+		},
+	}
+	defer rc.Close()
+
+	if err := rc.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+
+	start := time.Now()
+	if msg := rc.ReadMessage(); msg.Err != nil || string(msg.Data) != "restarted" {
+		t.Fatalf("expect %q found %q, %v", "restarted", msg.Data, msg.Err)
+	}
+
+	if elapsed := time.Since(start); elapsed < backoff.Initial {
+		t.Fatalf("expect to wait the initial delay %s before reconnecting, waited %s", backoff.Initial, elapsed)
+	}
+}
+
+func TestReconnectingClientMaxAttempts(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	rc := &websocket.ReconnectingClient{
+		URL:         "ws" + strings.TrimPrefix(server.URL, "http"),
+		Backoff:     fastBackoff,
+		MaxAttempts: 3,
+	}
+	defer rc.Close()
+
+	err := rc.Connect(context.Background())
+	if !errors.Is(err, websocket.ErrBadHandshake) {
+		t.Fatalf("expect the last handshake error found %v", err)
+	}
+
+	if attempts.Load() != 3 {
+		t.Fatalf("expect 3 attempts found %d", attempts.Load())
+	}
+
+	if err := rc.WriteMessage(websocket.OpcodeTextFrame, nil); !errors.Is(err, websocket.ErrNotConnected) {
+		t.Fatalf("expect ErrNotConnected found %v", err)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	b := websocket.Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2, Jitter: 0.5}
+
+	for attempt, max := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		max *= time.Millisecond
+		for range 20 {
+			if d := b.Delay(attempt); d > max || d < max/2 {
+				t.Fatalf("attempt %d: expect a delay within [%s, %s] found %s", attempt, max/2, max, d)
+			}
+		}
+	}
+}
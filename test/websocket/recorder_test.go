@@ -0,0 +1,72 @@
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+	"github.com/prafitradimas/websocket/pkg/websocket/conformance"
+)
+
+func TestRecorder(t *testing.T) {
+	server := httptest.NewServer(conformance.EchoHandler(&websocket.WebSocketServer{}))
+	defer server.Close()
+
+	ws, err := (&websocket.WebSocketClient{}).DialWithContext(context.Background(), newURL("ws"+strings.TrimPrefix(server.URL, "http")), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+
+	var recording bytes.Buffer
+	recorder := websocket.NewRecorder(ws, &recording)
+	defer recorder.Close()
+
+	recorder.WriteMessage(websocket.OpcodeTextFrame, []byte("hello"))
+	recorder.ReadMessage()
+	recorder.WriteMessage(websocket.OpcodeBinaryFrame, []byte{0, 1, 2})
+	recorder.ReadMessage()
+	recorder.WriteCloseMessage(websocket.CloseNormalClosure, []byte("bye"))
+	recorder.ReadMessage()
+
+	if err := recorder.Err(); err != nil {
+		t.Fatalf("Err: %v", err)
+	}
+
+	expect := []struct {
+		direction string
+		opcode    websocket.Opcode
+		payload   []byte
+	}{
+		{websocket.RecordSent, websocket.OpcodeTextFrame, []byte("hello")},
+		{websocket.RecordReceived, websocket.OpcodeTextFrame, []byte("hello")},
+		{websocket.RecordSent, websocket.OpcodeBinaryFrame, []byte{0, 1, 2}},
+		{websocket.RecordReceived, websocket.OpcodeBinaryFrame, []byte{0, 1, 2}},
+		{websocket.RecordSent, websocket.OpcodeCloseFrame, []byte("\x03\xe8bye")},
+		{websocket.RecordReceived, websocket.OpcodeCloseFrame, []byte("\x03\xe8")},
+	}
+
+	lines := strings.Split(strings.TrimSpace(recording.String()), "\n")
+	if len(lines) != len(expect) {
+		t.Fatalf("expect %d records found %d:\n%s", len(expect), len(lines), recording.String())
+	}
+
+	if !strings.Contains(lines[0], `"opcode":"TEXT","text":"hello"`) {
+		t.Fatalf("expect the text message as text found %s", lines[0])
+	}
+
+	for i, line := range lines {
+		var rec websocket.Record
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+
+		e := expect[i]
+		if rec.Direction != e.direction || rec.Opcode != e.opcode || !bytes.Equal(rec.Payload(), e.payload) || rec.Time.IsZero() {
+			t.Fatalf("record %d: expect %s %s %q found %s", i+1, e.direction, e.opcode, e.payload, line)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+)
+
+// upstreamHandler echoes data messages, and closes the connection with
+// status 4001 when it receives "bye". Every close status it receives is
+// sent to closed.
+type upstreamHandler struct {
+	closed chan error
+}
+
+func (h upstreamHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server := &websocket.WebSocketServer{Subprotocols: []string{"chat"}}
+	ws, err := server.Upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	for {
+		msg := ws.ReadMessage()
+		if msg.Err != nil {
+			h.closed <- msg.Err
+			return
+		}
+
+		switch {
+		case msg.Opcode.IsData() && string(msg.Data) == "bye":
+			ws.WriteCloseMessage(4001, []byte("see you"))
+		case msg.Opcode.IsData():
+			ws.WriteMessage(msg.Opcode, msg.Data)
+		case msg.Opcode == websocket.OpcodePingFrame:
+			ws.WriteMessage(websocket.OpcodePongFrame, msg.Data)
+		}
+	}
+}
+
+func newProxy(t *testing.T, proxy *websocket.ReverseProxy) (string, chan error) {
+	t.Helper()
+
+	closed := make(chan error, 1)
+	upstream := httptest.NewServer(upstreamHandler{closed: closed})
+	t.Cleanup(upstream.Close)
+
+	proxy.Target = newURL("ws" + strings.TrimPrefix(upstream.URL, "http"))
+
+	server := httptest.NewServer(proxy)
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http"), closed
+}
+
+func dialProxy(t *testing.T, url string, subprotocols ...string) websocket.WebSocket {
+	t.Helper()
+
+	client := &websocket.WebSocketClient{Subprotocols: subprotocols}
+	ws, err := client.DialWithContext(context.Background(), newURL(url), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	return ws
+}
+
+func TestReverseProxyRelay(t *testing.T) {
+	url, _ := newProxy(t, &websocket.ReverseProxy{})
+	ws := dialProxy(t, url, "other", "chat")
+
+	if ws.Subprotocol() != "chat" {
+		t.Fatalf("expect the subprotocol of the upstream %q found %q", "chat", ws.Subprotocol())
+	}
+
+	for _, m := range []websocket.Message{
+		{Opcode: websocket.OpcodeTextFrame, Data: []byte("hello")},
+		{Opcode: websocket.OpcodeBinaryFrame, Data: []byte{0, 1, 2}},
+		{Opcode: websocket.OpcodePingFrame, Data: []byte("ping")},
+	} {
+		if err := ws.WriteMessage(m.Opcode, m.Data); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+
+		expect := m.Opcode
+		if expect == websocket.OpcodePingFrame {
+			expect = websocket.OpcodePongFrame
+		}
+
+		msg := ws.ReadMessage()
+		if msg.Err != nil || msg.Opcode != expect || !bytes.Equal(msg.Data, m.Data) {
+			t.Fatalf("expect %s %q found %s %q, %v", expect, m.Data, msg.Opcode, msg.Data, msg.Err)
+		}
+	}
+}
+
+func TestReverseProxyCloseFromClient(t *testing.T) {
+	url, closed := newProxy(t, &websocket.ReverseProxy{})
+	ws := dialProxy(t, url)
+
+	if err := ws.WriteCloseMessage(4000, []byte("done")); err != nil {
+		t.Fatalf("WriteCloseMessage: %v", err)
+	}
+
+	err := <-closed
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != 4000 || closeErr.Text != "done" {
+		t.Fatalf("expect the upstream to receive close 4000 %q found %v", "done", err)
+	}
+}
+
+func TestReverseProxyCloseFromUpstream(t *testing.T) {
+	url, _ := newProxy(t, &websocket.ReverseProxy{})
+	ws := dialProxy(t, url)
+
+	if err := ws.WriteMessage(websocket.OpcodeTextFrame, []byte("bye")); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+
+	var err error
+	for err == nil {
+		err = ws.ReadMessage().Err
+	}
+
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != 4001 || closeErr.Text != "see you" {
+		t.Fatalf("expect close 4001 %q found %v", "see you", err)
+	}
+}
+
+func TestReverseProxyHooks(t *testing.T) {
+	url, _ := newProxy(t, &websocket.ReverseProxy{
+		OnClientMessage: func(r *http.Request, msg *websocket.Message) error {
+			switch string(msg.Data) {
+			case "secret":
+				return websocket.ErrDropMessage
+			case "forbidden":
+				return errors.New("forbidden message")
+			}
+			return nil
+		},
+		OnUpstreamMessage: func(r *http.Request, msg *websocket.Message) error {
+			msg.Data = bytes.ToUpper(msg.Data)
+			return nil
+		},
+	})
+	ws := dialProxy(t, url)
+
+	for _, data := range []string{"secret", "hello"} {
+		if err := ws.WriteMessage(websocket.OpcodeTextFrame, []byte(data)); err != nil {
+			t.Fatalf("WriteMessage: %v", err)
+		}
+	}
+
+	// "secret" never reaches the upstream, "hello" comes back rewritten.
+	if msg := ws.ReadMessage(); msg.Err != nil || string(msg.Data) != "HELLO" {
+		t.Fatalf("expect %q found %q, %v", "HELLO", msg.Data, msg.Err)
+	}
+
+	if err := ws.WriteMessage(websocket.OpcodeTextFrame, []byte("forbidden")); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+
+	var err error
+	for err == nil {
+		err = ws.ReadMessage().Err
+	}
+
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("expect close %d found %v", websocket.ClosePolicyViolation, err)
+	}
+}
+
+func TestReverseProxyBadGateway(t *testing.T) {
+	var records logRecords
+	proxy := &websocket.ReverseProxy{
+		Target: newURL("ws://127.0.0.1:1/"),
+		Logger: slog.New(slog.NewJSONHandler(&records, nil)),
+	}
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	client := &websocket.WebSocketClient{}
+	_, err := client.DialWithContext(context.Background(), newURL("ws"+strings.TrimPrefix(server.URL, "http")+"/chat"), nil)
+	if !errors.Is(err, websocket.ErrBadHandshake) || !strings.Contains(err.Error(), "502") {
+		t.Fatalf("expect a 502 handshake error found %v", err)
+	}
+
+	failed := records.find(t, "websocket: proxy failed")
+	if len(failed) != 1 || failed[0]["level"] != "ERROR" || failed[0]["path"] != "/chat" || failed[0]["error"] == "" {
+		t.Fatalf("expect one error record for /chat found %v", failed)
+	}
+}
+
+func TestReverseProxyForwardedHeaders(t *testing.T) {
+	requests := make(chan *http.Request, 1)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r
+		upstreamHandler{closed: make(chan error, 1)}.ServeHTTP(w, r)
+	}))
+	defer upstream.Close()
+
+	proxy := &websocket.ReverseProxy{
+		Target: newURL("ws" + strings.TrimPrefix(upstream.URL, "http")),
+	}
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	header := http.Header{}
+	header.Set("Origin", "http://example.com")
+	header.Set("Authorization", "Bearer token")
+	header.Set("X-Forwarded-For", "203.0.113.7")
+	header.Set("X-Private", "secret")
+
+	ws, err := (&websocket.WebSocketClient{}).DialWithContext(context.Background(), newURL("ws"+strings.TrimPrefix(server.URL, "http")+"/feed?id=1"), header)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	r := <-requests
+	expect := map[string]string{
+		"Origin":            "http://example.com",
+		"Authorization":     "Bearer token",
+		"X-Forwarded-For":   "203.0.113.7, 127.0.0.1",
+		"X-Forwarded-Host":  strings.TrimPrefix(server.URL, "http://"),
+		"X-Forwarded-Proto": "ws",
+		"X-Private":         "",
+	}
+	for name, value := range expect {
+		if found := r.Header.Get(name); found != value {
+			t.Fatalf("expect %s %q found %q", name, value, found)
+		}
+	}
+
+	if r.RequestURI != "/feed?id=1" {
+		t.Fatalf("expect request target /feed?id=1 found %s", r.RequestURI)
+	}
+}
@@ -0,0 +1,318 @@
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+	"github.com/prafitradimas/websocket/pkg/websocket/stomp"
+)
+
+func newSTOMPServer(t *testing.T, server *stomp.Server) string {
+	t.Helper()
+
+	if server.Broker == nil {
+		server.Broker = stomp.NewBroker()
+	}
+
+	s := httptest.NewServer(server)
+	t.Cleanup(s.Close)
+
+	return "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+func dialSTOMP(t *testing.T, url string, opts *stomp.Options) *stomp.Client {
+	t.Helper()
+
+	c, err := stomp.Dial(context.Background(), url, opts)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func receive(t *testing.T, sub *stomp.Subscription) *stomp.Frame {
+	t.Helper()
+
+	select {
+	case msg, ok := <-sub.C:
+		if !ok {
+			t.Fatalf("subscription %s closed", sub.ID)
+		}
+		return msg
+	case <-time.After(time.Second):
+		t.Fatalf("no message on %s", sub.Destination)
+		return nil
+	}
+}
+
+func TestSTOMPFrame(t *testing.T) {
+	f := stomp.NewFrame(stomp.CommandSend, "destination", "/queue/a", "key:with\\escapes", "line\nbreak")
+	f.Body = []byte("null \x00 inside")
+
+	parsed, err := stomp.ParseFrame(f.Bytes())
+	if err != nil {
+		t.Fatalf("ParseFrame: %v", err)
+	}
+
+	if parsed.Command != stomp.CommandSend || parsed.Header.Get("key:with\\escapes") != "line\nbreak" {
+		t.Fatalf("expect escaped header to round trip found %+v", parsed.Header)
+	}
+
+	if !bytes.Equal(parsed.Body, f.Body) {
+		t.Fatalf("expect body %q found %q", f.Body, parsed.Body)
+	}
+
+	crlf, err := stomp.ParseFrame([]byte("\r\n\r\nMESSAGE\r\ndestination:/a\r\ndestination:/b\r\n\r\nbody\x00\r\n"))
+	if err != nil {
+		t.Fatalf("ParseFrame: %v", err)
+	}
+
+	if crlf.Header.Get("destination") != "/a" || string(crlf.Body) != "body" {
+		t.Fatalf("expect the first repeated header and body found %+v %q", crlf.Header, crlf.Body)
+	}
+
+	for _, data := range []string{
+		"SEND\nkey:\\t\n\n\x00",
+		"SEND\ncontent-length:10\n\nshort\x00",
+		"SEND\n\nno null",
+		"SEND\n\nbody\x00trailing",
+	} {
+		if _, err := stomp.ParseFrame([]byte(data)); !errors.Is(err, stomp.ErrInvalidFrame) {
+			t.Fatalf("%q: expect ErrInvalidFrame found %v", data, err)
+		}
+	}
+}
+
+func TestSTOMPSubscribeSend(t *testing.T) {
+	url := newSTOMPServer(t, &stomp.Server{})
+	ctx := context.Background()
+
+	subscriber := dialSTOMP(t, url, nil)
+	publisher := dialSTOMP(t, url, nil)
+
+	if p := subscriber.WebSocket().Subprotocol(); p != stomp.Subprotocol {
+		t.Fatalf("expect subprotocol %q found %q", stomp.Subprotocol, p)
+	}
+
+	sub, err := subscriber.Subscribe(ctx, "/topic/a", "")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	send := stomp.NewFrame(stomp.CommandSend, "destination", "/topic/a", "custom", "value")
+	send.Body = []byte("hello")
+	if err := publisher.Request(ctx, send); err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+
+	msg := receive(t, sub)
+	if string(msg.Body) != "hello" || msg.Header.Get("custom") != "value" ||
+		msg.Header.Get("subscription") != sub.ID || msg.Header.Get("message-id") == "" {
+		t.Fatalf("unexpected message %+v %q", msg.Header, msg.Body)
+	}
+
+	if err := sub.Unsubscribe(ctx); err != nil {
+		t.Fatalf("Unsubscribe: %v", err)
+	}
+
+	if err := publisher.Request(ctx, send); err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+
+	select {
+	case msg := <-sub.C:
+		t.Fatalf("expect no message after Unsubscribe found %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := subscriber.Disconnect(ctx); err != nil {
+		t.Fatalf("Disconnect: %v", err)
+	}
+
+	var ce *websocket.CloseError
+	if err := subscriber.Err(); !errors.As(err, &ce) || ce.Code != websocket.CloseNormalClosure {
+		t.Fatalf("expect a normal closure found %v", err)
+	}
+}
+
+func TestSTOMPAck(t *testing.T) {
+	broker := stomp.NewBroker()
+	broker.DeadLetter = "/queue/dead"
+	url := newSTOMPServer(t, &stomp.Server{Broker: broker})
+	ctx := context.Background()
+
+	c := dialSTOMP(t, url, nil)
+
+	dead, err := c.Subscribe(ctx, "/queue/dead", stomp.AckAuto)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	work, err := c.Subscribe(ctx, "/queue/work", stomp.AckClient)
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	for _, body := range []string{"1", "2", "3"} {
+		if err := c.Send("/queue/work", "text/plain", []byte(body)); err != nil {
+			t.Fatalf("Send: %v", err)
+		}
+	}
+
+	msgs := []*stomp.Frame{receive(t, work), receive(t, work), receive(t, work)}
+
+	// ACK of the second message settles the first one as well.
+	if err := c.Ack(msgs[1]); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+
+	if err := c.Nack(msgs[2]); err != nil {
+		t.Fatalf("Nack: %v", err)
+	}
+
+	msg := receive(t, dead)
+	if string(msg.Body) != "3" || msg.Header.Get("original-destination") != "/queue/work" {
+		t.Fatalf("expect the NACKed message found %+v %q", msg.Header, msg.Body)
+	}
+
+	if err := c.Request(ctx, stomp.NewFrame(stomp.CommandAck, "id", msgs[0].Header.Get("ack"))); err == nil {
+		t.Fatal("expect an error acknowledging a settled message")
+	}
+
+	var serverErr *stomp.Error
+	if err := c.Err(); !errors.As(err, &serverErr) {
+		t.Fatalf("expect the connection to end with the ERROR frame found %v", err)
+	}
+
+	if _, ok := <-work.C; ok {
+		t.Fatal("expect subscriptions to be closed with the connection")
+	}
+}
+
+// rawSTOMP opens a WebSocket connection offering the STOMP subprotocol and
+// sends connect on it.
+func rawSTOMP(t *testing.T, url, connect string) websocket.WebSocket {
+	t.Helper()
+
+	client := &websocket.WebSocketClient{Subprotocols: []string{stomp.Subprotocol}}
+	ws, err := client.DialWithContext(context.Background(), newURL(url), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+
+	if err := ws.WriteMessage(websocket.OpcodeTextFrame, []byte(connect)); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+	return ws
+}
+
+func readSTOMPFrame(t *testing.T, ws websocket.WebSocket) *stomp.Frame {
+	t.Helper()
+
+	msg := ws.ReadMessage()
+	if msg.Err != nil {
+		t.Fatalf("ReadMessage: %v", msg.Err)
+	}
+
+	f, err := stomp.ParseFrame(msg.Data)
+	if err != nil {
+		t.Fatalf("ParseFrame: %v", err)
+	}
+	return f
+}
+
+func TestSTOMPHeartbeat(t *testing.T) {
+	url := newSTOMPServer(t, &stomp.Server{
+		HeartBeatSend:    20 * time.Millisecond,
+		HeartBeatReceive: 20 * time.Millisecond,
+	})
+
+	// The client asks for heart-beats every 10ms, the server sends them
+	// every 20ms, the larger of the two.
+	ws := rawSTOMP(t, url, "CONNECT\naccept-version:1.2\nhost:localhost\nheart-beat:0,10\n\n\x00")
+	if f := readSTOMPFrame(t, ws); f.Command != stomp.CommandConnected || f.Header.Get("heart-beat") != "20,20" {
+		t.Fatalf("unexpected CONNECTED frame %+v", f)
+	}
+
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	start := time.Now()
+	for range 3 {
+		msg := ws.ReadMessage()
+		if msg.Err != nil || string(msg.Data) != "\n" {
+			t.Fatalf("expect a heart-beat found %q, %v", msg.Data, msg.Err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("expect heart-beats every 20ms, 3 took %v", elapsed)
+	}
+
+	// A client that promises heart-beats and goes silent is disconnected.
+	silent := rawSTOMP(t, url, "CONNECT\naccept-version:1.2\nhost:localhost\nheart-beat:10,0\n\n\x00")
+	readSTOMPFrame(t, silent)
+
+	silent.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		msg := silent.ReadMessage()
+		if msg.Err != nil {
+			var te *websocket.TimeoutError
+			if errors.As(msg.Err, &te) {
+				t.Fatal("expect the server to drop the silent client")
+			}
+			break
+		}
+	}
+
+	// The client keeps its connection alive on its own.
+	c := dialSTOMP(t, url, &stomp.Options{
+		HeartBeatSend:    10 * time.Millisecond,
+		HeartBeatReceive: 10 * time.Millisecond,
+	})
+	time.Sleep(150 * time.Millisecond)
+
+	if err := c.Request(context.Background(), stomp.NewFrame(stomp.CommandSend, "destination", "/a")); err != nil {
+		t.Fatalf("expect the connection to be alive found %v", err)
+	}
+}
+
+func TestSTOMPConnectErrors(t *testing.T) {
+	url := newSTOMPServer(t, &stomp.Server{
+		Authenticate: func(login, passcode string) error {
+			if login != "guest" || passcode != "guest" {
+				return errors.New("bad credentials")
+			}
+			return nil
+		},
+	})
+
+	ws := rawSTOMP(t, url, "CONNECT\naccept-version:1.0,1.1\nhost:localhost\nlogin:guest\npasscode:guest\n\n\x00")
+	f := readSTOMPFrame(t, ws)
+	if f.Command != stomp.CommandError || f.Header.Get("version") != "1.2" {
+		t.Fatalf("expect an ERROR frame listing version 1.2 found %+v", f)
+	}
+
+	if msg := ws.ReadMessage(); msg.Opcode != websocket.OpcodeCloseFrame {
+		t.Fatalf("expect a close frame found %v, %v", msg.Opcode, msg.Err)
+	}
+
+	var ce *websocket.CloseError
+	if msg := ws.ReadMessage(); !errors.As(msg.Err, &ce) || ce.Code != websocket.CloseProtocolError {
+		t.Fatalf("expect close code %d found %v", websocket.CloseProtocolError, msg.Err)
+	}
+
+	var serverErr *stomp.Error
+	_, err := stomp.Dial(context.Background(), url, &stomp.Options{Login: "guest", Passcode: "wrong"})
+	if !errors.As(err, &serverErr) || serverErr.Frame.Header.Get("message") != "bad credentials" {
+		t.Fatalf("expect the authentication error found %v", err)
+	}
+
+	dialSTOMP(t, url, &stomp.Options{Login: "guest", Passcode: "guest"})
+}
@@ -0,0 +1,184 @@
+package websocket_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+	"github.com/prafitradimas/websocket/pkg/websocket/tcpbridge"
+)
+
+// newTCPEcho listens on localhost and echoes every connection.
+func newTCPEcho(t *testing.T) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func newBridgeServer(t *testing.T, s *tcpbridge.Server) string {
+	t.Helper()
+
+	s.Logger = log.New(io.Discard, "", 0)
+	server := httptest.NewServer(s)
+	t.Cleanup(func() {
+		s.Shutdown(context.Background())
+		server.Close()
+	})
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestTCPBridgeRoundTrip(t *testing.T) {
+	for _, subprotocol := range []string{tcpbridge.SubprotocolBinary, tcpbridge.SubprotocolBase64} {
+		t.Run(subprotocol, func(t *testing.T) {
+			url := newBridgeServer(t, &tcpbridge.Server{Target: newTCPEcho(t)})
+
+			// TCP client -> ReverseServer -> Server -> TCP echo, and back.
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Listen: %v", err)
+			}
+
+			reverse := &tcpbridge.ReverseServer{
+				URL:         url,
+				Subprotocol: subprotocol,
+				Logger:      log.New(io.Discard, "", 0),
+			}
+			served := make(chan error, 1)
+			go func() { served <- reverse.Serve(ln) }()
+
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatalf("Dial: %v", err)
+			}
+			defer conn.Close()
+
+			payload := bytes.Repeat([]byte("0123456789"), 10_000)
+			go conn.Write(payload)
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			buf := make([]byte, len(payload))
+			if _, err := io.ReadFull(conn, buf); err != nil {
+				t.Fatalf("ReadFull: %v", err)
+			}
+
+			if !bytes.Equal(buf, payload) {
+				t.Fatal("payload changed on the way through the bridges")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := reverse.Shutdown(ctx); err != nil {
+				t.Fatalf("Shutdown: %v", err)
+			}
+
+			if err := <-served; !errors.Is(err, tcpbridge.ErrShutdown) {
+				t.Fatalf("expect Serve to return ErrShutdown found %v", err)
+			}
+		})
+	}
+}
+
+func TestTCPBridgeSubprotocol(t *testing.T) {
+	url := newBridgeServer(t, &tcpbridge.Server{Target: newTCPEcho(t)})
+
+	client := &websocket.WebSocketClient{Subprotocols: []string{tcpbridge.SubprotocolBase64}}
+	ws, err := client.DialWithContext(context.Background(), newURL(url), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	if ws.Subprotocol() != tcpbridge.SubprotocolBase64 {
+		t.Fatalf("expect subprotocol %q found %q", tcpbridge.SubprotocolBase64, ws.Subprotocol())
+	}
+
+	if err := ws.WriteMessage(websocket.OpcodeTextFrame, []byte("aGVsbG8=")); err != nil {
+		t.Fatalf("WriteMessage: %v", err)
+	}
+
+	msg := ws.ReadMessage()
+	if msg.Err != nil {
+		t.Fatalf("ReadMessage: %v", msg.Err)
+	}
+
+	if msg.Opcode != websocket.OpcodeTextFrame || string(msg.Data) != "aGVsbG8=" {
+		t.Fatalf("expect text %q found %s %q", "aGVsbG8=", msg.Opcode, msg.Data)
+	}
+}
+
+func TestTCPBridgeMaxConns(t *testing.T) {
+	url := newBridgeServer(t, &tcpbridge.Server{Target: newTCPEcho(t), MaxConns: 1})
+
+	client := &websocket.WebSocketClient{}
+	ws, err := client.DialWithContext(context.Background(), newURL(url), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	if _, err := client.DialWithContext(context.Background(), newURL(url), nil); !errors.Is(err, websocket.ErrBadHandshake) {
+		t.Fatalf("expect the second connection to be rejected found %v", err)
+	}
+}
+
+func TestTCPBridgeShutdown(t *testing.T) {
+	s := &tcpbridge.Server{Target: newTCPEcho(t)}
+	url := newBridgeServer(t, s)
+
+	ws, err := (&websocket.WebSocketClient{}).DialWithContext(context.Background(), newURL(url), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	// Keep reading so the close frame of the server is answered.
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if msg := ws.ReadMessage(); msg.Err != nil {
+				closed <- msg.Err
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+
+	if err := <-closed; !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("expect close %d found %v", websocket.CloseGoingAway, err)
+	}
+
+	if _, err := (&websocket.WebSocketClient{}).DialWithContext(context.Background(), newURL(url), nil); err == nil {
+		t.Fatal("expect connections to be rejected after Shutdown")
+	}
+}
@@ -0,0 +1,144 @@
+package websocket_test
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prafitradimas/websocket/pkg/websocket"
+	"github.com/prafitradimas/websocket/pkg/websocket/conformance"
+)
+
+func TestClientTrace(t *testing.T) {
+	server := httptest.NewTLSServer(conformance.EchoHandler(&websocket.WebSocketServer{}))
+	defer server.Close()
+
+	var events []string
+	event := func(name string) { events = append(events, name) }
+	trace := &httptrace.ClientTrace{
+		GetConn:              func(string) { event("GetConn") },
+		ConnectStart:         func(string, string) { event("ConnectStart") },
+		ConnectDone:          func(string, string, error) { event("ConnectDone") },
+		TLSHandshakeStart:    func() { event("TLSHandshakeStart") },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { event("TLSHandshakeDone") },
+		GotConn:              func(httptrace.GotConnInfo) { event("GotConn") },
+		WroteHeaders:         func() { event("WroteHeaders") },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { event("WroteRequest") },
+		GotFirstResponseByte: func() { event("GotFirstResponseByte") },
+	}
+
+	client := &websocket.WebSocketClient{
+		TLSClientConfig: server.Client().Transport.(*http.Transport).TLSClientConfig,
+	}
+	ctx := httptrace.WithClientTrace(context.Background(), trace)
+	ws, err := client.DialWithContext(ctx, newURL("wss"+strings.TrimPrefix(server.URL, "https")), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	expect := "GetConn ConnectStart ConnectDone TLSHandshakeStart TLSHandshakeDone GotConn WroteHeaders WroteRequest GotFirstResponseByte"
+	if found := strings.Join(events, " "); found != expect {
+		t.Fatalf("expect events\n%s\nfound\n%s", expect, found)
+	}
+}
+
+func TestConnTrace(t *testing.T) {
+	server := httptest.NewServer(conformance.EchoHandler(&websocket.WebSocketServer{}))
+	defer server.Close()
+
+	var (
+		mu     sync.Mutex
+		frames []websocket.FrameInfo
+		pings  []websocket.FrameInfo
+		pongs  []websocket.FrameInfo
+		closes []websocket.CloseInfo
+	)
+	record := func(list *[]websocket.FrameInfo) func(websocket.FrameInfo) {
+		return func(info websocket.FrameInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			*list = append(*list, info)
+		}
+	}
+
+	trace := &websocket.ConnTrace{
+		OnFrameRead:  record(&frames),
+		OnFrameWrite: record(&frames),
+		OnPing:       record(&pings),
+		OnPong:       record(&pongs),
+		OnClose: func(info websocket.CloseInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			closes = append(closes, info)
+		},
+	}
+
+	ctx := websocket.WithConnTrace(context.Background(), trace)
+	ws, err := (&websocket.WebSocketClient{}).DialWithContext(ctx, newURL("ws"+strings.TrimPrefix(server.URL, "http")), nil)
+	if err != nil {
+		t.Fatalf("DialWithContext: %v", err)
+	}
+	defer ws.Close()
+
+	// Large enough to be written as two frames.
+	payload := strings.Repeat("x", 600)
+	ws.WriteMessage(websocket.OpcodeTextFrame, []byte(payload))
+	if msg := ws.ReadMessage(); msg.Err != nil || string(msg.Data) != payload {
+		t.Fatalf("expect the echo found %d bytes, %v", len(msg.Data), msg.Err)
+	}
+
+	ws.WriteMessage(websocket.OpcodePingFrame, []byte("ping"))
+	if msg := ws.ReadMessage(); msg.Opcode != websocket.OpcodePongFrame {
+		t.Fatalf("expect a pong found %v, %v", msg.Opcode, msg.Err)
+	}
+
+	ws.WriteCloseMessage(websocket.CloseNormalClosure, []byte("bye"))
+	if msg := ws.ReadMessage(); !msg.Opcode.IsClose() {
+		t.Fatalf("expect the close reply found %v, %v", msg.Opcode, msg.Err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var written, read int64
+	for _, f := range frames {
+		if f.Start.IsZero() || f.Duration < 0 {
+			t.Fatalf("expect timings found %+v", f)
+		}
+		if f.Opcode.IsData() || f.Opcode == websocket.OpcodeContinueFrame {
+			if f.Written {
+				written += f.Length
+			} else {
+				read += f.Length
+			}
+		}
+	}
+
+	if written != 600 || read != 600 {
+		t.Fatalf("expect 600 bytes each way found %d written, %d read", written, read)
+	}
+
+	first := frames[0]
+	if !first.Written || first.Opcode != websocket.OpcodeTextFrame || first.Fin {
+		t.Fatalf("expect the first frame to be a written text fragment found %+v", first)
+	}
+
+	if len(pings) != 1 || !pings[0].Written || pings[0].Length != 4 {
+		t.Fatalf("expect one ping written found %+v", pings)
+	}
+
+	if len(pongs) != 1 || pongs[0].Written || pongs[0].Length != 4 {
+		t.Fatalf("expect one pong read found %+v", pongs)
+	}
+
+	if len(closes) != 2 || !closes[0].Written || closes[0].Code != websocket.CloseNormalClosure || closes[0].Reason != "bye" ||
+		closes[1].Written || closes[1].Code != websocket.CloseNormalClosure {
+		t.Fatalf("expect a close written then read found %+v", closes)
+	}
+}